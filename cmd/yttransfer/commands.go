@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"great_transport/internal/app"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"sync", "channel|video ID", "download and upload a channel's newest videos or a single video", runSync},
+	{"serve", "", "run the HTTP controller and/or the scheduled watcher", runServe},
+	{"status", "", "summarise job states, dead letters and scheduled channels", runStatus},
+	{"history", "", "list recently processed videos", runHistory},
+	{"retry", "VIDEO_ID", "requeue a failed or dead-lettered video and sync it now", runRetry},
+	{"forget", "VIDEO_ID", "delete everything recorded about a video so it is uploaded again", runForget},
+	{"doctor", "", "check external tools and settings", runDoctor},
+	{"migrate", "status|up", "show or apply database schema migrations", runMigrate},
+	{"subscriptions", "list|add|update|remove", "manage channel subscriptions", runSubscriptions},
+	{"config", "print", "show the effective configuration", func(_ context.Context, args []string, out io.Writer) error {
+		return runConfig(args, out)
+	}},
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func isHelpArg(arg string) bool {
+	switch arg {
+	case "help", "-h", "-help", "--help":
+		return true
+	}
+	return false
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintln(out, "usage: yttransfer <command> [arguments] [flags]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "commands:")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, `Run "yttransfer <command> -h" for the flags of a command. The flag-only`)
+	fmt.Fprintln(out, "form (yttransfer --channel-id ID, --video-id ID or --http-addr ADDR) still works.")
+}
+
+// newCommandFlagSet returns a flag set whose -h output shows how to call
+// the command.
+func newCommandFlagSet(name, args string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: yttransfer %s [flags]\n\nflags:\n", strings.TrimSpace(name+" "+args))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// positionalArg takes a leading ID off args so it may come before the
+// flags; flag parsing stops at the first non-flag argument otherwise.
+func positionalArg(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+// requireID returns the positional ID given before or after the flags.
+func requireID(fs *flag.FlagSet, id, what string) (string, error) {
+	if id == "" {
+		id = fs.Arg(0)
+	}
+	if id == "" {
+		return "", fmt.Errorf("%s: %s required", fs.Name(), what)
+	}
+	return id, nil
+}
+
+// withController opens the store and builds the controller for cfg, runs
+// fn and closes the store again.
+func withController(ctx context.Context, cfg config, fn func(*app.Controller) error) error {
+	store, err := openStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	controller, err := newController(cfg, store)
+	if err != nil {
+		return err
+	}
+	return fn(controller)
+}
+
+func runSync(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "channel" && args[0] != "video") {
+		return errors.New("usage: yttransfer sync channel|video ID [flags]")
+	}
+	kind := args[0]
+	id, args := positionalArg(args[1:])
+
+	var cfg config
+	fs := newCommandFlagSet("sync "+kind, "ID", out)
+	addStoreFlags(fs, &cfg)
+	addPipelineFlags(fs, &cfg)
+	sources, err := parseWithConfig(fs, &cfg, args)
+	if err != nil {
+		return err
+	}
+	if id, err = requireID(fs, id, kind+" ID"); err != nil {
+		return err
+	}
+	if kind == "channel" {
+		cfg.channelID = id
+	} else {
+		cfg.videoID = id
+	}
+	if err := sources.annotate(validateValues(&cfg)); err != nil {
+		return err
+	}
+	return withController(ctx, cfg, func(controller *app.Controller) error {
+		if kind == "channel" {
+			return syncChannel(ctx, controller, id, cfg.limit)
+		}
+		return controller.SyncVideo(ctx, id)
+	})
+}
+
+func runServe(ctx context.Context, args []string, out io.Writer) error {
+	cfg, err := parseServeFlags(args, out)
+	if err != nil {
+		return err
+	}
+	return withController(ctx, cfg, func(controller *app.Controller) error {
+		return serve(ctx, cfg, controller)
+	})
+}
+
+func parseServeFlags(args []string, out io.Writer) (config, error) {
+	var cfg config
+	fs := newCommandFlagSet("serve", "", out)
+	addStoreFlags(fs, &cfg)
+	addPipelineFlags(fs, &cfg)
+	addServeFlags(fs, &cfg, ":8080")
+	sources, err := parseWithConfig(fs, &cfg, args)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.httpAddr == "" && cfg.watchPath == "" && !cfg.watchSubs {
+		return cfg, sources.annotate(errors.New("serve needs --http-addr, --watch or --watch-subscriptions"))
+	}
+	if err := sources.annotate(validateWebSub(cfg)); err != nil {
+		return cfg, err
+	}
+	return cfg, sources.annotate(validateValues(&cfg))
+}
+
+// openStoreFromFlags parses the flags of a command that only reads or
+// edits the database and opens it without migrating it.
+func openStoreFromFlags(ctx context.Context, fs *flag.FlagSet, cfg *config, args []string) (app.Store, error) {
+	addStoreFlags(fs, cfg)
+	if _, err := parseWithConfig(fs, cfg, args); err != nil {
+		return nil, err
+	}
+	return openExistingStore(ctx, cfg.dbPath)
+}
+
+func runStatus(ctx context.Context, args []string, out io.Writer) error {
+	var cfg config
+	store, err := openStoreFromFlags(ctx, newCommandFlagSet("status", "", out), &cfg, args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	counts, err := store.JobCounts(ctx)
+	if err != nil {
+		return err
+	}
+	dead, err := store.DeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+	subs, err := store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	runs, err := store.ChannelRuns(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tVIDEOS")
+	for _, state := range []app.JobState{app.JobDiscovered, app.JobDownloading, app.JobDownloaded, app.JobUploading, app.JobUploaded, app.JobFailed} {
+		fmt.Fprintf(tw, "%s\t%d\n", state, counts[state])
+	}
+	fmt.Fprintf(tw, "dead-lettered\t%d\n", len(dead))
+	enabled := 0
+	for _, sub := range subs {
+		if sub.Enabled {
+			enabled++
+		}
+	}
+	fmt.Fprintf(tw, "\nsubscriptions\t%d (%d enabled)\n", len(subs), enabled)
+	if len(runs) > 0 {
+		fmt.Fprintln(tw, "\nCHANNEL\tLAST RUN\tDURATION\tRESULT")
+		for _, run := range runs {
+			result := "ok"
+			if run.LastError != "" {
+				result = run.LastError
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", run.ChannelID, run.StartedAt.Local().Format(time.DateTime),
+				run.FinishedAt.Sub(run.StartedAt).Round(time.Second), result)
+		}
+	}
+	return tw.Flush()
+}
+
+func runHistory(ctx context.Context, args []string, out io.Writer) error {
+	var cfg config
+	fs := newCommandFlagSet("history", "", out)
+	channelID := fs.String("channel", "", "only show videos of this channel")
+	limit := fs.Int("limit", 20, "number of videos to show")
+	store, err := openStoreFromFlags(ctx, fs, &cfg, args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	jobs, err := store.RecentJobs(ctx, *channelID, *limit)
+	if err != nil {
+		return err
+	}
+	dead, err := store.DeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+	deadLettered := make(map[string]bool, len(dead))
+	for _, dl := range dead {
+		deadLettered[dl.VideoID] = true
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "UPDATED\tVIDEO\tCHANNEL\tSTATE\tATTEMPTS\tERROR")
+	for _, job := range jobs {
+		state := string(job.State)
+		if deadLettered[job.VideoID] {
+			state = "dead-lettered"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", job.UpdatedAt.Local().Format(time.DateTime), job.VideoID, job.ChannelID,
+			state, job.Attempts, orDash(truncate(job.LastError, 80)))
+	}
+	return tw.Flush()
+}
+
+func runRetry(ctx context.Context, args []string, out io.Writer) error {
+	id, args := positionalArg(args)
+	var cfg config
+	fs := newCommandFlagSet("retry", "VIDEO_ID", out)
+	addStoreFlags(fs, &cfg)
+	addPipelineFlags(fs, &cfg)
+	sources, err := parseWithConfig(fs, &cfg, args)
+	if err != nil {
+		return err
+	}
+	if id, err = requireID(fs, id, "video ID"); err != nil {
+		return err
+	}
+	cfg.videoID = id
+	if err := sources.annotate(validateValues(&cfg)); err != nil {
+		return err
+	}
+	return withController(ctx, cfg, func(controller *app.Controller) error {
+		requeued, err := controller.Store.Requeue(ctx, id)
+		if err != nil {
+			return err
+		}
+		if requeued {
+			fmt.Fprintf(out, "requeued dead-lettered video %s\n", id)
+		}
+		if err := controller.SyncVideo(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "synced %s\n", id)
+		return nil
+	})
+}
+
+func runForget(ctx context.Context, args []string, out io.Writer) error {
+	id, args := positionalArg(args)
+	var cfg config
+	fs := newCommandFlagSet("forget", "VIDEO_ID", out)
+	addStoreFlags(fs, &cfg)
+	if _, err := parseWithConfig(fs, &cfg, args); err != nil {
+		return err
+	}
+	id, err := requireID(fs, id, "video ID")
+	if err != nil {
+		return err
+	}
+	store, err := openExistingStore(ctx, cfg.dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ok, err := store.Forget(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("nothing recorded for video %s", id)
+	}
+	fmt.Fprintf(out, "forgot %s; the next sync of its channel uploads it again (downloaded files are kept)\n", id)
+	return nil
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// runMigrate shows the schema migrations of the database and, for "up",
+// applies the pending ones. Commands that sync apply them on start, so
+// "up" is needed to migrate ahead of a deploy or before status, history
+// and forget.
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	action, args := positionalArg(args)
+	if action != "status" && action != "up" {
+		return errors.New("usage: yttransfer migrate status|up [flags]")
+	}
+	var cfg config
+	fs := newCommandFlagSet("migrate "+action, "", out)
+	addStoreFlags(fs, &cfg)
+	if _, err := parseWithConfig(fs, &cfg, args); err != nil {
+		return err
+	}
+	store, err := app.OpenStore(cfg.dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if action == "up" {
+		if err := store.EnsureSchema(ctx); err != nil {
+			return err
+		}
+	}
+	status, err := store.SchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, m := range status.Migrations {
+		applied := "pending"
+		if !m.AppliedAt.IsZero() {
+			applied = m.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nschema version %d, latest %d\n", status.Current, status.Latest)
+	if status.Current > status.Latest {
+		return fmt.Errorf("%w: upgrade yttransfer before using this database", app.ErrSchemaTooNew)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"great_transport/internal/app"
+)
+
+func TestRunStatusHistoryForget(t *testing.T) {
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "metadata.db")
+	store, err := app.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []*app.VideoJob{
+		{VideoID: "vid1", ChannelID: "UC1", State: app.JobUploaded, Attempts: 1},
+		{VideoID: "vid2", ChannelID: "UC1", State: app.JobFailed, Attempts: 3, LastError: "upload\nrejected"},
+	} {
+		if err := store.SaveJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.MarkUploaded(ctx, app.UploadRecord{VideoID: "vid1", ChannelID: "UC1", Platform: app.DefaultPlatform}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddDeadLetter(ctx, app.DeadLetter{VideoID: "vid2", ChannelID: "UC1", Stage: "upload", Attempts: 3, Error: "rejected"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// A shared config file may set keys these commands have no flags for.
+	t.Setenv(configEnvVar, writeConfig(t, "db_path: "+db+"\nhttp_addr: :9000\nlimit: 2\nchannels:\n  UC9:\n    limit: 1\n"))
+	run := func(cmd func(context.Context, []string, io.Writer) error, args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := cmd(ctx, args, &out); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out.String())
+		}
+		return out.String()
+	}
+
+	status := run(runStatus)
+	for _, want := range []string{"uploaded", "dead-lettered", "subscriptions"} {
+		if !strings.Contains(status, want) {
+			t.Fatalf("expected %q in status output:\n%s", want, status)
+		}
+	}
+	history := run(runHistory, "--channel", "UC1")
+	if !strings.Contains(history, "vid1") || !strings.Contains(history, "dead-lettered") || !strings.Contains(history, "upload rejected") {
+		t.Fatalf("unexpected history output:\n%s", history)
+	}
+	if out := run(runForget, "vid2"); !strings.Contains(out, "forgot vid2") {
+		t.Fatalf("unexpected forget output: %s", out)
+	}
+	if strings.Contains(run(runHistory), "vid2") {
+		t.Fatal("expected vid2 to be gone from history")
+	}
+	if err := runForget(ctx, []string{"vid2"}, io.Discard); err == nil {
+		t.Fatal("expected forgetting an unknown video to fail")
+	}
+
+	// Only syncs write the config file's channels into the database.
+	store, err = app.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if sub, err := store.GetSubscription(ctx, "UC9"); err != nil || sub != nil {
+		t.Fatalf("expected no subscription from the config file, got %+v, %v", sub, err)
+	}
+}
+
+func TestReadOnlyCommandsDoNotMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "metadata.db")
+	if err := runStatus(ctx, []string{"--db-path", db}, io.Discard); err == nil || !strings.Contains(err.Error(), "does not exist yet") {
+		t.Fatalf("expected a missing database error, got %v", err)
+	}
+	if _, err := os.Stat(db); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("status created the database: %v", err)
+	}
+
+	if err := os.WriteFile(db, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runHistory(ctx, []string{"--db-path", db}, io.Discard); err == nil || !strings.Contains(err.Error(), "migrate up") {
+		t.Fatalf("expected a pending migrations error, got %v", err)
+	}
+	store, err := app.OpenStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if status, err := store.SchemaStatus(ctx); err != nil || status.Current != 0 {
+		t.Fatalf("history migrated the database: %+v, %v", status, err)
+	}
+}
+
+func TestRunCommandsRequireIDs(t *testing.T) {
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "metadata.db")
+	tests := []struct {
+		name string
+		run  func(context.Context, []string, io.Writer) error
+		args []string
+		want string
+	}{
+		{"sync without target", runSync, nil, "usage: yttransfer sync channel|video ID"},
+		{"sync unknown target", runSync, []string{"playlist", "PL1"}, "usage: yttransfer sync channel|video ID"},
+		{"sync channel without id", runSync, []string{"channel", "--db-path", db}, "sync channel: channel ID required"},
+		{"retry without id", runRetry, []string{"--db-path", db}, "retry: video ID required"},
+		{"forget without id", runForget, []string{"--db-path", db}, "forget: video ID required"},
+		{"sync invalid value", runSync, []string{"video", "abc", "--download-workers", "0"}, "--download-workers and --upload-workers must be > 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(ctx, tt.args, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseServeFlags(t *testing.T) {
+	cfg, err := parseServeFlags(nil, io.Discard)
+	if err != nil {
+		t.Fatalf("parseServeFlags: %v", err)
+	}
+	if cfg.httpAddr != ":8080" {
+		t.Fatalf("expected serve to listen on :8080 by default, got %q", cfg.httpAddr)
+	}
+	if cfg, err := parseServeFlags([]string{"--http-addr", "", "--watch-subscriptions"}, io.Discard); err != nil || cfg.httpAddr != "" || !cfg.watchSubs {
+		t.Fatalf("expected watch-only serve, got %+v, %v", cfg, err)
+	}
+	if _, err := parseServeFlags([]string{"--http-addr", ""}, io.Discard); err == nil || !strings.Contains(err.Error(), "serve needs --http-addr") {
+		t.Fatalf("expected serve without address or watch to fail, got %v", err)
+	}
+	if _, err := parseServeFlags([]string{"--websub-callback", "https://example.com/websub"}, io.Discard); err == nil || !strings.Contains(err.Error(), "websub secret is required") {
+		t.Fatalf("expected websub without secret to fail, got %v", err)
+	}
+}
+
+func TestPrintUsageListsCommands(t *testing.T) {
+	var out bytes.Buffer
+	printUsage(&out)
+	for _, cmd := range commands {
+		if !strings.Contains(out.String(), "  "+cmd.name) {
+			t.Fatalf("usage does not mention %s:\n%s", cmd.name, out.String())
+		}
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "metadata.db")
+	var out bytes.Buffer
+	if err := runMigrate(ctx, []string{"status", "--db-path", db}, &out); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !strings.Contains(out.String(), "initial ") || !strings.Contains(out.String(), "pending") || !strings.Contains(out.String(), "schema version 0,") {
+		t.Fatalf("expected a pending initial migration:\n%s", out.String())
+	}
+	out.Reset()
+	if err := runMigrate(ctx, []string{"up", "--db-path", db}, &out); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if strings.Contains(out.String(), "pending") || strings.Contains(out.String(), "schema version 0,") {
+		t.Fatalf("expected every migration applied:\n%s", out.String())
+	}
+	if err := runMigrate(ctx, []string{"down"}, io.Discard); err == nil || !strings.Contains(err.Error(), "usage: yttransfer migrate") {
+		t.Fatalf("expected a usage error, got %v", err)
+	}
+}
+
+func TestServeReturnsHTTPServerError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	store, err := app.NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The address is taken, so the server fails and the watcher must stop
+	// instead of the process exiting.
+	cfg := config{httpAddr: ln.Addr().String(), watchSubs: true}
+	done := make(chan error, 1)
+	go func() { done <- serve(context.Background(), cfg, &app.Controller{Store: store}) }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "http server") {
+			t.Fatalf("expected the http server error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the http server failed")
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"great_transport/internal/app"
+)
+
+const (
+	configEnvVar = "YTTRANSFER_CONFIG"
+	envPrefix    = "YTTRANSFER_"
+)
+
+// configKey maps a config file key, and the YTTRANSFER_* environment
+// variable derived from it, onto the flag it sets. Nested keys are
+// written as sections in the file ("retry:" then "attempts: 3").
+type configKey struct {
+	key  string
+	flag string
+}
+
+var configKeys = []configKey{
+	{"output", "output"},
+	{"db_path", "db-path"},
+	{"platform", "platform"},
+	{"http_addr", "http-addr"},
+	{"limit", "limit"},
+	{"sleep_seconds", "sleep-seconds"},
+	{"js_runtime", "js-runtime"},
+	{"format", "format"},
+	{"download_workers", "download-workers"},
+	{"upload_workers", "upload-workers"},
+	{"unordered", "unordered"},
+	{"retry.attempts", "retry-attempts"},
+	{"retry.backoff", "retry-backoff"},
+	{"retry.max_backoff", "retry-max-backoff"},
+	{"retry.jitter", "retry-jitter"},
+	{"retry.dead_letter_after", "dead-letter-after"},
+	{"cover.aspect", "cover-aspect"},
+	{"cover.width", "cover-width"},
+	{"subtitles.mode", "subtitle-mode"},
+	{"subtitles.langs", "subtitle-langs"},
+	{"subtitles.auto", "subtitle-auto"},
+	{"subtitles.format", "subtitle-format"},
+	{"watch.file", "watch"},
+	{"watch.subscriptions", "watch-subscriptions"},
+	{"websub.callback", "websub-callback"},
+	{"websub.secret", "websub-secret"},
+	{"websub.hub", "websub-hub"},
+	{"websub.lease", "websub-lease"},
+	{"metadata.title_prefix", "metadata-title-prefix"},
+	{"metadata.title", "metadata-title"},
+	{"metadata.description", "metadata-desc"},
+	{"metadata.tags", "metadata-tags"},
+	{"bilibili.client", "bilibili-client"},
+	{"bilibili.biliup_binary", "biliup-binary"},
+	{"bilibili.cookie", "biliup-cookie"},
+	{"bilibili.line", "biliup-line"},
+	{"bilibili.limit", "biliup-limit"},
+	{"bilibili.title_prefix", "biliup-title-prefix"},
+	{"bilibili.title", "biliup-title"},
+	{"bilibili.description", "biliup-desc"},
+	{"bilibili.dynamic", "biliup-dynamic"},
+	{"bilibili.tags", "biliup-tags"},
+	{"douyin.cookie", "douyin-cookie"},
+	{"douyin.limit", "douyin-limit"},
+	{"douyin.visibility", "douyin-visibility"},
+	{"douyin.publish_at", "douyin-publish-at"},
+	{"xiaohongshu.cookie", "xiaohongshu-cookie"},
+	{"xiaohongshu.limit", "xiaohongshu-limit"},
+	{"xiaohongshu.private", "xiaohongshu-private"},
+	{"kuaishou.cookie", "kuaishou-cookie"},
+	{"kuaishou.limit", "kuaishou-limit"},
+	{"xigua.cookie", "xigua-cookie"},
+	{"xigua.limit", "xigua-limit"},
+}
+
+// secretConfigKeys are redacted by `config print`.
+var secretConfigKeys = map[string]bool{"websub.secret": true}
+
+func (k configKey) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(k.key, ".", "_"))
+}
+
+// configFile is a parsed YAML config file.
+type configFile struct {
+	path   string
+	values map[string]configValue
+	// channels are per-channel overrides, kept in sync with the
+	// subscriptions table at startup.
+	channels []app.Subscription
+}
+
+type configValue struct {
+	value string
+	line  int
+}
+
+// channelConfig is one entry under "channels:".
+type channelConfig struct {
+	Limit       int       `yaml:"limit"`
+	Schedule    string    `yaml:"schedule,omitempty"`
+	Platforms   csvString `yaml:"platforms,omitempty"`
+	Title       string    `yaml:"title,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	Dynamic     string    `yaml:"dynamic,omitempty"`
+	Tags        csvString `yaml:"tags,omitempty"`
+	Enabled     *bool     `yaml:"enabled"`
+}
+
+var channelConfigKeys = map[string]bool{
+	"limit": true, "schedule": true, "platforms": true, "title": true,
+	"description": true, "dynamic": true, "tags": true, "enabled": true,
+}
+
+// csvString accepts either a comma-separated string or a YAML sequence,
+// which is joined with commas.
+type csvString string
+
+func (c *csvString) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*c = csvString(node.Value)
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*c = csvString(strings.Join(values, ","))
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a list or comma-separated string", node.Line)
+}
+
+func loadConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	file := &configFile{path: path, values: map[string]configValue{}}
+	if len(doc.Content) == 0 {
+		return file, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of settings", path, root.Line)
+	}
+	known := map[string]bool{}
+	for _, k := range configKeys {
+		known[k.key] = true
+	}
+	if err := file.flatten(root, "", known); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *configFile) flatten(node *yaml.Node, prefix string, known map[string]bool) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		key := prefix + keyNode.Value
+		if key == "channels" {
+			if err := f.parseChannels(value); err != nil {
+				return err
+			}
+			continue
+		}
+		switch value.Kind {
+		case yaml.MappingNode:
+			if err := f.flatten(value, key+".", known); err != nil {
+				return err
+			}
+			continue
+		case yaml.SequenceNode:
+			var list csvString
+			if err := value.Decode(&list); err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", f.path, value.Line, key, err)
+			}
+			value = &yaml.Node{Kind: yaml.ScalarNode, Value: string(list), Line: value.Line}
+		case yaml.ScalarNode:
+		default:
+			return fmt.Errorf("%s:%d: %s: unsupported value", f.path, value.Line, key)
+		}
+		if !known[key] {
+			return fmt.Errorf("%s:%d: unknown key %q", f.path, keyNode.Line, key)
+		}
+		f.values[key] = configValue{value: value.Value, line: value.Line}
+	}
+	return nil
+}
+
+func (f *configFile) parseChannels(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: channels: expected a mapping of channel IDs", f.path, node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		id, body := node.Content[i].Value, node.Content[i+1]
+		where := fmt.Sprintf("%s:%d: channels.%s", f.path, node.Content[i].Line, id)
+		if body.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: expected a mapping of settings", where)
+		}
+		for j := 0; j < len(body.Content); j += 2 {
+			if key := body.Content[j]; !channelConfigKeys[key.Value] {
+				return fmt.Errorf("%s:%d: channels.%s: unknown key %q", f.path, key.Line, id, key.Value)
+			}
+		}
+		var ch channelConfig
+		if err := body.Decode(&ch); err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		sub := app.Subscription{
+			ChannelID: id,
+			Platforms: parseCSVList(string(ch.Platforms)),
+			Limit:     ch.Limit,
+			Schedule:  strings.TrimSpace(ch.Schedule),
+			Templates: app.MetadataTemplates{
+				Title:       ch.Title,
+				Description: ch.Description,
+				Dynamic:     ch.Dynamic,
+				Tags:        string(ch.Tags),
+			},
+			Enabled: ch.Enabled == nil || *ch.Enabled,
+		}
+		f.channels = append(f.channels, sub)
+	}
+	return nil
+}
+
+// configSources records where each flag not given on the command line got
+// its value, so validation errors can point at the config key.
+type configSources map[string]string
+
+var flagMention = regexp.MustCompile(`--([a-z0-9-]+)`)
+
+// annotate appends the origin of every flag an error message mentions
+// that was set by the environment or the config file.
+func (s configSources) annotate(err error) error {
+	if err == nil || len(s) == 0 {
+		return err
+	}
+	var origins []string
+	seen := map[string]bool{}
+	for _, m := range flagMention.FindAllStringSubmatch(err.Error(), -1) {
+		for name, origin := range s {
+			// "--subtitle-*" stands for every --subtitle- flag.
+			matches := name == m[1] || strings.HasSuffix(m[1], "-") && strings.HasPrefix(name, m[1])
+			if matches && !seen[origin] {
+				seen[origin] = true
+				origins = append(origins, origin)
+			}
+		}
+	}
+	sort.Strings(origins)
+	if len(origins) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (set by %s)", err, strings.Join(origins, ", "))
+}
+
+// applyConfigSources fills every flag of fs that was not given on the
+// command line from its environment variable or, failing that, the config
+// file.
+func applyConfigSources(fs *flag.FlagSet, file *configFile, lookupEnv func(string) (string, bool)) (configSources, error) {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	sources := configSources{}
+	for _, k := range configKeys {
+		// Subcommands only register the flags they use; the other keys
+		// of a shared config file do not apply to them.
+		if explicit[k.flag] || fs.Lookup(k.flag) == nil {
+			continue
+		}
+		var value, origin string
+		if v, ok := lookupEnv(k.envName()); ok {
+			value, origin = v, k.envName()
+		} else if file != nil {
+			v, ok := file.values[k.key]
+			if !ok {
+				continue
+			}
+			value, origin = v.value, fmt.Sprintf("%s:%d %s", file.path, v.line, k.key)
+		} else {
+			continue
+		}
+		if err := fs.Set(k.flag, value); err != nil {
+			return nil, fmt.Errorf("%s: invalid value %q: %w", origin, value, err)
+		}
+		sources[k.flag] = origin
+	}
+	return sources, nil
+}
+
+// runConfig implements `yttransfer config print`, which shows the
+// effective configuration after merging defaults, the config file,
+// environment variables and flags.
+func runConfig(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: yttransfer config print [--config FILE] [flags]")
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.SetOutput(out)
+	cfg, sources, err := resolveFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if err := sources.annotate(validateValues(&cfg)); err != nil {
+		return err
+	}
+	doc, err := effectiveConfig(fs, cfg)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// effectiveConfig renders the resolved flags in config file layout.
+func effectiveConfig(fs *flag.FlagSet, cfg config) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	for _, k := range configKeys {
+		f := fs.Lookup(k.flag)
+		if f == nil {
+			return nil, fmt.Errorf("config key %s maps to unknown flag --%s", k.key, k.flag)
+		}
+		value := scalarNode(f)
+		if secretConfigKeys[k.key] && value.Value != "" {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "<redacted>"}
+		}
+		parent := root
+		name := k.key
+		if section, field, nested := strings.Cut(k.key, "."); nested {
+			if sections[section] == nil {
+				sections[section] = &yaml.Node{Kind: yaml.MappingNode}
+				root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, sections[section])
+			}
+			parent, name = sections[section], field
+		}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	}
+	if len(cfg.channels) > 0 {
+		channels := &yaml.Node{Kind: yaml.MappingNode}
+		subs := append([]app.Subscription(nil), cfg.channels...)
+		sort.Slice(subs, func(i, j int) bool { return subs[i].ChannelID < subs[j].ChannelID })
+		for _, sub := range subs {
+			var node yaml.Node
+			if err := node.Encode(channelConfig{
+				Limit:       sub.Limit,
+				Schedule:    sub.Schedule,
+				Platforms:   csvString(strings.Join(sub.Platforms, ",")),
+				Title:       sub.Templates.Title,
+				Description: sub.Templates.Description,
+				Dynamic:     sub.Templates.Dynamic,
+				Tags:        csvString(sub.Templates.Tags),
+				Enabled:     &sub.Enabled,
+			}); err != nil {
+				return nil, err
+			}
+			channels.Content = append(channels.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: sub.ChannelID}, &node)
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "channels"}, channels)
+	}
+	return root, nil
+}
+
+func scalarNode(f *flag.Flag) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: f.Value.String(), Tag: "!!str"}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return node
+	}
+	switch getter.Get().(type) {
+	case bool:
+		node.Tag = "!!bool"
+	case int:
+		node.Tag = "!!int"
+	case float64:
+		node.Tag = "!!float"
+	case time.Duration:
+		// Durations stay strings ("10s") so they read back as flags do.
+	}
+	return node
+}
+
+// syncConfigChannels writes the config file's per-channel overrides into
+// the subscriptions table, replacing the stored settings of those
+// channels. Subscriptions not in the file are left alone.
+func syncConfigChannels(ctx context.Context, store app.Store, channels []app.Subscription) error {
+	for _, sub := range channels {
+		ok, err := store.UpdateSubscription(ctx, sub)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := store.AddSubscription(ctx, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
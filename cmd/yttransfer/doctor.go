@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"great_transport/internal/app"
+)
+
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip"
+)
+
+type doctorCheck struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail"`
+}
+
+const (
+	// Thresholds for the doctor's warnings; a single 4K video easily takes
+	// several gigabytes.
+	minFreeBytes    = 1 << 30
+	lowFreeBytes    = 10 << 30
+	cookieExpiryDue = 7 * 24 * time.Hour
+	ytDlpMaxAge     = 180 * 24 * time.Hour
+	toolTimeout     = 10 * time.Second
+)
+
+var (
+	// doctorRunner runs the version probes; tests replace it.
+	doctorRunner app.CommandRunner = app.ExecRunner{}
+	doctorNow                      = time.Now
+	diskFree                       = freeDiskSpace
+)
+
+// runDoctor checks the external tools, credentials, output directory and
+// database a sync depends on and fails when any check fails.
+func runDoctor(ctx context.Context, args []string, out io.Writer) error {
+	var cfg config
+	fs := newCommandFlagSet("doctor", "", out)
+	asJSON := fs.Bool("json", false, "print the checks as JSON")
+	addStoreFlags(fs, &cfg)
+	addPipelineFlags(fs, &cfg)
+	sources, err := parseWithConfig(fs, &cfg, args)
+	if err != nil {
+		return err
+	}
+	checks := doctorChecks(ctx, cfg, sources)
+
+	failed := 0
+	for _, c := range checks {
+		if c.Status == checkFail {
+			failed++
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			OK     bool          `json:"ok"`
+			Checks []doctorCheck `json:"checks"`
+		}{failed == 0, checks}); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+		for _, c := range checks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, strings.ToUpper(string(c.Status)), c.Detail)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+func doctorChecks(ctx context.Context, cfg config, sources configSources) []doctorCheck {
+	var checks []doctorCheck
+	add := func(name string, status checkStatus, format string, args ...any) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if err := sources.annotate(validateValues(&cfg)); err != nil {
+		add("settings", checkFail, "%v", err)
+	} else {
+		add("settings", checkOK, "%s", orDash(cfg.configPath))
+	}
+
+	// yt-dlp and the JS runtime it needs for YouTube's player challenges.
+	if version, path, err := toolVersion(ctx, "yt-dlp", "--version"); err != nil {
+		add("yt-dlp", checkFail, "%v", err)
+	} else {
+		status, detail := checkOK, fmt.Sprintf("%s (%s)", version, path)
+		if released, err := time.Parse("2006.01.02", version); err == nil && doctorNow().Sub(released) > ytDlpMaxAge {
+			status, detail = checkWarn, detail+"; older than six months, run `yt-dlp -U`"
+		}
+		add("yt-dlp", status, "%s", detail)
+
+		help, _ := probe(ctx, path, "--help")
+		switch {
+		case strings.Contains(help, "--js-runtimes"):
+			add("yt-dlp --js-runtimes", checkOK, "supported")
+		case runtimePrefIsAuto(cfg.jsRuntime):
+			add("yt-dlp --js-runtimes", checkWarn, "not supported; update yt-dlp to 2024.04.09 or newer")
+		default:
+			add("yt-dlp --js-runtimes", checkFail, "not supported but --js-runtime is %s; update yt-dlp to 2024.04.09 or newer", cfg.jsRuntime)
+		}
+	}
+	for _, runtime := range []string{"node", "deno"} {
+		if version, path, err := toolVersion(ctx, runtime, "--version"); err != nil {
+			add(runtime, checkSkip, "%v", err)
+		} else {
+			add(runtime, checkOK, "%s (%s)", version, path)
+		}
+	}
+	if runtime, err := resolveJSRuntime(cfg.jsRuntime); err != nil {
+		status := checkFail
+		if runtimePrefIsAuto(cfg.jsRuntime) {
+			status = checkWarn
+		}
+		add("js runtime", status, "%v", err)
+	} else {
+		add("js runtime", checkOK, "%s", runtime)
+	}
+
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if version, path, err := toolVersion(ctx, tool, "-version"); err != nil {
+			add(tool, checkWarn, "%v; merged formats, covers and burned subtitles need it", err)
+		} else {
+			add(tool, checkOK, "%s (%s)", version, path)
+		}
+	}
+
+	creators := map[string]struct{ path, site string }{
+		"douyin":      {cfg.douyinCookie, "creator.douyin.com"},
+		"xiaohongshu": {cfg.xhsCookie, "creator.xiaohongshu.com"},
+		"kuaishou":    {cfg.kuaishouCookie, "cp.kuaishou.com"},
+		"xigua":       {cfg.xiguaCookie, "studio.ixigua.com"},
+	}
+	biliup := false
+	for _, name := range parseCSVList(cfg.platform) {
+		platform, account := splitDestination(name)
+		if platform == "bilibili" {
+			if !biliup {
+				checks = append(checks, biliupCheck(ctx, cfg))
+				biliup = true
+			}
+			path := accountCookiePath(cfg.biliupCookie, account)
+			expires, err := app.CheckBilibiliCookie(path)
+			checks = append(checks, cookieCheck(name+" cookie", path, "SESSDATA", "run `biliup login` again", expires, err))
+			continue
+		}
+		c, ok := creators[platform]
+		if !ok {
+			continue
+		}
+		path := accountCookiePath(c.path, account)
+		expires, err := app.CheckCreatorCookie(platform, path)
+		checks = append(checks, cookieCheck(name+" cookie", path, app.CreatorSessionCookie(platform), "log in to "+c.site+" and export the cookies again", expires, err))
+	}
+	checks = append(checks, outputDirChecks(cfg.outputDir)...)
+	checks = append(checks, databaseCheck(ctx, cfg.dbPath))
+	return checks
+}
+
+func biliupCheck(ctx context.Context, cfg config) doctorCheck {
+	version, path, err := toolVersion(ctx, cfg.biliupBinary, "--version")
+	switch {
+	case err == nil:
+		return doctorCheck{"biliup", checkOK, fmt.Sprintf("%s (%s)", version, path)}
+	case cfg.bilibiliClient == "biliup":
+		return doctorCheck{"biliup", checkFail, err.Error()}
+	}
+	return doctorCheck{"biliup", checkSkip, "not needed with --bilibili-client native"}
+}
+
+// cookieCheck reports whether the session in a cookie file is still valid.
+// session names the cookie whose expiry counts; relogin tells how to renew it.
+func cookieCheck(name, path, session, relogin string, expires time.Time, err error) doctorCheck {
+	switch {
+	case err != nil:
+		return doctorCheck{name, checkFail, err.Error()}
+	case expires.IsZero():
+		return doctorCheck{name, checkWarn, path + " has no " + session + " expiry; cannot tell when to log in again"}
+	case !expires.After(doctorNow()):
+		return doctorCheck{name, checkFail, fmt.Sprintf("session expired %s; %s", expires.Format(time.DateOnly), relogin)}
+	case expires.Sub(doctorNow()) < cookieExpiryDue:
+		return doctorCheck{name, checkWarn, fmt.Sprintf("session expires %s; log in again soon", expires.Format(time.DateOnly))}
+	default:
+		return doctorCheck{name, checkOK, fmt.Sprintf("%s, valid until %s", path, expires.Format(time.DateOnly))}
+	}
+}
+
+func outputDirChecks(dir string) []doctorCheck {
+	// Like databaseCheck, leave a missing directory alone and check the
+	// parent it would be created in.
+	existing, err := nearestExistingDir(dir)
+	if err != nil {
+		return []doctorCheck{{"output dir", checkFail, err.Error()}}
+	}
+	f, err := os.CreateTemp(existing, ".doctor-*")
+	if err != nil {
+		return []doctorCheck{{"output dir", checkFail, fmt.Sprintf("%s is not writable: %v", existing, err)}}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	checks := []doctorCheck{{"output dir", checkOK, dir + " is writable"}}
+	if existing != filepath.Clean(dir) {
+		checks[0] = doctorCheck{"output dir", checkWarn, fmt.Sprintf("%s does not exist yet; it is created in %s on the first run", dir, existing)}
+	}
+
+	free, err := diskFree(existing)
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		checks = append(checks, doctorCheck{"free space", checkSkip, "not supported on this platform"})
+	case err != nil:
+		checks = append(checks, doctorCheck{"free space", checkWarn, err.Error()})
+	case free < minFreeBytes:
+		checks = append(checks, doctorCheck{"free space", checkFail, formatBytes(free) + " free"})
+	case free < lowFreeBytes:
+		checks = append(checks, doctorCheck{"free space", checkWarn, formatBytes(free) + " free; long videos may not fit"})
+	default:
+		checks = append(checks, doctorCheck{"free space", checkOK, formatBytes(free) + " free"})
+	}
+	return checks
+}
+
+// nearestExistingDir returns dir, or its closest ancestor that exists.
+func nearestExistingDir(dir string) (string, error) {
+	path := filepath.Clean(dir)
+	for {
+		info, err := os.Stat(path)
+		switch {
+		case err == nil && info.IsDir():
+			return path, nil
+		case err == nil:
+			return "", fmt.Errorf("%s is not a directory", path)
+		case !errors.Is(err, os.ErrNotExist):
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		path = parent
+	}
+}
+
+// databaseCheck inspects the database without creating or migrating it.
+func databaseCheck(ctx context.Context, location string) doctorCheck {
+	name := location
+	if app.IsPostgresURL(location) {
+		if u, err := url.Parse(location); err == nil {
+			name = u.Redacted()
+		}
+	} else if _, err := os.Stat(location); errors.Is(err, os.ErrNotExist) {
+		return doctorCheck{"database", checkWarn, location + " does not exist yet; it is created on the first run"}
+	}
+	store, err := app.OpenStore(location)
+	if err != nil {
+		return doctorCheck{"database", checkFail, fmt.Sprintf("%s: %v", name, err)}
+	}
+	defer store.Close()
+	status, err := store.SchemaStatus(ctx)
+	switch {
+	case err != nil:
+		return doctorCheck{"database", checkFail, fmt.Sprintf("%s: %v", name, err)}
+	case status.Current > status.Latest:
+		return doctorCheck{"database", checkFail, fmt.Sprintf("%s is at schema version %d but this build only knows up to %d; upgrade yttransfer", name, status.Current, status.Latest)}
+	case len(status.Pending()) > 0:
+		return doctorCheck{"database", checkWarn, fmt.Sprintf("%s is at schema version %d; %d migration(s) pending, applied on the next run or with `yttransfer migrate up`", name, status.Current, len(status.Pending()))}
+	}
+	return doctorCheck{"database", checkOK, fmt.Sprintf("%s schema is current (version %d)", name, status.Current)}
+}
+
+// toolVersion finds name in PATH and returns the version it reports.
+func toolVersion(ctx context.Context, name string, args ...string) (version, path string, err error) {
+	path, err = app.LookPath(name)
+	if err != nil {
+		return "", "", fmt.Errorf("%s not found in PATH", name)
+	}
+	out, err := probe(ctx, path, args...)
+	if err != nil {
+		return "", path, fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return parseToolVersion(name, out), path, nil
+}
+
+func probe(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, toolTimeout)
+	defer cancel()
+	var out strings.Builder
+	err := doctorRunner.Run(ctx, app.Command{Name: name, Args: args, Stdout: &out, Stderr: &out})
+	return out.String(), err
+}
+
+// parseToolVersion picks the version out of the first line of a tool's
+// version output: "ffmpeg version 6.1.1 Copyright ...", "deno 1.46.3
+// (stable, ...)" or just "2024.08.06".
+func parseToolVersion(name, out string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if f == "version" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	if len(fields) > 1 && strings.EqualFold(fields[0], name) {
+		return fields[1]
+	}
+	return strings.TrimSpace(line)
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"great_transport/internal/app"
+)
+
+// fakeTools answers "<tool> <args>" probes with canned output.
+type fakeTools map[string]string
+
+func (f fakeTools) Run(ctx context.Context, c app.Command) error {
+	out, ok := f[filepath.Base(c.Name)+" "+strings.Join(c.Args, " ")]
+	if !ok {
+		return errors.New("exit status 1")
+	}
+	_, err := io.WriteString(c.Stdout, out)
+	return err
+}
+
+func stubDoctor(t *testing.T, tools fakeTools) {
+	t.Helper()
+	restoreLook, restoreRunner, restoreNow, restoreFree := app.LookPath, doctorRunner, doctorNow, diskFree
+	t.Cleanup(func() {
+		app.LookPath, doctorRunner, doctorNow, diskFree = restoreLook, restoreRunner, restoreNow, restoreFree
+	})
+	app.LookPath = func(name string) (string, error) {
+		if _, ok := tools[name+" --version"]; ok {
+			return "/usr/bin/" + name, nil
+		}
+		if _, ok := tools[name+" -version"]; ok {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+	doctorRunner = tools
+	doctorNow = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+	diskFree = func(string) (uint64, error) { return 50 << 30, nil }
+}
+
+func writeCookie(t *testing.T, expires time.Time) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	data := `{"cookie_info":{"cookies":[{"name":"SESSDATA","value":"sess","expires":` +
+		strconv.FormatInt(expires.Unix(), 10) + `},{"name":"bili_jct","value":"csrf"}]}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeDouyinCookie writes a cookies.txt export whose session cookie has no
+// expiry.
+func writeDouyinCookie(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "douyin_cookies.txt")
+	if err := os.WriteFile(path, []byte(".douyin.com\tTRUE\t/\tTRUE\t0\tsessionid\tsess\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunDoctorJSON(t *testing.T) {
+	stubDoctor(t, fakeTools{
+		"yt-dlp --version": "2024.12.23\n",
+		"yt-dlp --help":    "Usage: yt-dlp [OPTIONS] URL\n  --js-runtimes RUNTIMES\n",
+		"node --version":   "v20.11.1\n",
+		"ffmpeg -version":  "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\n",
+	})
+	dir := t.TempDir()
+	douyin := writeDouyinCookie(t)
+	data, _ := os.ReadFile(douyin)
+	if err := os.WriteFile(accountCookiePath(douyin, "alt"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err := runDoctor(context.Background(), []string{
+		"--json",
+		"--output", filepath.Join(dir, "downloads"),
+		"--db-path", filepath.Join(dir, "metadata.db"),
+		"--biliup-cookie", writeCookie(t, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+		"--platform", "bilibili,douyin,douyin:alt",
+		"--douyin-cookie", douyin,
+	}, &out)
+	if err != nil {
+		t.Fatalf("runDoctor: %v\n%s", err, out.String())
+	}
+	var report struct {
+		OK     bool          `json:"ok"`
+		Checks []doctorCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("decoding report: %v\n%s", err, out.String())
+	}
+	got := map[string]doctorCheck{}
+	for _, c := range report.Checks {
+		got[c.Name] = c
+	}
+	want := map[string]checkStatus{
+		"settings":             checkOK,
+		"yt-dlp":               checkOK,
+		"yt-dlp --js-runtimes": checkOK,
+		"node":                 checkOK,
+		"deno":                 checkSkip,
+		"js runtime":           checkOK,
+		"ffmpeg":               checkOK,
+		"ffprobe":              checkWarn,
+		"biliup":               checkSkip,
+		"bilibili cookie":      checkOK,
+		"douyin cookie":        checkWarn,
+		"douyin:alt cookie":    checkWarn,
+		"output dir":           checkWarn,
+		"database":             checkWarn,
+	}
+	for name, status := range want {
+		if got[name].Status != status {
+			t.Errorf("%s: status %q (%s), want %q", name, got[name].Status, got[name].Detail, status)
+		}
+	}
+	if !report.OK {
+		t.Error("expected ok report")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "downloads")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("doctor created the output directory: %v", err)
+	}
+	if !strings.HasPrefix(got["ffmpeg"].Detail, "6.1.1-3ubuntu5 ") || !strings.HasPrefix(got["node"].Detail, "v20.11.1 ") {
+		t.Errorf("unexpected versions: ffmpeg %q, node %q", got["ffmpeg"].Detail, got["node"].Detail)
+	}
+}
+
+func TestRunDoctorReportsFailures(t *testing.T) {
+	stubDoctor(t, fakeTools{
+		"yt-dlp --version": "2023.03.04\n",
+		"yt-dlp --help":    "Usage: yt-dlp [OPTIONS] URL\n",
+	})
+	dir := t.TempDir()
+	db := filepath.Join(dir, "metadata.db")
+	store, err := app.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	var out bytes.Buffer
+	err = runDoctor(context.Background(), []string{
+		"--output", filepath.Join(dir, "downloads"),
+		"--db-path", db,
+		"--bilibili-client", "biliup",
+		"--js-runtime", "node",
+		"--biliup-cookie", writeCookie(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)),
+	}, &out)
+	if err == nil || !strings.Contains(err.Error(), "4 of") {
+		t.Fatalf("expected four failed checks, got %v\n%s", err, out.String())
+	}
+	table := out.String()
+	for _, want := range []string{
+		"older than six months",
+		"not supported but --js-runtime is node",
+		"session expired 2024-12-01",
+		"biliup not found in PATH",
+		"schema is current",
+	} {
+		if !strings.Contains(table, want) {
+			t.Errorf("expected %q in doctor output:\n%s", want, table)
+		}
+	}
+}
+
+func TestParseToolVersion(t *testing.T) {
+	tests := map[string][2]string{
+		"ffmpeg version n7.0 Copyright (c) 2000-2024":  {"ffmpeg", "n7.0"},
+		"deno 1.46.3 (stable, release, x86_64)\nv8 12": {"deno", "1.46.3"},
+		"biliup 0.2.2":          {"biliup", "0.2.2"},
+		"2024.08.06\n":          {"yt-dlp", "2024.08.06"},
+		"v22.3.0":               {"node", "v22.3.0"},
+		"ffprobe version 6.0-6": {"ffprobe", "6.0-6"},
+	}
+	for out, tt := range tests {
+		if got := parseToolVersion(tt[0], out); got != tt[1] {
+			t.Errorf("parseToolVersion(%q, %q) = %q, want %q", tt[0], out, got, tt[1])
+		}
+	}
+}
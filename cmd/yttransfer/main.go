@@ -8,8 +8,12 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"great_transport/internal/app"
@@ -23,54 +27,173 @@ var (
 )
 
 type config struct {
-	channelID    string
-	videoID      string
-	platform     string
-	outputDir    string
-	dbPath       string
-	httpAddr     string
-	limit        int
-	sleepSeconds int
-	jsRuntime    string
-	format       string
-	biliupBinary string
-	biliupCookie string
-	biliupLine   string
-	biliupLimit  int
-	biliupTags   string
-	biliupTitle  string
-	biliupDesc   string
-	biliupDynamic string
-}
-
-type dummyUploader struct {
-	platform string
-}
-
-func (u dummyUploader) Upload(path string) error {
-	log.Printf("stub upload to %s: %s", u.platform, path)
-	return nil
+	configPath     string
+	channels       []app.Subscription
+	channelID      string
+	videoID        string
+	platform       string
+	outputDir      string
+	dbPath         string
+	httpAddr       string
+	watchPath      string
+	watchSubs      bool
+	websubCallback string
+	websubSecret   string
+	websubHub      string
+	websubLease    time.Duration
+	limit          int
+	sleepSeconds   int
+	downloadJobs   int
+	uploadJobs     int
+	unordered      bool
+	retryAttempts  int
+	retryBackoff   time.Duration
+	retryMaxDelay  time.Duration
+	retryJitter    float64
+	deadLetterMax  int
+	jsRuntime      string
+	format         string
+	coverAspect    string
+	coverWidth     int
+	subtitleMode   string
+	subtitleLangs  string
+	subtitleAuto   bool
+	subtitleFormat string
+	metaTags       string
+	metaTitle      string
+	metaTitleTpl   string
+	metaDesc       string
+	bilibiliClient string
+	biliupBinary   string
+	biliupCookie   string
+	biliupLine     string
+	biliupLimit    int
+	biliupTags     string
+	biliupTitle    string
+	biliupTitleTpl string
+	biliupDesc     string
+	biliupDynamic  string
+	douyinCookie   string
+	douyinLimit    int
+	douyinVisible  string
+	douyinPublish  string
+	xhsCookie      string
+	xhsLimit       int
+	xhsPrivate     bool
+	kuaishouCookie string
+	kuaishouLimit  int
+	xiguaCookie    string
+	xiguaLimit     int
 }
 
+// subscriptionJitter spreads scheduled subscription syncs that share a
+// schedule over a few minutes.
+const subscriptionJitter = 2 * time.Minute
+
 func main() {
 	log.SetFlags(0)
 
+	if len(os.Args) > 1 {
+		if cmd, ok := lookupCommand(os.Args[1]); ok {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			err := cmd.run(ctx, os.Args[2:], os.Stdout)
+			stop()
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		}
+		if isHelpArg(os.Args[1]) {
+			printUsage(os.Stdout)
+			return
+		}
+	}
+	if len(os.Args) == 1 {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+
+	// Flags without a subcommand are the original interface, kept as an
+	// alias for sync and serve.
 	cfg, err := parseFlags()
 	if err != nil {
 		log.Fatal(err)
 	}
+	ctx := context.Background()
+	err = withController(ctx, cfg, func(controller *app.Controller) error {
+		switch {
+		case cfg.watchPath != "" || cfg.watchSubs || cfg.httpAddr != "":
+			return serve(ctx, cfg, controller)
+		case cfg.channelID != "":
+			return syncChannel(ctx, controller, cfg.channelID, cfg.limit)
+		default:
+			return controller.SyncVideo(ctx, cfg.videoID)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	if _, err := app.LookPath("yt-dlp"); err != nil {
-		log.Fatal("yt-dlp not found in PATH; install it first (see README for Docker setup)")
+// openStore opens the metadata database for a sync, applies pending
+// migrations and the config file's per-channel overrides.
+func openStore(ctx context.Context, cfg config) (app.Store, error) {
+	store, err := app.OpenStore(cfg.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.EnsureSchema(ctx); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if err := syncConfigChannels(ctx, store, cfg.channels); err != nil {
+		store.Close()
+		return nil, err
+	}
+	log.Println("Initialized database")
+	return store, nil
+}
+
+// openExistingStore opens the metadata database for commands that only
+// look at or edit what syncs recorded. Like `migrate status`, it neither
+// creates nor migrates the database and leaves subscriptions alone.
+func openExistingStore(ctx context.Context, location string) (app.Store, error) {
+	if !app.IsPostgresURL(location) {
+		if _, err := os.Stat(location); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s does not exist yet; it is created on the first sync", location)
+		}
+	}
+	store, err := app.OpenStore(location)
+	if err != nil {
+		return nil, err
+	}
+	status, err := store.SchemaStatus(ctx)
+	switch {
+	case err != nil:
+	case status.Current > status.Latest:
+		err = fmt.Errorf("%w: upgrade yttransfer before using this database", app.ErrSchemaTooNew)
+	case len(status.Pending()) > 0:
+		err = fmt.Errorf("%s is at schema version %d; run `yttransfer migrate up` first", location, status.Current)
+	}
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
+	return store, nil
+}
 
+// newController checks the external tools and wires the downloader and
+// uploader selected by cfg.
+func newController(cfg config, store app.Store) (*app.Controller, error) {
+	if _, err := app.LookPath("yt-dlp"); err != nil {
+		return nil, errors.New("yt-dlp not found in PATH; install it first (see README for Docker setup)")
+	}
 	if err := os.MkdirAll(cfg.outputDir, 0o755); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
 	jsRuntime, jsWarn, err := resolveDesiredJSRuntime(cfg.jsRuntime)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	if jsWarn != "" {
 		log.Println(jsWarn)
@@ -80,72 +203,362 @@ func main() {
 		log.Println(warn)
 	}
 
-	ctx := context.Background()
-	store, err := app.NewSQLiteStore(cfg.dbPath)
+	downloader := app.NewYtDlpDownloader(app.ExecRunner{}, time.Duration(cfg.sleepSeconds)*time.Second, subtitleOptionsFromConfig(cfg))
+	destinations, err := newDestinations(cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	if err := store.EnsureSchema(ctx); err != nil {
-		log.Fatal(err)
+	controller := &app.Controller{
+		Downloader:         downloader,
+		Destinations:       destinations,
+		ResolveDestination: destinationResolver(cfg),
+		Store:              store,
+		OutputDir:          cfg.outputDir,
+		JSRuntime:          jsRuntime,
+		Format:             format,
+		Cover:              app.CoverOptions{AspectRatio: cfg.coverAspect, Width: cfg.coverWidth},
+		Subtitles:          subtitleOptionsFromConfig(cfg),
+		Pipeline: app.PipelineOptions{
+			Downloads: cfg.downloadJobs,
+			Uploads:   cfg.uploadJobs,
+			Unordered: cfg.unordered,
+		},
+		Retry: app.RetryPolicy{
+			MaxAttempts:     cfg.retryAttempts,
+			BaseDelay:       cfg.retryBackoff,
+			MaxDelay:        cfg.retryMaxDelay,
+			Jitter:          cfg.retryJitter,
+			DeadLetterAfter: cfg.deadLetterMax,
+		},
 	}
-	log.Println("Initialized database")
+	log.Println("Initialized controller")
+	return controller, nil
+}
 
-	downloader := app.NewYtDlpDownloader(time.Duration(cfg.sleepSeconds) * time.Second)
-	uploader, err := newUploaderFromConfig(cfg)
+// syncChannel syncs one channel and logs every failed video.
+func syncChannel(ctx context.Context, controller *app.Controller, channelID string, limit int) error {
+	log.Println("Handling downloading")
+	res, err := controller.SyncChannel(ctx, channelID, limit)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	controller := &app.Controller{
-		Downloader: downloader,
-		Uploader:   uploader,
-		Store:      store,
-		OutputDir:  cfg.outputDir,
-		JSRuntime:  jsRuntime,
-		Format:     format,
+	if res.Failed > 0 {
+		for _, v := range res.Videos {
+			if v.Error != "" {
+				log.Printf("%s failed (action: %s): %s", v.VideoID, v.Action, v.Error)
+			}
+		}
+		return fmt.Errorf("%d of %d videos failed (%d dead-lettered)", res.Failed, res.Considered, res.DeadLettered)
 	}
-	log.Println("Initialized controller")
+	return nil
+}
 
+// serve runs the HTTP controller, the watcher or both until ctx is
+// cancelled or the server fails.
+func serve(ctx context.Context, cfg config, controller *app.Controller) error {
+	if cfg.watchPath == "" && !cfg.watchSubs {
+		return app.ServeHTTP(cfg.httpAddr, controller, websubOptionsFromConfig(cfg))
+	}
+	var entries []app.WatchEntry
+	if cfg.watchPath != "" {
+		var err error
+		entries, err = app.LoadWatchList(cfg.watchPath)
+		if err != nil {
+			return err
+		}
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// A failing HTTP server stops the watcher through ctx, so a running
+	// sync is cancelled cleanly and the store is still closed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	serveErr := make(chan error, 1)
 	if cfg.httpAddr != "" {
-		if err := app.ServeHTTP(cfg.httpAddr, controller); err != nil {
-			log.Fatal(err)
+		go func() {
+			serveErr <- app.ServeHTTP(cfg.httpAddr, controller, websubOptionsFromConfig(cfg))
+			cancel()
+		}()
+	}
+	if cfg.watchPath != "" {
+		log.Printf("Watching %d channels from %s", len(entries), cfg.watchPath)
+	}
+	if cfg.watchSubs {
+		log.Println("Watching scheduled subscriptions")
+	}
+	watcher := &app.Watcher{
+		Controller:    controller,
+		Entries:       entries,
+		Subscriptions: cfg.watchSubs,
+		Jitter:        subscriptionJitter,
+	}
+	err := watcher.Run(ctx)
+	select {
+	case serr := <-serveErr:
+		return fmt.Errorf("http server: %w", serr)
+	default:
+		return err
+	}
+}
+
+// supportedPlatforms are the values --platform and subscription platforms
+// accept.
+var supportedPlatforms = []string{"bilibili", "douyin", "kuaishou", "xiaohongshu", "xigua"}
+
+// platformAliases are older or shorter platform names.
+var platformAliases = map[string]string{"tiktok": "douyin", "xhs": "xiaohongshu"}
+
+// validatePlatforms checks a list of destinations, "platform" or
+// "platform:account", normalising the platform names to lower case.
+func validatePlatforms(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		platform, account := splitDestination(strings.ToLower(strings.TrimSpace(name)))
+		if alias, ok := platformAliases[platform]; ok {
+			platform = alias
+		}
+		if !slices.Contains(supportedPlatforms, platform) {
+			return nil, fmt.Errorf("unsupported platform %q (want %s)", platform, strings.Join(supportedPlatforms, ", "))
+		}
+		if strings.Contains(name, ":") && !validAccount(account) {
+			return nil, fmt.Errorf("platform %q: account names use letters, digits, - and _", name)
 		}
-		log.Println("Server is initialized")
-		return
+		name = app.Destination{Platform: platform, Account: account}.String()
+		if seen[name] {
+			return nil, fmt.Errorf("platform %q listed twice", name)
+		}
+		seen[name] = true
+		out = append(out, name)
 	}
+	return out, nil
+}
 
-	log.Println("Handling downloading")
-	switch {
-	case cfg.channelID != "":
-		if _, err := controller.SyncChannel(ctx, cfg.channelID, cfg.limit); err != nil {
-			log.Fatal(err)
+// splitDestination splits "platform:account" into its parts; the account
+// is "" for a bare platform.
+func splitDestination(name string) (platform, account string) {
+	platform, account, _ = strings.Cut(name, ":")
+	return platform, account
+}
+
+func validAccount(account string) bool {
+	if account == "" {
+		return false
+	}
+	for _, r := range account {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
 		}
-	case cfg.videoID != "":
-		if err := controller.SyncVideo(ctx, cfg.videoID); err != nil {
-			log.Fatal(err)
+	}
+	return true
+}
+
+// accountCookiePath returns the cookie file of an account: path itself for
+// the default account, otherwise path with the account before its
+// extension (douyin_cookies.json becomes douyin_cookies.alt.json).
+func accountCookiePath(path, account string) string {
+	if account == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + account + ext
+}
+
+// newDestinations builds one destination per --platform entry.
+func newDestinations(cfg config) ([]app.Destination, error) {
+	var dests []app.Destination
+	for _, name := range parseCSVList(cfg.platform) {
+		dest, err := newDestination(cfg, name)
+		if err != nil {
+			return nil, err
 		}
-	default:
-		log.Fatal("no channel or video provided; use --http-addr for server mode")
+		dests = append(dests, dest)
 	}
+	return dests, nil
 }
 
-func newUploaderFromConfig(cfg config) (app.Uploader, error) {
-	switch cfg.platform {
+// destinationResolver builds uploaders for subscription platforms that
+// --platform does not cover, once per destination.
+func destinationResolver(cfg config) func(string) (app.Destination, error) {
+	var mu sync.Mutex
+	built := make(map[string]app.Destination)
+	return func(name string) (app.Destination, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if dest, ok := built[name]; ok {
+			return dest, nil
+		}
+		dest, err := newDestination(cfg, name)
+		if err != nil {
+			return app.Destination{}, err
+		}
+		built[name] = dest
+		return dest, nil
+	}
+}
+
+// newDestination builds the uploader for "platform" or "platform:account".
+func newDestination(cfg config, name string) (app.Destination, error) {
+	platform, account := splitDestination(name)
+	uploader, err := newUploaderFromConfig(cfg, platform, account)
+	if err != nil {
+		return app.Destination{}, err
+	}
+	return app.Destination{Platform: platform, Account: account, Uploader: uploader}, nil
+}
+
+// newUploaderFromConfig builds the uploader of one platform account; see
+// accountCookiePath for where each account's cookies are read from.
+func newUploaderFromConfig(cfg config, platform, account string) (app.Uploader, error) {
+	templates := metadataTemplatesFromConfig(cfg, platform)
+	if err := templates.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s metadata template: %w", platform, err)
+	}
+	switch platform {
 	case "bilibili":
+		if cfg.bilibiliClient == "native" {
+			return app.NewBilibiliUploader(app.BilibiliUploaderOptions{
+				CookiePath: accountCookiePath(cfg.biliupCookie, account),
+				Line:       cfg.biliupLine,
+				Limit:      cfg.biliupLimit,
+				Templates:  templates,
+			}), nil
+		}
 		opts := app.BiliupUploaderOptions{
-			Binary:      cfg.biliupBinary,
-			CookiePath:  cfg.biliupCookie,
-			Line:        cfg.biliupLine,
-			Limit:       cfg.biliupLimit,
-			TitlePrefix: cfg.biliupTitle,
-			Description: cfg.biliupDesc,
-			Dynamic:     cfg.biliupDynamic,
-			Tags:        parseCSVList(cfg.biliupTags),
+			Binary:     cfg.biliupBinary,
+			CookiePath: accountCookiePath(cfg.biliupCookie, account),
+			Line:       cfg.biliupLine,
+			Limit:      cfg.biliupLimit,
+			Templates:  templates,
 		}
 		return app.NewBiliupUploader(opts), nil
-	case "tiktok":
-		return dummyUploader{platform: cfg.platform}, nil
+	case "douyin":
+		visibility, err := app.ParseDouyinVisibility(cfg.douyinVisible)
+		if err != nil {
+			return nil, err
+		}
+		publishAt, publishDelay, err := parsePublishTime(cfg.douyinPublish)
+		if err != nil {
+			return nil, fmt.Errorf("--douyin-publish-at: %w", err)
+		}
+		return app.NewDouyinUploader(app.DouyinUploaderOptions{
+			CookiePath:   accountCookiePath(cfg.douyinCookie, account),
+			Limit:        cfg.douyinLimit,
+			Visibility:   visibility,
+			PublishAt:    publishAt,
+			PublishDelay: publishDelay,
+			Templates:    templates,
+		}), nil
+	case "xiaohongshu":
+		return app.NewXiaohongshuUploader(app.XiaohongshuUploaderOptions{
+			CookiePath: accountCookiePath(cfg.xhsCookie, account),
+			Limit:      cfg.xhsLimit,
+			Private:    cfg.xhsPrivate,
+			Templates:  templates,
+		}), nil
+	case "kuaishou":
+		return app.NewKuaishouUploader(app.KuaishouUploaderOptions{
+			CookiePath: accountCookiePath(cfg.kuaishouCookie, account),
+			Limit:      cfg.kuaishouLimit,
+			Templates:  templates,
+		}), nil
+	case "xigua":
+		return app.NewXiguaUploader(app.XiguaUploaderOptions{
+			CookiePath: accountCookiePath(cfg.xiguaCookie, account),
+			Limit:      cfg.xiguaLimit,
+			Templates:  templates,
+		}), nil
 	default:
-		return nil, fmt.Errorf("unsupported platform: %s", cfg.platform)
+		return nil, fmt.Errorf("unsupported platform: %s", platform)
+	}
+}
+
+// parsePublishTime reads a scheduled publish time: an RFC 3339 timestamp,
+// or a duration such as 3h that delays each post by that much.
+func parsePublishTime(value string) (time.Time, time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, 0, nil
+	}
+	if delay, err := time.ParseDuration(value); err == nil {
+		if delay <= 0 {
+			return time.Time{}, 0, errors.New("delay must be positive")
+		}
+		return time.Time{}, delay, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+	return at, 0, nil
+}
+
+// validatePublishTime checks that the scheduled publish time is one Douyin
+// accepts. A fixed time would schedule every video of a channel for the
+// same moment and fall out of the window as the server keeps running, so
+// channel syncs and serve only take a delay.
+func validatePublishTime(cfg config) error {
+	at, delay, err := parsePublishTime(cfg.douyinPublish)
+	switch {
+	case err != nil:
+		return err
+	case delay > 0:
+		return app.CheckDouyinSchedule(delay)
+	case at.IsZero():
+		return nil
+	case cfg.channelID != "" || cfg.httpAddr != "" || cfg.watchPath != "" || cfg.watchSubs:
+		return errors.New("a fixed time only works for single videos; use a delay such as 3h for channels and serve")
+	}
+	return app.CheckDouyinSchedule(time.Until(at))
+}
+
+// metadataTemplatesFromConfig maps the --metadata-* flags onto templates
+// for platform; on Bilibili each --biliup-* flag that is set overrides its
+// --metadata-* counterpart. The title prefix is kept as a separate flag for
+// convenience and simply prepended to the title template.
+func metadataTemplatesFromConfig(cfg config, platform string) app.MetadataTemplates {
+	prefix, title := cfg.metaTitle, cfg.metaTitleTpl
+	templates := app.MetadataTemplates{Description: cfg.metaDesc, Tags: cfg.metaTags}
+	if platform == "bilibili" {
+		if cfg.biliupTitle != "" {
+			prefix = cfg.biliupTitle
+		}
+		if strings.TrimSpace(cfg.biliupTitleTpl) != "" {
+			title = cfg.biliupTitleTpl
+		}
+		templates = templates.Override(app.MetadataTemplates{
+			Description: cfg.biliupDesc,
+			Dynamic:     cfg.biliupDynamic,
+			Tags:        cfg.biliupTags,
+		})
+	}
+	if strings.TrimSpace(title) == "" {
+		title = app.DefaultTitleTemplate
+	}
+	templates.Title = prefix + title
+	return templates
+}
+
+// websubOptionsFromConfig returns nil unless --websub-callback enables
+// push notifications.
+func websubOptionsFromConfig(cfg config) *app.WebSubOptions {
+	if cfg.websubCallback == "" {
+		return nil
+	}
+	return &app.WebSubOptions{
+		HubURL:      cfg.websubHub,
+		CallbackURL: cfg.websubCallback,
+		Secret:      cfg.websubSecret,
+		Lease:       cfg.websubLease,
+	}
+}
+
+func subtitleOptionsFromConfig(cfg config) app.SubtitleOptions {
+	return app.SubtitleOptions{
+		Mode:      app.SubtitleMode(cfg.subtitleMode),
+		Languages: parseCSVList(cfg.subtitleLangs),
+		Auto:      cfg.subtitleAuto,
+		Format:    cfg.subtitleFormat,
 	}
 }
 
@@ -166,50 +579,210 @@ func parseFlags() (config, error) {
 }
 
 func parseFlagsFrom(fs *flag.FlagSet, args []string) (config, error) {
+	cfg, sources, err := resolveFlags(fs, args)
+	if err != nil {
+		return cfg, err
+	}
+	if err := sources.annotate(validateMode(cfg)); err != nil {
+		return cfg, err
+	}
+	if err := sources.annotate(validateValues(&cfg)); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// resolveFlags registers the flags of the original single-command
+// interface, parses args and fills every flag not given on the command
+// line from the YTTRANSFER_* environment variables or the config file.
+func resolveFlags(fs *flag.FlagSet, args []string) (config, configSources, error) {
 	var cfg config
 	fs.StringVar(&cfg.channelID, "channel-id", "", "YouTube channel ID or URL")
 	fs.StringVar(&cfg.videoID, "video-id", "", "YouTube video ID or URL")
-	fs.StringVar(&cfg.platform, "platform", "bilibili", "target platform (bilibili or tiktok)")
+	addStoreFlags(fs, &cfg)
+	addPipelineFlags(fs, &cfg)
+	addServeFlags(fs, &cfg, "")
+	sources, err := parseWithConfig(fs, &cfg, args)
+	return cfg, sources, err
+}
+
+// parseWithConfig parses args into the flags already registered on fs and
+// then applies the environment and the config file to the rest.
+func parseWithConfig(fs *flag.FlagSet, cfg *config, args []string) (configSources, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if cfg.configPath == "" {
+		cfg.configPath = os.Getenv(configEnvVar)
+	}
+	var file *configFile
+	if cfg.configPath != "" {
+		var err error
+		if file, err = loadConfigFile(cfg.configPath); err != nil {
+			return nil, err
+		}
+		cfg.channels = file.channels
+	}
+	return applyConfigSources(fs, file, os.LookupEnv)
+}
+
+// addStoreFlags registers the flags of every command that opens the
+// metadata database.
+func addStoreFlags(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&cfg.configPath, "config", "", "YAML config file (also "+configEnvVar+"); flags override environment variables, which override the file")
+	fs.StringVar(&cfg.dbPath, "db-path", "metadata.db", "path to sqlite metadata database or postgres:// URL")
+}
+
+// addPipelineFlags registers the download and upload settings.
+func addPipelineFlags(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&cfg.platform, "platform", "bilibili", "comma-separated target platforms (bilibili, douyin, kuaishou, xiaohongshu, xigua), optionally as platform:account; each video is uploaded to all of them")
 	fs.StringVar(&cfg.outputDir, "output", "downloads", "output directory")
-	fs.StringVar(&cfg.dbPath, "db-path", "metadata.db", "path to sqlite metadata database")
-	fs.StringVar(&cfg.httpAddr, "http-addr", "", "HTTP listen address (enables controller server mode)")
 	fs.IntVar(&cfg.limit, "limit", 5, "max videos to download for channel")
 	fs.IntVar(&cfg.sleepSeconds, "sleep-seconds", 5, "sleep seconds between downloads")
+	fs.IntVar(&cfg.downloadJobs, "download-workers", 1, "videos downloaded concurrently during channel syncs")
+	fs.IntVar(&cfg.uploadJobs, "upload-workers", 1, "videos uploaded concurrently during channel syncs")
+	fs.BoolVar(&cfg.unordered, "unordered", false, "upload videos as soon as they are downloaded instead of in channel order")
+	fs.IntVar(&cfg.retryAttempts, "retry-attempts", 3, "tries per download/upload before a video counts as failed for this sync")
+	fs.DurationVar(&cfg.retryBackoff, "retry-backoff", 10*time.Second, "delay before the first retry; doubles on each further retry")
+	fs.DurationVar(&cfg.retryMaxDelay, "retry-max-backoff", 5*time.Minute, "upper bound for the retry delay")
+	fs.Float64Var(&cfg.retryJitter, "retry-jitter", 0.2, "randomise retry delays by up to this fraction (0-1)")
+	fs.IntVar(&cfg.deadLetterMax, "dead-letter-after", 10, "dead-letter a video after this many attempts across syncs (0 = only on permanent errors)")
 	fs.StringVar(&cfg.jsRuntime, "js-runtime", "auto", "JS runtime passed to yt-dlp (auto,node,deno,...)")
 	fs.StringVar(&cfg.format, "format", "auto", "yt-dlp format selector (auto prefers mp4 when available)")
-	fs.StringVar(&cfg.biliupBinary, "biliup-binary", "biliup", "path to biliup CLI binary")
+	fs.StringVar(&cfg.coverAspect, "cover-aspect", "", "center-crop the thumbnail cover to this W:H ratio (e.g. 16:10; requires ffmpeg)")
+	fs.IntVar(&cfg.coverWidth, "cover-width", 0, "scale the cover to this width in pixels (0 keeps the thumbnail size)")
+	fs.StringVar(&cfg.subtitleMode, "subtitle-mode", "none", "subtitle publishing: none, burn (hardcode into the video; requires ffmpeg) or cc (Bilibili CC subtitles)")
+	fs.StringVar(&cfg.subtitleLangs, "subtitle-langs", "zh-Hans,zh.*,en", "comma-separated subtitle languages in preference order (yt-dlp --sub-langs syntax)")
+	fs.BoolVar(&cfg.subtitleAuto, "subtitle-auto", false, "fall back to YouTube's auto-generated subtitles")
+	fs.StringVar(&cfg.subtitleFormat, "subtitle-format", "srt", "subtitle file format to convert to (srt or ass)")
+	fs.StringVar(&cfg.metaTags, "metadata-tags", "", "comma-separated tag template for every platform (text/template; default: the original video's tags)")
+	fs.StringVar(&cfg.metaTitle, "metadata-title-prefix", "", "prefix prepended to the rendered title template on every platform")
+	fs.StringVar(&cfg.metaTitleTpl, "metadata-title", "", "title template for every platform (text/template; default {{.Title}})")
+	fs.StringVar(&cfg.metaDesc, "metadata-desc", "", "description template for every platform (text/template; default: original description plus source link)")
+	fs.StringVar(&cfg.bilibiliClient, "bilibili-client", "native", "Bilibili upload client: native (built-in API client) or biliup (external CLI)")
+	fs.StringVar(&cfg.biliupBinary, "biliup-binary", "biliup", "path to biliup CLI binary (only used with --bilibili-client biliup)")
 	fs.StringVar(&cfg.biliupCookie, "biliup-cookie", "cookies.json", "path to biliup cookies.json (created after `biliup login`)")
 	fs.StringVar(&cfg.biliupLine, "biliup-line", "", "optional biliup upload line override (ws/qn/bda2/...)")
 	fs.IntVar(&cfg.biliupLimit, "biliup-limit", 3, "per-file biliup upload concurrency limit")
-	fs.StringVar(&cfg.biliupTags, "biliup-tags", "", "comma-separated biliup tags")
-	fs.StringVar(&cfg.biliupTitle, "biliup-title-prefix", "", "prefix prepended to derived biliup video titles")
-	fs.StringVar(&cfg.biliupDesc, "biliup-desc", "Uploaded via yt-transfer", "description text template for biliup uploads")
-	fs.StringVar(&cfg.biliupDynamic, "biliup-dynamic", "", "dynamic/status text for biliup uploads (defaults to description)")
-	if err := fs.Parse(args); err != nil {
-		return cfg, err
-	}
+	fs.StringVar(&cfg.biliupTags, "biliup-tags", "", "Bilibili tag template overriding --metadata-tags")
+	fs.StringVar(&cfg.biliupTitle, "biliup-title-prefix", "", "Bilibili title prefix overriding --metadata-title-prefix")
+	fs.StringVar(&cfg.biliupTitleTpl, "biliup-title", "", "Bilibili title template overriding --metadata-title")
+	fs.StringVar(&cfg.biliupDesc, "biliup-desc", "", "Bilibili description template overriding --metadata-desc")
+	fs.StringVar(&cfg.biliupDynamic, "biliup-dynamic", "", "dynamic/status template (defaults to the rendered description)")
+	fs.StringVar(&cfg.douyinCookie, "douyin-cookie", "douyin_cookies.json", "cookie export (JSON or cookies.txt) of a logged-in creator.douyin.com session")
+	fs.IntVar(&cfg.douyinLimit, "douyin-limit", 3, "per-file Douyin chunk upload concurrency limit")
+	fs.StringVar(&cfg.douyinVisible, "douyin-visibility", "public", "who can see Douyin posts: public, friends or private")
+	fs.StringVar(&cfg.douyinPublish, "douyin-publish-at", "", "schedule Douyin posts: a delay after upload such as 3h, or an RFC 3339 time for single videos (2h to 14 days ahead)")
+	fs.StringVar(&cfg.xhsCookie, "xiaohongshu-cookie", "xiaohongshu_cookies.json", "cookie export (JSON or cookies.txt) of a logged-in creator.xiaohongshu.com session")
+	fs.IntVar(&cfg.xhsLimit, "xiaohongshu-limit", 3, "per-file Xiaohongshu chunk upload concurrency limit")
+	fs.BoolVar(&cfg.xhsPrivate, "xiaohongshu-private", false, "publish Xiaohongshu notes visible only to the account")
+	fs.StringVar(&cfg.kuaishouCookie, "kuaishou-cookie", "kuaishou_cookies.json", "cookie export (JSON or cookies.txt) of a logged-in cp.kuaishou.com session")
+	fs.IntVar(&cfg.kuaishouLimit, "kuaishou-limit", 3, "per-file Kuaishou fragment upload concurrency limit")
+	fs.StringVar(&cfg.xiguaCookie, "xigua-cookie", "xigua_cookies.json", "cookie export (JSON or cookies.txt) of a logged-in studio.ixigua.com session")
+	fs.IntVar(&cfg.xiguaLimit, "xigua-limit", 3, "per-file Xigua chunk upload concurrency limit")
+}
 
-	if cfg.httpAddr == "" && cfg.channelID == "" && cfg.videoID == "" {
-		return cfg, errors.New("provide either --channel-id or --video-id")
+// addServeFlags registers the HTTP server, watch mode and WebSub settings.
+func addServeFlags(fs *flag.FlagSet, cfg *config, defaultAddr string) {
+	fs.StringVar(&cfg.httpAddr, "http-addr", defaultAddr, "HTTP listen address (enables controller server mode)")
+	fs.StringVar(&cfg.watchPath, "watch", "", "JSON file of channels to sync on a schedule (runs until interrupted; combine with --http-addr to serve as well)")
+	fs.BoolVar(&cfg.watchSubs, "watch-subscriptions", false, "sync enabled subscriptions on their schedules (managed with the subscriptions subcommand)")
+	fs.StringVar(&cfg.websubCallback, "websub-callback", "", "public URL of this server's /websub endpoint; subscribes enabled subscriptions to YouTube push notifications (needs --http-addr)")
+	fs.StringVar(&cfg.websubSecret, "websub-secret", "", "shared secret the hub signs push notifications with (required with --websub-callback)")
+	fs.StringVar(&cfg.websubHub, "websub-hub", app.DefaultWebSubHub, "WebSub hub to subscribe at")
+	fs.DurationVar(&cfg.websubLease, "websub-lease", 5*24*time.Hour, "requested lease per hub subscription; renewed a day before it expires")
+}
+
+// validateMode checks that the flags select exactly one way of running.
+func validateMode(cfg config) error {
+	watching := cfg.watchPath != "" || cfg.watchSubs
+	if watching && (cfg.channelID != "" || cfg.videoID != "") {
+		return errors.New("--watch cannot be combined with --channel-id or --video-id")
+	}
+	if cfg.httpAddr == "" && !watching && cfg.channelID == "" && cfg.videoID == "" {
+		return errors.New("nothing to do: use `yttransfer sync channel ID`, `yttransfer sync video ID` or `yttransfer serve` (see `yttransfer help`)")
 	}
 	if cfg.httpAddr == "" && cfg.channelID != "" && cfg.videoID != "" {
-		return cfg, errors.New("provide only one of --channel-id or --video-id")
+		return errors.New("provide only one of --channel-id or --video-id")
+	}
+	return validateWebSub(cfg)
+}
+
+func validateWebSub(cfg config) error {
+	if cfg.websubCallback != "" {
+		if cfg.httpAddr == "" {
+			return errors.New("--websub-callback requires --http-addr")
+		}
+		if err := websubOptionsFromConfig(cfg).Validate(); err != nil {
+			return fmt.Errorf("--websub-*: %w", err)
+		}
 	}
+	return nil
+}
+
+// validateValues checks and normalises the remaining settings.
+func validateValues(cfg *config) error {
 	if cfg.channelID != "" && cfg.limit <= 0 {
-		return cfg, errors.New("--limit must be > 0 for channel downloads")
+		return errors.New("--limit must be > 0 for channel downloads")
 	}
 	if cfg.sleepSeconds < 0 {
-		return cfg, errors.New("--sleep-seconds must be >= 0")
+		return errors.New("--sleep-seconds must be >= 0")
+	}
+	if cfg.downloadJobs <= 0 || cfg.uploadJobs <= 0 {
+		return errors.New("--download-workers and --upload-workers must be > 0")
+	}
+	if cfg.retryAttempts <= 0 || cfg.retryBackoff < 0 || cfg.retryMaxDelay < 0 || cfg.deadLetterMax < 0 {
+		return errors.New("--retry-attempts must be > 0 and retry delays and --dead-letter-after must be >= 0")
+	}
+	if cfg.retryJitter < 0 || cfg.retryJitter > 1 {
+		return errors.New("--retry-jitter must be between 0 and 1")
 	}
 
-	cfg.platform = strings.ToLower(strings.TrimSpace(cfg.platform))
-	switch cfg.platform {
-	case "bilibili", "tiktok":
+	if err := (app.CoverOptions{AspectRatio: cfg.coverAspect, Width: cfg.coverWidth}).Validate(); err != nil {
+		return err
+	}
+
+	cfg.subtitleMode = strings.ToLower(strings.TrimSpace(cfg.subtitleMode))
+	cfg.subtitleFormat = strings.ToLower(strings.TrimSpace(cfg.subtitleFormat))
+	if err := subtitleOptionsFromConfig(*cfg).Validate(); err != nil {
+		return fmt.Errorf("--subtitle-*: %w", err)
+	}
+
+	cfg.bilibiliClient = strings.ToLower(strings.TrimSpace(cfg.bilibiliClient))
+	switch cfg.bilibiliClient {
+	case "native", "biliup":
 	default:
-		return cfg, errors.New("--platform must be bilibili or tiktok")
+		return errors.New("--bilibili-client must be native or biliup")
 	}
 
-	return cfg, nil
+	platforms, err := validatePlatforms(parseCSVList(cfg.platform))
+	if err != nil {
+		return fmt.Errorf("--platform: %w", err)
+	}
+	if len(platforms) == 0 {
+		return errors.New("--platform needs at least one platform")
+	}
+	cfg.platform = strings.Join(platforms, ",")
+	if _, err := app.ParseDouyinVisibility(cfg.douyinVisible); err != nil {
+		return fmt.Errorf("--douyin-visibility: %w", err)
+	}
+	if err := validatePublishTime(*cfg); err != nil {
+		return fmt.Errorf("--douyin-publish-at: %w", err)
+	}
+
+	for i := range cfg.channels {
+		sub := &cfg.channels[i]
+		if sub.Limit == 0 {
+			sub.Limit = cfg.limit
+		}
+		if err := sub.Validate(); err != nil {
+			return fmt.Errorf("%s: channels.%s: %w", cfg.configPath, sub.ChannelID, err)
+		}
+		if sub.Platforms, err = validatePlatforms(sub.Platforms); err != nil {
+			return fmt.Errorf("%s: channels.%s: %w", cfg.configPath, sub.ChannelID, err)
+		}
+	}
+	return nil
 }
 
 func resolveDesiredJSRuntime(pref string) (string, string, error) {
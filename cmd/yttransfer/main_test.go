@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"great_transport/internal/app"
 )
@@ -22,74 +27,194 @@ func TestParseFlagsFrom(t *testing.T) {
 			name: "video defaults",
 			args: []string{"--video-id", "abc123"},
 			want: config{
-				videoID:       "abc123",
-				platform:      "bilibili",
-				outputDir:     "downloads",
-				dbPath:        "metadata.db",
-				httpAddr:      "",
-				limit:         5,
-				sleepSeconds:  5,
-				jsRuntime:     "auto",
-				format:        "auto",
-				biliupBinary:  "biliup",
-				biliupCookie:  "cookies.json",
-				biliupLine:    "",
-				biliupLimit:   3,
-				biliupTags:    "",
-				biliupTitle:   "",
-				biliupDesc:    "Uploaded via yt-transfer",
-				biliupDynamic: "",
+				videoID:        "abc123",
+				platform:       "bilibili",
+				outputDir:      "downloads",
+				dbPath:         "metadata.db",
+				httpAddr:       "",
+				limit:          5,
+				sleepSeconds:   5,
+				downloadJobs:   1,
+				uploadJobs:     1,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "none",
+				subtitleLangs:  "zh-Hans,zh.*,en",
+				subtitleFormat: "srt",
+				bilibiliClient: "native",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLine:     "",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+				biliupTags:     "",
+				biliupTitle:    "",
+				biliupDesc:     "",
+				biliupDynamic:  "",
 			},
 		},
 		{
 			name: "channel custom",
-			args: []string{"--channel-id", "UC123", "--limit", "3", "--platform", "tiktok", "--output", "out", "--sleep-seconds", "7"},
+			args: []string{"--channel-id", "UC123", "--limit", "3", "--platform", "tiktok, Bilibili,XHS", "--output", "out", "--sleep-seconds", "7"},
 			want: config{
-				channelID:     "UC123",
-				platform:      "tiktok",
-				outputDir:     "out",
-				dbPath:        "metadata.db",
-				httpAddr:      "",
-				limit:         3,
-				sleepSeconds:  7,
-				jsRuntime:     "auto",
-				format:        "auto",
-				biliupBinary:  "biliup",
-				biliupCookie:  "cookies.json",
-				biliupLine:    "",
-				biliupLimit:   3,
-				biliupTags:    "",
-				biliupTitle:   "",
-				biliupDesc:    "Uploaded via yt-transfer",
-				biliupDynamic: "",
+				channelID:      "UC123",
+				platform:       "douyin,bilibili,xiaohongshu",
+				outputDir:      "out",
+				dbPath:         "metadata.db",
+				httpAddr:       "",
+				limit:          3,
+				sleepSeconds:   7,
+				downloadJobs:   1,
+				uploadJobs:     1,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "none",
+				subtitleLangs:  "zh-Hans,zh.*,en",
+				subtitleFormat: "srt",
+				bilibiliClient: "native",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLine:     "",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+				biliupTags:     "",
+				biliupTitle:    "",
+				biliupDesc:     "",
+				biliupDynamic:  "",
 			},
 		},
 		{
 			name:    "missing id",
-			wantErr: "provide either --channel-id or --video-id",
+			wantErr: "nothing to do: use `yttransfer sync channel ID`, `yttransfer sync video ID` or `yttransfer serve` (see `yttransfer help`)",
 		},
 		{
 			name: "http server without ids",
 			args: []string{"--http-addr", ":8080"},
 			want: config{
-				platform:      "bilibili",
-				outputDir:     "downloads",
-				dbPath:        "metadata.db",
-				httpAddr:      ":8080",
-				limit:         5,
-				sleepSeconds:  5,
-				jsRuntime:     "auto",
-				format:        "auto",
-				biliupBinary:  "biliup",
-				biliupCookie:  "cookies.json",
-				biliupLine:    "",
-				biliupLimit:   3,
-				biliupTags:    "",
-				biliupTitle:   "",
-				biliupDesc:    "Uploaded via yt-transfer",
-				biliupDynamic: "",
+				platform:       "bilibili",
+				outputDir:      "downloads",
+				dbPath:         "metadata.db",
+				httpAddr:       ":8080",
+				limit:          5,
+				sleepSeconds:   5,
+				downloadJobs:   1,
+				uploadJobs:     1,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "none",
+				subtitleLangs:  "zh-Hans,zh.*,en",
+				subtitleFormat: "srt",
+				bilibiliClient: "native",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLine:     "",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+				biliupTags:     "",
+				biliupTitle:    "",
+				biliupDesc:     "",
+				biliupDynamic:  "",
 			},
 		},
+		{
+			name: "watch without ids",
+			args: []string{"--watch", "channels.json"},
+			want: config{
+				platform:       "bilibili",
+				outputDir:      "downloads",
+				dbPath:         "metadata.db",
+				watchPath:      "channels.json",
+				limit:          5,
+				sleepSeconds:   5,
+				downloadJobs:   1,
+				uploadJobs:     1,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "none",
+				subtitleLangs:  "zh-Hans,zh.*,en",
+				subtitleFormat: "srt",
+				bilibiliClient: "native",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+			},
+		},
+		{
+			name:    "watch with channel",
+			args:    []string{"--watch", "channels.json", "--channel-id", "UC123"},
+			wantErr: "--watch cannot be combined with --channel-id or --video-id",
+		},
+		{
+			name:    "websub without server",
+			args:    []string{"--video-id", "vid", "--websub-callback", "https://example.com/websub", "--websub-secret", "s3cret"},
+			wantErr: "--websub-callback requires --http-addr",
+		},
+		{
+			name:    "websub without secret",
+			args:    []string{"--http-addr", ":8080", "--websub-callback", "https://example.com/websub"},
+			wantErr: "--websub-*: websub secret is required",
+		},
 		{
 			name:    "both ids",
 			args:    []string{"--video-id", "vid", "--channel-id", "chan"},
@@ -105,10 +230,195 @@ func TestParseFlagsFrom(t *testing.T) {
 			args:    []string{"--video-id", "vid", "--sleep-seconds", "-1"},
 			wantErr: "--sleep-seconds must be >= 0",
 		},
+		{
+			name: "biliup client",
+			args: []string{"--video-id", "vid", "--bilibili-client", "BiliUp"},
+			want: config{
+				videoID:        "vid",
+				platform:       "bilibili",
+				outputDir:      "downloads",
+				dbPath:         "metadata.db",
+				limit:          5,
+				sleepSeconds:   5,
+				downloadJobs:   1,
+				uploadJobs:     1,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "none",
+				subtitleLangs:  "zh-Hans,zh.*,en",
+				subtitleFormat: "srt",
+				bilibiliClient: "biliup",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+				biliupDesc:     "",
+			},
+		},
+		{
+			name:    "bad bilibili client",
+			args:    []string{"--video-id", "vid", "--bilibili-client", "python"},
+			wantErr: "--bilibili-client must be native or biliup",
+		},
+		{
+			name:    "bad cover aspect",
+			args:    []string{"--video-id", "vid", "--cover-aspect", "wide"},
+			wantErr: `invalid cover aspect ratio "wide"; use W:H such as 16:10`,
+		},
+		{
+			name: "cc subtitles",
+			args: []string{"--video-id", "vid", "--subtitle-mode", "CC", "--subtitle-langs", "en", "--subtitle-auto"},
+			want: config{
+				videoID:        "vid",
+				platform:       "bilibili",
+				outputDir:      "downloads",
+				dbPath:         "metadata.db",
+				limit:          5,
+				sleepSeconds:   5,
+				downloadJobs:   1,
+				uploadJobs:     1,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "cc",
+				subtitleLangs:  "en",
+				subtitleAuto:   true,
+				subtitleFormat: "srt",
+				bilibiliClient: "native",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+			},
+		},
+		{
+			name:    "bad subtitle mode",
+			args:    []string{"--video-id", "vid", "--subtitle-mode", "soft"},
+			wantErr: "--subtitle-*: subtitle mode must be none, burn or cc",
+		},
+		{
+			name: "pipeline workers",
+			args: []string{"--channel-id", "UC123", "--download-workers", "3", "--upload-workers", "2", "--unordered"},
+			want: config{
+				channelID:      "UC123",
+				platform:       "bilibili",
+				outputDir:      "downloads",
+				dbPath:         "metadata.db",
+				limit:          5,
+				sleepSeconds:   5,
+				downloadJobs:   3,
+				uploadJobs:     2,
+				retryAttempts:  3,
+				retryBackoff:   10 * time.Second,
+				retryMaxDelay:  5 * time.Minute,
+				retryJitter:    0.2,
+				deadLetterMax:  10,
+				websubHub:      app.DefaultWebSubHub,
+				websubLease:    5 * 24 * time.Hour,
+				unordered:      true,
+				jsRuntime:      "auto",
+				format:         "auto",
+				subtitleMode:   "none",
+				subtitleLangs:  "zh-Hans,zh.*,en",
+				subtitleFormat: "srt",
+				bilibiliClient: "native",
+				biliupBinary:   "biliup",
+				biliupCookie:   "cookies.json",
+				biliupLimit:    3,
+				douyinCookie:   "douyin_cookies.json",
+				douyinLimit:    3,
+				douyinVisible:  "public",
+				xhsCookie:      "xiaohongshu_cookies.json",
+				xhsLimit:       3,
+				kuaishouCookie: "kuaishou_cookies.json",
+				kuaishouLimit:  3,
+				xiguaCookie:    "xigua_cookies.json",
+				xiguaLimit:     3,
+			},
+		},
+		{
+			name:    "zero upload workers",
+			args:    []string{"--video-id", "vid", "--upload-workers", "0"},
+			wantErr: "--download-workers and --upload-workers must be > 0",
+		},
+		{
+			name:    "bad retry jitter",
+			args:    []string{"--video-id", "vid", "--retry-jitter", "1.5"},
+			wantErr: "--retry-jitter must be between 0 and 1",
+		},
 		{
 			name:    "bad platform",
 			args:    []string{"--video-id", "vid", "--platform", "myspace"},
-			wantErr: "--platform must be bilibili or tiktok",
+			wantErr: `--platform: unsupported platform "myspace" (want bilibili, douyin, kuaishou, xiaohongshu, xigua)`,
+		},
+		{
+			name:    "duplicate platform",
+			args:    []string{"--video-id", "vid", "--platform", "bilibili,Bilibili"},
+			wantErr: `--platform: platform "bilibili" listed twice`,
+		},
+		{
+			name:    "bad account",
+			args:    []string{"--video-id", "vid", "--platform", "douyin:my alt"},
+			wantErr: `--platform: platform "douyin:my alt": account names use letters, digits, - and _`,
+		},
+		{
+			name:    "duplicate account",
+			args:    []string{"--video-id", "vid", "--platform", "douyin:alt,tiktok:ALT"},
+			wantErr: `--platform: platform "douyin:alt" listed twice`,
+		},
+		{
+			name:    "bad douyin visibility",
+			args:    []string{"--video-id", "vid", "--douyin-visibility", "secret"},
+			wantErr: `--douyin-visibility: unknown douyin visibility "secret" (want public, private or friends)`,
+		},
+		{
+			name:    "bad douyin schedule",
+			args:    []string{"--video-id", "vid", "--douyin-publish-at", "tomorrow"},
+			wantErr: `--douyin-publish-at: "tomorrow" is neither an RFC 3339 time nor a duration`,
+		},
+		{
+			name:    "douyin delay too short",
+			args:    []string{"--channel-id", "chan", "--douyin-publish-at", "1h"},
+			wantErr: "--douyin-publish-at: douyin can only schedule posts 2h to 14 days ahead",
+		},
+		{
+			name:    "douyin time in the past",
+			args:    []string{"--video-id", "vid", "--douyin-publish-at", "2020-01-01T08:00:00+08:00"},
+			wantErr: "--douyin-publish-at: douyin can only schedule posts 2h to 14 days ahead",
+		},
+		{
+			name:    "douyin fixed time for a channel",
+			args:    []string{"--channel-id", "chan", "--douyin-publish-at", time.Now().Add(24 * time.Hour).Format(time.RFC3339)},
+			wantErr: "--douyin-publish-at: a fixed time only works for single videos; use a delay such as 3h for channels and serve",
 		},
 	}
 
@@ -212,3 +522,221 @@ func TestDetermineFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataTemplatesFromConfig(t *testing.T) {
+	cfg := config{
+		metaTitle:      "[搬运] ",
+		metaDesc:       "{{.URL}}",
+		metaTags:       "music",
+		biliupTitleTpl: "{{truncate 70 .Title}}",
+		biliupTags:     "music,bilibili",
+	}
+	if got, want := metadataTemplatesFromConfig(cfg, "douyin"), (app.MetadataTemplates{Title: "[搬运] " + app.DefaultTitleTemplate, Description: "{{.URL}}", Tags: "music"}); got != want {
+		t.Fatalf("douyin templates = %+v, want %+v", got, want)
+	}
+	if got, want := metadataTemplatesFromConfig(cfg, "bilibili"), (app.MetadataTemplates{Title: "[搬运] {{truncate 70 .Title}}", Description: "{{.URL}}", Tags: "music,bilibili"}); got != want {
+		t.Fatalf("bilibili templates = %+v, want %+v", got, want)
+	}
+
+	cfg.metaDesc = "{{.Nope"
+	for _, platform := range []string{"bilibili", "xigua"} {
+		if _, err := newUploaderFromConfig(cfg, platform, ""); err == nil || !strings.Contains(err.Error(), "invalid "+platform+" metadata template") {
+			t.Fatalf("%s: expected a template error, got %v", platform, err)
+		}
+	}
+}
+
+func TestDestinationsWithAccounts(t *testing.T) {
+	cfg := config{platform: "douyin,douyin:alt", douyinCookie: "cookies/douyin_cookies.json", xiguaCookie: "xigua_cookies.json"}
+	dests, err := newDestinations(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dests) != 2 || dests[0].String() != "douyin" || dests[1].Platform != "douyin" || dests[1].Account != "alt" {
+		t.Fatalf("unexpected destinations: %+v", dests)
+	}
+	resolve := destinationResolver(cfg)
+	if dest, err := resolve("xigua:work"); err != nil || dest.Platform != "xigua" || dest.Account != "work" {
+		t.Fatalf("resolve: %+v, %v", dest, err)
+	}
+	for account, want := range map[string]string{"": "cookies/douyin_cookies.json", "alt": "cookies/douyin_cookies.alt.json"} {
+		if got := accountCookiePath(cfg.douyinCookie, account); got != want {
+			t.Errorf("accountCookiePath(%q) = %q, want %q", account, got, want)
+		}
+	}
+}
+
+func TestRunSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "metadata.db")
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runSubscriptions(ctx, append(args, "--db-path", db), &out)
+		return out.String(), err
+	}
+
+	if _, err := run("add", "UC1", "--limit", "3", "--schedule", "@daily", "--platforms", "bilibili"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := run("add", "UC1", "--limit", "3"); !errors.Is(err, app.ErrSubscriptionExists) {
+		t.Fatalf("expected ErrSubscriptionExists, got %v", err)
+	}
+	if _, err := run("add", "UC2", "--schedule", "whenever"); err == nil {
+		t.Fatal("expected invalid schedule to be rejected")
+	}
+	if _, err := run("update", "UC1", "--enabled=false", "--tags", "music"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	out, err := run("list")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out, "UC1") || !strings.Contains(out, "@daily") || !strings.Contains(out, "false") {
+		t.Fatalf("unexpected list output:\n%s", out)
+	}
+	if _, err := run("remove", "UC1"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := run("remove", "UC1"); err == nil {
+		t.Fatal("expected removing an unknown subscription to fail")
+	}
+}
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseFlagsFromConfigFile(t *testing.T) {
+	path := writeConfig(t, `
+limit: 7
+download_workers: 2
+retry:
+  attempts: 5
+  backoff: 30s
+subtitles:
+  langs: [en, ja]
+bilibili:
+  client: biliup
+  tags: music
+channels:
+  UCfile:
+    schedule: "@daily"
+    platforms: bilibili
+    title: "[搬运] {{.Title}}"
+`)
+	t.Setenv("YTTRANSFER_DOWNLOAD_WORKERS", "3")
+	t.Setenv("YTTRANSFER_RETRY_ATTEMPTS", "4")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := parseFlagsFrom(fs, []string{"--config", path, "--channel-id", "UC", "--retry-attempts", "6"})
+	if err != nil {
+		t.Fatalf("parseFlagsFrom: %v", err)
+	}
+	if cfg.limit != 7 || cfg.retryBackoff != 30*time.Second || cfg.subtitleLangs != "en,ja" || cfg.bilibiliClient != "biliup" || cfg.biliupTags != "music" {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if cfg.downloadJobs != 3 {
+		t.Fatalf("expected env to override the file, got %d download workers", cfg.downloadJobs)
+	}
+	if cfg.retryAttempts != 6 {
+		t.Fatalf("expected the flag to override env and file, got %d attempts", cfg.retryAttempts)
+	}
+	want := []app.Subscription{{
+		ChannelID: "UCfile",
+		Platforms: []string{"bilibili"},
+		Limit:     7,
+		Schedule:  "@daily",
+		Templates: app.MetadataTemplates{Title: "[搬运] {{.Title}}"},
+		Enabled:   true,
+	}}
+	if !reflect.DeepEqual(cfg.channels, want) {
+		t.Fatalf("channels = %+v, want %+v", cfg.channels, want)
+	}
+}
+
+func TestParseFlagsFromConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "unknown key",
+			body: "limit: 3\nretry:\n  atempts: 4\n",
+			want: `config.yaml:3: unknown key "retry.atempts"`,
+		},
+		{
+			name: "bad value",
+			body: "limit: 3\nretry:\n  backoff: soon\n",
+			want: `config.yaml:3 retry.backoff: invalid value "soon"`,
+		},
+		{
+			name: "bad env value",
+			env:  map[string]string{"YTTRANSFER_LIMIT": "many"},
+			want: `YTTRANSFER_LIMIT: invalid value "many"`,
+		},
+		{
+			name: "validation names the key",
+			body: "retry:\n  jitter: 2\n",
+			want: "config.yaml:2 retry.jitter)",
+		},
+		{
+			name: "invalid channel",
+			body: "channels:\n  UCx:\n    schedule: sometimes\n",
+			want: "channels.UCx:",
+		},
+		{
+			name: "unknown channel key",
+			body: "channels:\n  UCx:\n    limt: 3\n",
+			want: `config.yaml:3: channels.UCx: unknown key "limt"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := writeConfig(t, tt.body)
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			_, err := parseFlagsFrom(fs, []string{"--config", path, "--channel-id", "UC"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRunConfigPrint(t *testing.T) {
+	path := writeConfig(t, `
+websub:
+  secret: hunter2
+bilibili:
+  line: qn
+channels:
+  UC1:
+    limit: 2
+    tags: [a, b]
+`)
+	t.Setenv(configEnvVar, path)
+	t.Setenv("YTTRANSFER_LIMIT", "9")
+
+	var out bytes.Buffer
+	if err := runConfig([]string{"print", "--upload-workers", "4"}, &out); err != nil {
+		t.Fatalf("runConfig: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"limit: 9\n", "upload_workers: 4\n", "  line: qn\n", "  secret: <redacted>\n", "  UC1:\n    limit: 2\n", "    tags: a,b\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in config print output:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "hunter2") {
+		t.Fatalf("secret leaked into config print output:\n%s", got)
+	}
+}
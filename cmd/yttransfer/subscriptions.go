@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"great_transport/internal/app"
+)
+
+const subscriptionsUsage = `usage: yttransfer subscriptions <list|add|update|remove> [CHANNEL_ID] [flags]
+
+  list                          show all subscriptions
+  add CHANNEL_ID --limit N ...  subscribe to a channel
+  update CHANNEL_ID ...         change only the flags given
+  remove CHANNEL_ID             delete a subscription`
+
+// runSubscriptions manages the subscriptions table directly in the sqlite
+// database, mirroring the /subscriptions HTTP endpoints.
+func runSubscriptions(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(subscriptionsUsage)
+	}
+	action := args[0]
+	channelID, args := positionalArg(args[1:])
+
+	fs := flag.NewFlagSet("subscriptions "+action, flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db-path", "metadata.db", "path to sqlite metadata database or postgres:// URL")
+	platforms := fs.String("platforms", "", "comma-separated target platforms (empty uses --platform of the sync)")
+	limit := fs.Int("limit", 5, "max videos to consider per sync")
+	schedule := fs.String("schedule", "", "cron expression or interval for --watch-subscriptions (empty: on demand only)")
+	title := fs.String("title", "", "title template overriding --metadata-title for this channel")
+	desc := fs.String("desc", "", "description template overriding --metadata-desc for this channel")
+	dynamic := fs.String("dynamic", "", "dynamic template overriding --biliup-dynamic for this channel")
+	tags := fs.String("tags", "", "tag template overriding --metadata-tags for this channel")
+	enabled := fs.Bool("enabled", true, "schedule the channel when watching subscriptions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if channelID == "" {
+		channelID = fs.Arg(0)
+	}
+	if action != "list" && channelID == "" {
+		return fmt.Errorf("subscriptions %s: channel ID required\n%s", action, subscriptionsUsage)
+	}
+
+	store, err := app.OpenStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.EnsureSchema(ctx); err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		subs, err := store.ListSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHANNEL\tLIMIT\tSCHEDULE\tPLATFORMS\tENABLED")
+		for _, sub := range subs {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%t\n", sub.ChannelID, sub.Limit, orDash(sub.Schedule), orDash(strings.Join(sub.Platforms, ",")), sub.Enabled)
+		}
+		return tw.Flush()
+	case "add":
+		list, err := validatePlatforms(parseCSVList(*platforms))
+		if err != nil {
+			return err
+		}
+		sub := app.Subscription{
+			ChannelID: channelID,
+			Platforms: list,
+			Limit:     *limit,
+			Schedule:  strings.TrimSpace(*schedule),
+			Templates: app.MetadataTemplates{Title: *title, Description: *desc, Dynamic: *dynamic, Tags: *tags},
+			Enabled:   *enabled,
+		}
+		if err := sub.Validate(); err != nil {
+			return err
+		}
+		if err := store.AddSubscription(ctx, sub); err != nil {
+			return fmt.Errorf("%s: %w", channelID, err)
+		}
+		fmt.Fprintf(out, "subscribed to %s\n", channelID)
+		return nil
+	case "update":
+		sub, err := store.GetSubscription(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			return fmt.Errorf("%s is not subscribed", channelID)
+		}
+		list, err := validatePlatforms(parseCSVList(*platforms))
+		if err != nil {
+			return err
+		}
+		var patch app.SubscriptionPatch
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "platforms":
+				patch.Platforms = &list
+			case "limit":
+				patch.Limit = limit
+			case "schedule":
+				patch.Schedule = schedule
+			case "title":
+				patch.Title = title
+			case "desc":
+				patch.Description = desc
+			case "dynamic":
+				patch.Dynamic = dynamic
+			case "tags":
+				patch.Tags = tags
+			case "enabled":
+				patch.Enabled = enabled
+			}
+		})
+		updated := patch.Apply(*sub)
+		if err := updated.Validate(); err != nil {
+			return err
+		}
+		if _, err := store.UpdateSubscription(ctx, updated); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "updated %s\n", channelID)
+		return nil
+	case "remove":
+		ok, err := store.DeleteSubscription(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s is not subscribed", channelID)
+		}
+		fmt.Fprintf(out, "unsubscribed from %s\n", channelID)
+		return nil
+	default:
+		return fmt.Errorf("unknown subscriptions command %q\n%s", action, subscriptionsUsage)
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -2,7 +2,11 @@ module great_transport
 
 go 1.22.0
 
-require modernc.org/sqlite v1.30.0
+require (
+	github.com/lib/pq v1.10.9
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.30.0
+)
 
 require (
 	github.com/biliup/biliup v1.1.28 // indirect
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArtifactKind tells apart the files a download leaves behind so only
+// actual videos are handed to uploaders as videos.
+type ArtifactKind string
+
+const (
+	ArtifactVideo     ArtifactKind = "video"
+	ArtifactThumbnail ArtifactKind = "thumbnail"
+	ArtifactInfoJSON  ArtifactKind = "info_json"
+	ArtifactSubtitle  ArtifactKind = "subtitle"
+)
+
+// Artifact is one file produced by a download.
+type Artifact struct {
+	Kind ArtifactKind
+	Path string
+}
+
+var thumbnailExtensions = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// classifyArtifact guesses an artifact's kind from its file name.
+func classifyArtifact(path string) ArtifactKind {
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".info.json") {
+		return ArtifactInfoJSON
+	}
+	ext := filepath.Ext(lower)
+	for _, thumb := range thumbnailExtensions {
+		if ext == thumb {
+			return ArtifactThumbnail
+		}
+	}
+	for _, sub := range subtitleExtensions {
+		if ext == sub {
+			return ArtifactSubtitle
+		}
+	}
+	return ArtifactVideo
+}
+
+// collectArtifacts classifies the paths yt-dlp reported and adds the
+// thumbnail, subtitles and info.json it wrote next to the first video.
+func collectArtifacts(paths []string) []Artifact {
+	var artifacts []Artifact
+	seen := map[string]bool{}
+	add := func(kind ArtifactKind, path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			artifacts = append(artifacts, Artifact{Kind: kind, Path: path})
+		}
+	}
+	var videos []string
+	for _, path := range paths {
+		kind := classifyArtifact(path)
+		add(kind, path)
+		if kind == ArtifactVideo {
+			videos = append(videos, path)
+		}
+	}
+	if len(videos) > 0 {
+		add(ArtifactThumbnail, findThumbnail(videos))
+		for _, sub := range findSubtitles(videos[0], nil) {
+			add(ArtifactSubtitle, sub.Path)
+		}
+		if info := infoJSONPath(videos[0]); fileExists(info) {
+			add(ArtifactInfoJSON, info)
+		}
+	}
+	return artifacts
+}
+
+// findThumbnail returns the thumbnail yt-dlp's --write-thumbnail stored
+// beside one of videos, preferring jpg, or "" when there is none.
+func findThumbnail(videos []string) string {
+	for _, video := range videos {
+		base := strings.TrimSuffix(video, filepath.Ext(video))
+		for _, ext := range thumbnailExtensions {
+			if fileExists(base + ext) {
+				return base + ext
+			}
+		}
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
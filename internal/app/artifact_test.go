@@ -0,0 +1,54 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyArtifact(t *testing.T) {
+	cases := map[string]ArtifactKind{
+		"downloads/clip.mp4":       ArtifactVideo,
+		"downloads/clip.webm":      ArtifactVideo,
+		"downloads/clip.JPG":       ArtifactThumbnail,
+		"downloads/clip.webp":      ArtifactThumbnail,
+		"downloads/clip.info.json": ArtifactInfoJSON,
+	}
+	for path, want := range cases {
+		if got := classifyArtifact(path); got != want {
+			t.Fatalf("classifyArtifact(%q)=%s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestCollectArtifactsFindsSidecars(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "clip.mp4")
+	for _, name := range []string{"clip.mp4", "clip.webp", "clip.jpg", "clip.info.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := DownloadResult{Artifacts: collectArtifacts([]string{video})}
+	if !reflect.DeepEqual(res.Videos(), []string{video}) {
+		t.Fatalf("videos=%v", res.Videos())
+	}
+	if res.Thumbnail() != filepath.Join(dir, "clip.jpg") {
+		t.Fatalf("thumbnail=%s, want the jpg", res.Thumbnail())
+	}
+	if info := res.paths(ArtifactInfoJSON); len(info) != 1 {
+		t.Fatalf("info artifacts=%v", info)
+	}
+}
+
+func TestCoverOptionsValidate(t *testing.T) {
+	if err := (CoverOptions{AspectRatio: "16:10", Width: 1146}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []CoverOptions{{AspectRatio: "16x10"}, {AspectRatio: "0:1"}, {Width: -1}} {
+		if err := opts.Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", opts)
+		}
+	}
+}
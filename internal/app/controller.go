@@ -2,8 +2,14 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 )
 
 type SyncResult struct {
@@ -11,83 +17,677 @@ type SyncResult struct {
 	Skipped    int
 	Downloaded int
 	Uploaded   int
+	// Failed counts videos whose download or upload failed in this sync;
+	// DeadLettered is the subset that was moved to the dead-letter table.
+	Failed       int
+	DeadLettered int
+	Videos       []VideoOutcome
+}
+
+// VideoOutcome reports what a sync did with one video.
+type VideoOutcome struct {
+	VideoID      string
+	State        JobState
+	Skipped      bool
+	DeadLettered bool
+	RemoteIDs    []string
+	Error        string
+	// ErrorKind classifies yt-dlp failures (see YtDlpErrorKind); Action
+	// says whether to refresh cookies, wait or give up. Both are empty
+	// when the video did not fail.
+	ErrorKind YtDlpErrorKind
+	Action    ErrorAction
 }
 
 type Controller struct {
 	Downloader Downloader
-	Uploader   Uploader
-	Store      *SQLiteStore
-	OutputDir  string
-	JSRuntime  string
-	Format     string
+	// Uploader is the only destination when Destinations is empty; its
+	// uploads are recorded under DefaultPlatform.
+	Uploader Uploader
+	// Destinations lists every platform account a video is published to.
+	// A video counts as uploaded once each of them has it; later syncs
+	// only upload to the destinations still missing.
+	Destinations []Destination
+	// ResolveDestination, when set, builds the destination for a
+	// subscription platform ("platform" or "platform:account") that is
+	// not among Destinations. It may be called concurrently.
+	ResolveDestination func(name string) (Destination, error)
+	Store              Store
+	OutputDir          string
+	JSRuntime          string
+	Format             string
+	Cover              CoverOptions
+	Subtitles          SubtitleOptions
+	Pipeline           PipelineOptions
+	Retry              RetryPolicy
+	// Runner executes ffmpeg for covers and subtitle burn-in; nil means
+	// ExecRunner.
+	Runner CommandRunner
+
+	mu      sync.Mutex
+	syncing map[string]bool
 }
 
+// ErrSyncInProgress is returned by SyncChannel when the same channel is
+// already being synced, e.g. by the scheduler and an HTTP request at once.
+var ErrSyncInProgress = errors.New("channel sync already in progress")
+
 type Uploader interface {
-	Upload(path string) error
+	Upload(ctx context.Context, req UploadRequest) (UploadResult, error)
+}
+
+// DefaultPlatform is the platform Controller.Uploader's uploads are
+// recorded under; every upload before per-destination tracking went there.
+const DefaultPlatform = "bilibili"
+
+// Destination is one account on one platform. Account tells several
+// accounts on the same platform apart and may be empty.
+type Destination struct {
+	Platform string
+	Account  string
+	Uploader Uploader
+}
+
+func (d Destination) String() string {
+	if d.Account == "" {
+		return d.Platform
+	}
+	return d.Platform + ":" + d.Account
+}
+
+// UploadRequest is one file to publish. Metadata describes the original
+// video and is nil when yt-dlp did not write an info.json. Cover is the
+// path of the cover image, or "" to let the platform pick one. Subtitles
+// are set in SubtitlesCC mode for uploaders that can attach captions.
+type UploadRequest struct {
+	Path      string
+	Metadata  *VideoMetadata
+	Cover     string
+	Subtitles []Subtitle
+	// Templates, when set, override the uploader's metadata templates
+	// (e.g. from the channel's subscription).
+	Templates *MetadataTemplates
+}
+
+// UploadResult identifies the item an Uploader created on the remote
+// platform. Both fields may be empty for uploaders that cannot tell.
+type UploadResult struct {
+	RemoteID string
+	URL      string
 }
 
 func (c *Controller) SyncChannel(ctx context.Context, channelID string, limit int) (SyncResult, error) {
-	if c.Downloader == nil || c.Uploader == nil || c.Store == nil {
+	if c.Downloader == nil || len(c.destinations()) == 0 || c.Store == nil {
 		return SyncResult{}, fmt.Errorf("controller is not fully configured")
 	}
+	if !c.claimChannel(channelID) {
+		return SyncResult{}, fmt.Errorf("%s: %w", channelID, ErrSyncInProgress)
+	}
+	defer c.releaseChannel(channelID)
 	channelURL := channelURL(channelID)
 	ids, err := c.Downloader.ListChannelVideoIDs(ctx, channelURL, limit, c.JSRuntime)
 	if err != nil {
 		return SyncResult{}, err
 	}
+	ids, err = c.withPendingJobs(ctx, channelID, ids)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	dests, err := c.destinationsFor(ctx, channelID)
+	if err != nil {
+		return SyncResult{}, err
+	}
 
 	result := SyncResult{Considered: len(ids)}
-	for _, id := range ids {
-		uploaded, err := c.Store.IsUploaded(ctx, id)
+	err = c.runPipeline(ctx, ids, channelID, dests, &result)
+	return result, err
+}
+
+func (c *Controller) destinations() []Destination {
+	if len(c.Destinations) > 0 || c.Uploader == nil {
+		return c.Destinations
+	}
+	return []Destination{{Platform: DefaultPlatform, Uploader: c.Uploader}}
+}
+
+// destinationsFor returns where the videos of channelID go: the platforms
+// of its subscription, or Destinations when it names none.
+func (c *Controller) destinationsFor(ctx context.Context, channelID string) ([]Destination, error) {
+	if !knownChannel(channelID) {
+		return c.destinations(), nil
+	}
+	sub, err := c.Store.GetSubscription(ctx, channelID)
+	if err != nil || sub == nil || len(sub.Platforms) == 0 {
+		return c.destinations(), err
+	}
+	dests := make([]Destination, 0, len(sub.Platforms))
+	for _, name := range sub.Platforms {
+		dest, err := c.resolveDestination(name)
 		if err != nil {
-			return result, err
+			return nil, fmt.Errorf("subscription %s: %w", channelID, err)
 		}
-		if uploaded {
-			result.Skipped++
-			continue
+		dests = append(dests, dest)
+	}
+	return dests, nil
+}
+
+// knownChannel reports whether channelID names a channel; jobs synced
+// without one store "unknown".
+func knownChannel(channelID string) bool {
+	return channelID != "" && channelID != "unknown"
+}
+
+// resolveItemDestinations sets where a single-video sync sends the video
+// and which of those destinations still lack it.
+func (c *Controller) resolveItemDestinations(ctx context.Context, item *pipelineItem, channelID string) error {
+	var err error
+	if item.destinations, err = c.destinationsFor(ctx, channelID); err != nil {
+		return err
+	}
+	item.pending, err = c.pendingDestinations(ctx, item.videoID, item.destinations)
+	return err
+}
+
+func (c *Controller) resolveDestination(name string) (Destination, error) {
+	for _, dest := range c.destinations() {
+		if dest.String() == name {
+			return dest, nil
 		}
+	}
+	if c.ResolveDestination == nil {
+		return Destination{}, fmt.Errorf("no uploader configured for platform %q", name)
+	}
+	return c.ResolveDestination(name)
+}
 
-		if err := c.syncVideoByID(ctx, id, channelID, &result); err != nil {
-			return result, err
+// pendingDestinations lists the destinations videoID was not uploaded to.
+func (c *Controller) pendingDestinations(ctx context.Context, videoID string, dests []Destination) ([]Destination, error) {
+	var pending []Destination
+	for _, dest := range dests {
+		uploaded, err := c.Store.IsUploaded(ctx, videoID, dest.Platform, dest.Account)
+		if err != nil {
+			return nil, err
 		}
+		if !uploaded {
+			pending = append(pending, dest)
+		}
+	}
+	return pending, nil
+}
+
+func (c *Controller) claimChannel(channelID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.syncing[channelID] {
+		return false
+	}
+	if c.syncing == nil {
+		c.syncing = make(map[string]bool)
 	}
-	return result, nil
+	c.syncing[channelID] = true
+	return true
+}
+
+func (c *Controller) releaseChannel(channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.syncing, channelID)
 }
 
 func (c *Controller) SyncVideo(ctx context.Context, videoID string) error {
-	if c.Downloader == nil || c.Uploader == nil || c.Store == nil {
-		return fmt.Errorf("controller is not fully configured")
+	_, err := c.syncSingleVideo(ctx, videoID, "")
+	return err
+}
+
+// syncSingleVideo syncs one video. channelID, when known, is recorded on
+// a job that has no channel yet, so the channel's subscription applies.
+func (c *Controller) syncSingleVideo(ctx context.Context, videoID, channelID string) (SyncResult, error) {
+	if c.Downloader == nil || len(c.destinations()) == 0 || c.Store == nil {
+		return SyncResult{}, fmt.Errorf("controller is not fully configured")
 	}
-	return c.syncVideoByID(ctx, videoID, "", nil)
+	result := SyncResult{Considered: 1}
+	item := &pipelineItem{videoID: videoID, channelHint: channelID}
+	c.downloadStage(ctx, item)
+	if !item.done {
+		c.uploadStage(ctx, item)
+	}
+	item.record(&result)
+	return result, item.err
 }
 
-func (c *Controller) syncVideoByID(ctx context.Context, videoID, channelID string, result *SyncResult) error {
-	videoURL := videoURL(videoID)
-	files, err := c.Downloader.DownloadVideo(ctx, videoURL, c.OutputDir, c.JSRuntime, c.Format)
+// withPendingJobs appends videos of the channel that an earlier, interrupted
+// sync left half-done so they are resumed even once they drop out of the
+// newest-N listing.
+func (c *Controller) withPendingJobs(ctx context.Context, channelID string, ids []string) ([]string, error) {
+	pending, err := c.Store.PendingJobs(ctx, channelID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(files) == 0 {
-		return fmt.Errorf("no files downloaded for %s", videoID)
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
 	}
-	if result != nil {
-		result.Downloaded += len(files)
-		log.Printf("Video of id %s is downloaded", videoID)
+	for _, job := range pending {
+		if !seen[job.VideoID] {
+			seen[job.VideoID] = true
+			ids = append(ids, job.VideoID)
+		}
 	}
+	return ids, nil
+}
 
-	for _, path := range files {
-		if err := c.Uploader.Upload(path); err != nil {
-			return err
+// downloadStage loads the video's job and downloads it unless the files of
+// an earlier attempt can be reused. It sets item.done when there is nothing
+// left to upload.
+func (c *Controller) downloadStage(ctx context.Context, item *pipelineItem) {
+	ctx = withProgressVideo(ctx, item.videoID)
+	finish := func(err error) {
+		item.err = err
+		item.done = true
+	}
+	if item.channelID != "" {
+		pending, err := c.pendingDestinations(ctx, item.videoID, item.destinations)
+		if err != nil {
+			finish(err)
+			return
+		}
+		if len(pending) == 0 {
+			item.skipped = true
+			item.done = true
+			return
+		}
+		item.pending = pending
+	}
+	dead, err := c.Store.GetDeadLetter(ctx, item.videoID)
+	if err != nil {
+		finish(err)
+		return
+	}
+	if dead != nil {
+		if item.channelID == "" {
+			finish(fmt.Errorf("video %s is dead-lettered after %s failed: %s; requeue it to retry", item.videoID, dead.Stage, dead.Error))
+			return
+		}
+		item.skipped = true
+		item.deadLettered = true
+		item.done = true
+		return
+	}
+	job, err := c.Store.GetJob(ctx, item.videoID)
+	if err != nil {
+		finish(err)
+		return
+	}
+	if job == nil {
+		job = &VideoJob{VideoID: item.videoID, ChannelID: item.channelID, State: JobDiscovered}
+	}
+	if item.channelID != "" {
+		job.ChannelID = item.channelID
+	} else if item.channelHint != "" && !knownChannel(job.ChannelID) {
+		job.ChannelID = item.channelHint
+	}
+	item.job = job
+	// Single-video syncs know the channel from an earlier job, a hint or
+	// the info.json of files already on disk; otherwise the destinations
+	// wait for the download's info.json.
+	if item.destinations == nil && !knownChannel(job.ChannelID) && len(job.Files) > 0 {
+		if meta := metadataForFiles(job.Files); meta != nil && knownChannel(meta.ChannelID) {
+			job.ChannelID = meta.ChannelID
 		}
-		if result != nil {
-			result.Uploaded++
-			log.Printf("Uploaded the file: &s", path)
+	}
+	if item.destinations == nil && knownChannel(job.ChannelID) {
+		if err := c.resolveItemDestinations(ctx, item, job.ChannelID); err != nil {
+			finish(err)
+			return
 		}
 	}
+	if item.destinations != nil && len(item.pending) == 0 {
+		finish(c.advance(ctx, job, JobUploaded))
+		return
+	}
+	job.Attempts++
+	job.LastError = ""
 
-	if err := c.Store.MarkUploaded(ctx, videoID, channelID); err != nil {
-		log.Printf("failed to mark uploaded for %s: %v", videoID, err)
+	if canResumeUpload(job) {
+		log.Printf("Resuming video %s from state %s with %d downloaded file(s)", item.videoID, job.State, len(job.Files))
+		item.files = job.Files
+		item.meta = metadataForFiles(job.Files)
+		item.thumb = findThumbnail(job.Files)
+		c.resolveFromMetadata(ctx, item)
+		return
+	}
+	if err := c.advance(ctx, job, JobDownloading); err != nil {
+		finish(err)
+		return
+	}
+	reportProgress(ctx, ProgressEvent{Stage: StageDownload, Percent: -1, Message: "download started"})
+	var (
+		downloaded DownloadResult
+		files      []string
+	)
+	err = c.withRetry(ctx, item, StageDownload, func() error {
+		var err error
+		downloaded, err = c.Downloader.DownloadVideo(ctx, videoURL(item.videoID), c.OutputDir, c.JSRuntime, c.Format)
+		files = downloaded.Videos()
+		if err == nil && len(files) == 0 {
+			err = fmt.Errorf("no files downloaded for %s", item.videoID)
+		}
 		return err
+	})
+	if err != nil {
+		c.fail(ctx, item, StageDownload, err)
+		return
+	}
+	job.Files = files
+	if err := c.advance(ctx, job, JobDownloaded); err != nil {
+		finish(err)
+		return
+	}
+	item.files, item.meta, item.thumb = files, downloaded.Metadata, downloaded.Thumbnail()
+	item.downloaded = len(files)
+	log.Printf("Video of id %s is downloaded", item.videoID)
+	c.resolveFromMetadata(ctx, item)
+}
+
+// resolveFromMetadata resolves the destinations downloadStage could not,
+// taking the channel from the video's info.json, and finishes the item if
+// every destination already has the video.
+func (c *Controller) resolveFromMetadata(ctx context.Context, item *pipelineItem) {
+	if item.destinations != nil {
+		return
+	}
+	job := item.job
+	if item.meta != nil && knownChannel(item.meta.ChannelID) && !knownChannel(job.ChannelID) {
+		job.ChannelID = item.meta.ChannelID
+	}
+	if err := c.resolveItemDestinations(ctx, item, job.ChannelID); err != nil {
+		item.err = err
+		item.done = true
+		return
+	}
+	if len(item.pending) == 0 {
+		item.err = c.advance(ctx, job, JobUploaded)
+		item.done = true
+	}
+}
+
+// uploadStage publishes the files downloadStage produced and marks the
+// video as uploaded.
+func (c *Controller) uploadStage(ctx context.Context, item *pipelineItem) {
+	ctx = withProgressVideo(ctx, item.videoID)
+	job := item.job
+	if err := ctx.Err(); err != nil {
+		// Leave the job in its downloaded state so the next sync resumes it.
+		item.err = err
+		return
+	}
+	if item.meta == nil {
+		log.Printf("no info.json found for %s; uploading with file-derived metadata", item.videoID)
+	}
+	cover := c.prepareCover(ctx, item.thumb)
+	templates, err := c.subscriptionTemplates(ctx, job.ChannelID, item.meta)
+	if err != nil {
+		item.err = err
+		return
+	}
+
+	if item.err = c.advance(ctx, job, JobUploading); item.err != nil {
+		return
+	}
+	reqs := make([]UploadRequest, 0, len(item.files))
+	for _, path := range item.files {
+		req, err := c.uploadRequest(ctx, path, item.meta, cover)
+		if err != nil {
+			c.fail(ctx, item, StageUpload, err)
+			return
+		}
+		req.Templates = templates
+		reqs = append(reqs, req)
+	}
+	failed, err := c.uploadToDestinations(ctx, item, reqs)
+	if err != nil {
+		// Leave the job uploading; the next sync resumes it.
+		item.err = err
+		return
+	}
+	if len(failed) > 0 {
+		c.fail(ctx, item, StageUpload, item.uploadError(failed))
+		return
+	}
+	item.err = c.advance(ctx, job, JobUploaded)
+}
+
+// uploadToDestinations sends every file to all pending destinations at
+// once through a FanOutUploader. Retries only go to the destinations whose last upload failed
+// transiently; a destination that fails a file for good drops out. Each
+// file of a multi-file video is recorded as soon as a destination has it,
+// as a partial upload until it has them all, so the next attempt only
+// sends the files still missing. It returns the failed uploads.
+func (c *Controller) uploadToDestinations(ctx context.Context, item *pipelineItem, reqs []UploadRequest) ([]DestinationResult, error) {
+	records, err := c.uploadRecords(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	// Uploads that finished are recorded even when the sync is being
+	// cancelled, so they are not repeated.
+	recordCtx := context.WithoutCancel(ctx)
+	var (
+		failed   []DestinationResult
+		storeErr error
+	)
+	record := func(rec *UploadRecord) {
+		if err := c.Store.MarkUploaded(recordCtx, *rec); err != nil {
+			log.Printf("failed to mark %s uploaded to %s: %v", item.videoID, rec.Platform, err)
+			storeErr = err
+		}
+	}
+	remaining := item.pending
+	for i, req := range reqs {
+		name := filepath.Base(item.files[i])
+		var done, todo []Destination
+		for _, dest := range remaining {
+			if slices.Contains(records[dest.String()].Files, name) {
+				done = append(done, dest)
+			} else {
+				todo = append(todo, dest)
+			}
+		}
+		var retry []DestinationResult
+		err := c.withRetry(ctx, item, StageUpload, func() error {
+			if len(todo) == 0 {
+				return nil
+			}
+			reportProgress(ctx, ProgressEvent{Stage: StageUpload, Percent: -1, Message: "uploading " + filepath.Base(req.Path) + " to " + joinDestinations(todo)})
+			retry = nil
+			results, _ := (&FanOutUploader{Destinations: todo}).UploadEach(ctx, req)
+			for _, r := range results {
+				switch {
+				case r.Err == nil:
+					done = append(done, r.Destination)
+					rec := records[r.Destination.String()]
+					rec.Files = append(rec.Files, name)
+					if r.Result.RemoteID != "" {
+						rec.RemoteID = strings.TrimPrefix(rec.RemoteID+","+r.Result.RemoteID, ",")
+						item.remoteIDs = append(item.remoteIDs, r.Result.RemoteID)
+					}
+					if rec.URL == "" {
+						rec.URL = r.Result.URL
+					}
+					if len(reqs) > 1 {
+						rec.Partial = true
+						record(rec)
+					}
+					item.uploaded++
+					log.Printf("Uploaded the file: %s to %s %s", req.Path, r.Destination, r.Result.URL)
+				case ClassifyError(r.Err) == ErrorPermanent:
+					failed = append(failed, r)
+				default:
+					retry = append(retry, r)
+				}
+			}
+			if len(retry) == 0 {
+				return nil
+			}
+			todo = todo[:0:0]
+			for _, r := range retry {
+				todo = append(todo, r.Destination)
+			}
+			return item.uploadError(retry)
+		})
+		if err != nil {
+			failed = append(failed, retry...)
+		}
+		remaining = done
+	}
+
+	for _, dest := range remaining {
+		rec := records[dest.String()]
+		rec.Partial = false
+		record(rec)
+	}
+	return failed, storeErr
+}
+
+// uploadRecords returns the record of each pending destination, picking up
+// the files a partial upload of an earlier attempt already sent.
+func (c *Controller) uploadRecords(ctx context.Context, item *pipelineItem) (map[string]*UploadRecord, error) {
+	existing, err := c.Store.Uploads(ctx, item.videoID)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]*UploadRecord, len(item.pending))
+	for _, dest := range item.pending {
+		rec := &UploadRecord{VideoID: item.videoID, ChannelID: item.job.ChannelID, Platform: dest.Platform, Account: dest.Account}
+		for _, prev := range existing {
+			if prev.Partial && prev.Platform == dest.Platform && prev.Account == dest.Account {
+				rec.RemoteID, rec.URL, rec.Files = prev.RemoteID, prev.URL, prev.Files
+			}
+		}
+		records[dest.String()] = rec
+	}
+	return records, nil
+}
+
+func joinDestinations(dests []Destination) string {
+	names := make([]string, len(dests))
+	for i, dest := range dests {
+		names[i] = dest.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// uploadRequest builds the request for one downloaded video, burning in
+// or attaching subtitles as configured.
+func (c *Controller) uploadRequest(ctx context.Context, path string, meta *VideoMetadata, cover string) (UploadRequest, error) {
+	req := UploadRequest{Path: path, Metadata: meta, Cover: cover}
+	if !c.Subtitles.enabled() {
+		return req, nil
+	}
+	subs := findSubtitles(path, c.Subtitles.Languages)
+	if len(subs) == 0 {
+		log.Printf("no subtitles in %v found for %s", c.Subtitles.Languages, path)
+		return req, nil
+	}
+	switch c.Subtitles.Mode {
+	case SubtitlesBurn:
+		reportProgress(ctx, ProgressEvent{Stage: StagePostprocess, Percent: -1, Message: "burning " + subs[0].Language + " subtitles"})
+		burned, err := BurnSubtitles(ctx, c.Runner, path, subs[0])
+		if err != nil {
+			return req, err
+		}
+		req.Path = burned
+	case SubtitlesCC:
+		req.Subtitles = subs
+	}
+	return req, nil
+}
+
+// prepareCover applies the configured crop/resize to the thumbnail. Covers
+// are cosmetic, so failures fall back to the original thumbnail.
+func (c *Controller) prepareCover(ctx context.Context, thumb string) string {
+	if thumb == "" || !c.Cover.enabled() {
+		return thumb
+	}
+	if !HasExecutable("ffmpeg") {
+		log.Printf("ffmpeg not found; using thumbnail %s as cover without resizing", thumb)
+		return thumb
+	}
+	cover, err := PrepareCover(ctx, c.Runner, thumb, c.Cover)
+	if err != nil {
+		log.Printf("failed to prepare cover from %s: %v", thumb, err)
+		return thumb
+	}
+	return cover
+}
+
+// canResumeUpload reports whether a previous attempt already downloaded the
+// job's files and they are all still on disk, so the download can be skipped.
+// Uploaded jobs qualify too: a destination added later reuses the files.
+func canResumeUpload(job *VideoJob) bool {
+	switch job.State {
+	case JobDownloaded, JobUploading, JobFailed, JobUploaded:
+	default:
+		return false
+	}
+	if len(job.Files) == 0 {
+		return false
+	}
+	for _, path := range job.Files {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Controller) advance(ctx context.Context, job *VideoJob, state JobState) error {
+	job.State = state
+	return c.Store.SaveJob(ctx, job)
+}
+
+// fail records that the item's video failed in stage. Videos that failed
+// permanently, or used up RetryPolicy.DeadLetterAfter attempts, are moved
+// to the dead-letter table. A logged-out session fails no video; it stops
+// the sync instead.
+func (c *Controller) fail(ctx context.Context, item *pipelineItem, stage ProgressStage, cause error) {
+	item.err = cause
+	item.done = true
+	if ctx.Err() != nil {
+		// Interrupted rather than failed: keep the in-progress state so
+		// the job shows up in PendingJobs and is resumed next time.
+		return
+	}
+	job := item.job
+	if errors.Is(cause, ErrNotLoggedIn) {
+		// Every other video would fail the same way: stop the sync and
+		// leave the job to be resumed once the cookies are refreshed.
+		job.LastError = cause.Error()
+		if err := c.Store.SaveJob(ctx, job); err != nil {
+			log.Printf("failed to record failure for %s: %v", job.VideoID, err)
+		}
+		return
+	}
+	item.failed = true
+	job.State = JobFailed
+	job.LastError = cause.Error()
+	if err := c.Store.SaveJob(ctx, job); err != nil {
+		log.Printf("failed to record failure for %s: %v", job.VideoID, err)
+	}
+	if !c.Retry.shouldDeadLetter(cause, job.Attempts) {
+		return
+	}
+	err := c.Store.AddDeadLetter(ctx, DeadLetter{
+		VideoID:   job.VideoID,
+		ChannelID: job.ChannelID,
+		Stage:     string(stage),
+		Attempts:  job.Attempts,
+		Error:     cause.Error(),
+	})
+	if err != nil {
+		log.Printf("failed to dead-letter %s: %v", job.VideoID, err)
+		return
 	}
-	return nil
+	item.deadLettered = true
+	_, action := describeError(cause)
+	log.Printf("Dead-lettered %s after %d attempt(s) (%s error, action: %s): %v", job.VideoID, job.Attempts, ClassifyError(cause), action, cause)
 }
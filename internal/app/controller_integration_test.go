@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newScriptedController wires the real yt-dlp downloader and biliup
+// uploader to a fakeRunner, so a sync exercises the retry and file
+// resolution logic end to end without any binaries installed.
+func newScriptedController(t *testing.T, runner *fakeRunner) *Controller {
+	stubExecutables(t, "yt-dlp", "biliup")
+	return &Controller{
+		Downloader: NewYtDlpDownloader(runner, 0, SubtitleOptions{}),
+		Uploader: NewBiliupUploader(BiliupUploaderOptions{
+			CookiePath: writeBilibiliCookie(t),
+			Runner:     runner,
+		}),
+		Store:     newTestStore(t),
+		OutputDir: t.TempDir(),
+		Runner:    runner,
+	}
+}
+
+func listStep(ids ...string) fakeStep {
+	return fakeStep{name: "yt-dlp", contains: []string{"--flat-playlist"}, stdout: strings.Join(ids, "\n") + "\n"}
+}
+
+func downloadStep(id, file string, extra ...string) fakeStep {
+	return fakeStep{
+		name:     "yt-dlp",
+		contains: append([]string{videoURL(id), "after_move:filepath"}, extra...),
+		stdout:   "[yttransfer-progress] " + id + "| 100.0%|2.00MiB/s|00:00\n" + file + "\n",
+		create:   []string{file},
+	}
+}
+
+func uploadStep(file string) fakeStep {
+	return fakeStep{name: "biliup", contains: []string{"upload", file}, stdout: "1.00 MiB/1.00 MiB 100%\n"}
+}
+
+func TestSyncChannelRetriesSABRWithDynamicMPD(t *testing.T) {
+	ctx := context.Background()
+	runner := newFakeRunner(t)
+	c := newScriptedController(t, runner)
+	first := filepath.Join(c.OutputDir, "First.mp4")
+	second := filepath.Join(c.OutputDir, "Second.mp4")
+	runner.script = []fakeStep{
+		listStep("vid1", "vid2"),
+		{
+			name:     "yt-dlp",
+			contains: []string{videoURL("vid1")},
+			stderr:   "WARNING: [youtube] vid1: Some web client https formats have been skipped as they are missing a url. YouTube is forcing SABR streaming for this client.\nERROR: fragment 1 not found, unable to continue\n",
+			exitCode: 1,
+		},
+		downloadStep("vid1", first, "--allow-dynamic-mpd", "--concurrent-fragments"),
+		uploadStep(first),
+		downloadStep("vid2", second),
+		uploadStep(second),
+	}
+
+	result, err := c.SyncChannel(ctx, "UC123", 2)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Downloaded != 2 || result.Uploaded != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for _, cmd := range runner.commands() {
+		if hasArg(cmd.Args, videoURL("vid2")) && hasArg(cmd.Args, "--allow-dynamic-mpd") {
+			t.Fatalf("SABR fallback leaked into the next download: %v", cmd.Args)
+		}
+	}
+	for _, id := range []string{"vid1", "vid2"} {
+		job, err := c.Store.GetJob(ctx, id)
+		if err != nil || job.State != JobUploaded || job.ChannelID != "UC123" {
+			t.Fatalf("job %s: %+v, %v", id, job, err)
+		}
+	}
+}
+
+func TestSyncChannelDoesNotRetryPlainFailures(t *testing.T) {
+	runner := newFakeRunner(t)
+	c := newScriptedController(t, runner)
+	runner.script = []fakeStep{
+		listStep("vid1"),
+		{name: "yt-dlp", contains: []string{videoURL("vid1")}, stderr: "ERROR: [youtube] vid1: Video unavailable\n", exitCode: 1},
+	}
+
+	result, err := c.SyncChannel(context.Background(), "UC123", 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Failed != 1 || !strings.Contains(result.Videos[0].Error, "yt-dlp failed") {
+		t.Fatalf("expected yt-dlp failure, got %+v", result)
+	}
+	// Unavailable videos fail the same way every time: they are dead-lettered
+	// right away and flagged for the operator.
+	if v := result.Videos[0]; v.ErrorKind != YtDlpUnavailable || v.Action != ActionGiveUp || !v.DeadLettered {
+		t.Fatalf("unexpected outcome: %+v", v)
+	}
+	job, _ := c.Store.GetJob(context.Background(), "vid1")
+	if job == nil || job.State != JobFailed || job.Attempts != 1 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
+
+func TestSyncChannelResolvesNAPaths(t *testing.T) {
+	runner := newFakeRunner(t)
+	c := newScriptedController(t, runner)
+	file := filepath.Join(c.OutputDir, "Clip.mp4")
+	runner.script = []fakeStep{
+		listStep("vid1"),
+		// With some extractors yt-dlp prints NA for after_move:filepath
+		// even though the file was written.
+		{name: "yt-dlp", contains: []string{videoURL("vid1")}, stdout: "NA\n", create: []string{file}},
+		{name: "yt-dlp", contains: []string{"--no-download", "filename", videoURL("vid1")}, stdout: "NA\n" + file + "\n"},
+		uploadStep(file),
+	}
+
+	result, err := c.SyncChannel(context.Background(), "UC123", 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Uploaded != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestSyncChannelFailsWhenNAPathCannotBeResolved(t *testing.T) {
+	runner := newFakeRunner(t)
+	c := newScriptedController(t, runner)
+	runner.script = []fakeStep{
+		listStep("vid1"),
+		{name: "yt-dlp", contains: []string{videoURL("vid1")}, stdout: "NA\n"},
+		{name: "yt-dlp", contains: []string{"--no-download"}, stdout: filepath.Join(c.OutputDir, "missing.mp4") + "\n"},
+	}
+
+	result, err := c.SyncChannel(context.Background(), "UC123", 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Failed != 1 || !strings.Contains(result.Videos[0].Error, "no files downloaded") {
+		t.Fatalf("expected missing file error, got %+v", result)
+	}
+}
+
+func TestSyncChannelUploadFailureResumesWithoutDownloading(t *testing.T) {
+	ctx := context.Background()
+	runner := newFakeRunner(t)
+	c := newScriptedController(t, runner)
+	file := filepath.Join(c.OutputDir, "Clip.mp4")
+	runner.script = []fakeStep{
+		listStep("vid1"),
+		downloadStep("vid1", file),
+		{name: "biliup", contains: []string{file}, stderr: "Error: 稿件投递失败 code 21070\n", exitCode: 2},
+	}
+
+	result, err := c.SyncChannel(ctx, "UC123", 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Failed != 1 || !strings.Contains(result.Videos[0].Error, "biliup upload failed") {
+		t.Fatalf("expected upload failure, got %+v", result)
+	}
+	job, _ := c.Store.GetJob(ctx, "vid1")
+	if job.State != JobFailed || !strings.Contains(job.LastError, "exit status 2") {
+		t.Fatalf("unexpected job after failure: %+v", job)
+	}
+	if uploaded, _ := c.Store.IsUploaded(ctx, "vid1", DefaultPlatform, ""); uploaded {
+		t.Fatal("failed upload marked as uploaded")
+	}
+
+	// The retry must reuse the downloaded file: only the listing and the
+	// upload are scripted.
+	runner.script = []fakeStep{listStep("vid1"), uploadStep(file)}
+	result, err = c.SyncChannel(ctx, "UC123", 1)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if result.Downloaded != 0 || result.Uploaded != 1 {
+		t.Fatalf("unexpected retry result: %+v", result)
+	}
+	job, _ = c.Store.GetJob(ctx, "vid1")
+	if job.State != JobUploaded || job.Attempts != 2 {
+		t.Fatalf("unexpected job after retry: %+v", job)
+	}
+}
@@ -0,0 +1,400 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type stubDownloader struct {
+	ids       []string
+	files     map[string][]string
+	err       error
+	downloads []string
+}
+
+func (d *stubDownloader) ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error) {
+	return d.ids, nil
+}
+
+func (d *stubDownloader) DownloadVideo(ctx context.Context, videoURL, outputDir string, jsRuntime, format string) (DownloadResult, error) {
+	d.downloads = append(d.downloads, videoURL)
+	if d.err != nil {
+		return DownloadResult{}, d.err
+	}
+	files := d.files[videoURL]
+	return DownloadResult{Artifacts: collectArtifacts(files), Metadata: metadataForFiles(files)}, nil
+}
+
+type stubUploader struct {
+	err      error
+	uploads  []string
+	requests []UploadRequest
+}
+
+func (u *stubUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	path := req.Path
+	if u.err != nil {
+		return UploadResult{}, u.err
+	}
+	u.uploads = append(u.uploads, path)
+	u.requests = append(u.requests, req)
+	return UploadResult{RemoteID: "remote-" + filepath.Base(path)}, nil
+}
+
+func TestSyncVideoRecordsFailureAndResumesUpload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(infoJSONPath(path), []byte(`{"id":"vid","title":"Original Title"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	downloader := &stubDownloader{files: map[string][]string{videoURL("vid"): {path}}}
+	uploader := &stubUploader{err: errors.New("upload broke")}
+	c := &Controller{Downloader: downloader, Uploader: uploader, Store: store}
+
+	if err := c.SyncVideo(ctx, "vid"); err == nil {
+		t.Fatal("expected upload error")
+	}
+	job, err := store.GetJob(ctx, "vid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != JobFailed || job.LastError != "upload broke" || job.Attempts != 1 {
+		t.Fatalf("unexpected job after failure: %+v", job)
+	}
+
+	uploader.err = nil
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(downloader.downloads) != 1 {
+		t.Fatalf("expected the download to be reused, got %d downloads", len(downloader.downloads))
+	}
+	if len(uploader.uploads) != 1 || uploader.uploads[0] != path {
+		t.Fatalf("unexpected uploads: %v", uploader.uploads)
+	}
+	if meta := uploader.requests[0].Metadata; meta == nil || meta.Title != "Original Title" {
+		t.Fatalf("expected metadata to be reloaded from info.json, got %+v", meta)
+	}
+	job, _ = store.GetJob(ctx, "vid")
+	if job.State != JobUploaded || job.Attempts != 2 {
+		t.Fatalf("unexpected job after resume: %+v", job)
+	}
+	if uploaded, _ := store.IsUploaded(ctx, "vid", DefaultPlatform, ""); !uploaded {
+		t.Fatal("expected video to be marked uploaded")
+	}
+}
+
+func TestSyncChannelResumesPendingJobs(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := store.SaveJob(ctx, &VideoJob{VideoID: "old", ChannelID: "chan", State: JobDownloading}); err != nil {
+		t.Fatal(err)
+	}
+
+	downloader := &stubDownloader{
+		ids: []string{"new"},
+		files: map[string][]string{
+			videoURL("new"): {"new.mp4"},
+			videoURL("old"): {"old.mp4"},
+		},
+	}
+	uploader := &stubUploader{}
+	c := &Controller{Downloader: downloader, Uploader: uploader, Store: store}
+
+	res, err := c.SyncChannel(ctx, "chan", 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res.Considered != 2 || res.Uploaded != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestSyncVideoPassesThumbnailAsCover(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	video := filepath.Join(dir, "clip.mp4")
+	thumb := filepath.Join(dir, "clip.jpg")
+	for _, path := range []string{video, thumb} {
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// yt-dlp may print the thumbnail path too; it must not be uploaded as a video.
+	downloader := &stubDownloader{files: map[string][]string{videoURL("vid"): {video, thumb}}}
+	uploader := &stubUploader{}
+	c := &Controller{Downloader: downloader, Uploader: uploader, Store: newTestStore(t)}
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploader.requests) != 1 {
+		t.Fatalf("expected one upload, got %+v", uploader.requests)
+	}
+	if req := uploader.requests[0]; req.Path != video || req.Cover != thumb {
+		t.Fatalf("unexpected upload request: %+v", req)
+	}
+}
+
+func TestSyncVideoPassesCCSubtitles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	video := filepath.Join(dir, "clip.mp4")
+	for _, name := range []string{"clip.mp4", "clip.en.srt", "clip.zh-Hans.srt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	downloader := &stubDownloader{files: map[string][]string{videoURL("vid"): {video}}}
+	uploader := &stubUploader{}
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   uploader,
+		Store:      newTestStore(t),
+		Subtitles:  SubtitleOptions{Mode: SubtitlesCC, Languages: []string{"zh-Hans", "en"}},
+	}
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatal(err)
+	}
+	subs := uploader.requests[0].Subtitles
+	if len(subs) != 2 || subs[0].Language != "zh-Hans" || subs[1].Language != "en" {
+		t.Fatalf("unexpected subtitles: %+v", subs)
+	}
+}
+
+func TestSyncChannelAppliesSubscriptionTemplates(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	templates := MetadataTemplates{Title: "[搬运] {{.Title}}", Tags: "music"}
+	if err := store.AddSubscription(ctx, Subscription{ChannelID: "UC1", Limit: 1, Templates: templates, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	downloader := &stubDownloader{ids: []string{"vid"}, files: map[string][]string{videoURL("vid"): {video}}}
+	uploader := &stubUploader{}
+	c := &Controller{Downloader: downloader, Uploader: uploader, Store: store}
+	if _, err := c.SyncChannel(ctx, "UC1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploader.requests) != 1 || uploader.requests[0].Templates == nil || *uploader.requests[0].Templates != templates {
+		t.Fatalf("expected subscription templates on the upload, got %+v", uploader.requests)
+	}
+}
+
+func TestSyncChannelFansOutToDestinations(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	downloader := &stubDownloader{ids: []string{"vid"}, files: map[string][]string{videoURL("vid"): {path}}}
+	bilibili := &stubUploader{}
+	douyin := &stubUploader{err: errors.New("douyin is down")}
+	c := &Controller{Downloader: downloader, Store: store, Destinations: []Destination{
+		{Platform: "bilibili", Uploader: bilibili},
+		{Platform: "douyin", Account: "alt", Uploader: douyin},
+	}}
+
+	res, err := c.SyncChannel(ctx, "chan", 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res.Failed != 1 || res.Videos[0].Error != "douyin:alt: douyin is down" {
+		t.Fatalf("expected the douyin upload to fail the video, got %+v", res)
+	}
+	if uploaded, _ := store.IsUploaded(ctx, "vid", "bilibili", ""); !uploaded {
+		t.Fatal("expected the bilibili upload to be recorded despite the douyin failure")
+	}
+
+	douyin.err = nil
+	res, err = c.SyncChannel(ctx, "chan", 1)
+	if err != nil || res.Uploaded != 1 || res.Failed != 0 {
+		t.Fatalf("unexpected retry result: %+v, %v", res, err)
+	}
+	if len(bilibili.uploads) != 1 || len(douyin.uploads) != 1 || len(downloader.downloads) != 1 {
+		t.Fatalf("expected only douyin to be retried from the first download, got bilibili %v, douyin %v, downloads %v",
+			bilibili.uploads, douyin.uploads, downloader.downloads)
+	}
+	uploads, err := store.Uploads(ctx, "vid")
+	if err != nil || len(uploads) != 2 || uploads[1].Platform != "douyin" || uploads[1].Account != "alt" || uploads[1].RemoteID != "remote-video.mp4" {
+		t.Fatalf("unexpected upload records: %+v, %v", uploads, err)
+	}
+
+	// A destination added later gets the already uploaded video too.
+	xigua := &stubUploader{}
+	c.Destinations = append(c.Destinations, Destination{Platform: "xigua", Uploader: xigua})
+	if res, err := c.SyncChannel(ctx, "chan", 1); err != nil || res.Uploaded != 1 || len(xigua.uploads) != 1 {
+		t.Fatalf("expected the new destination to receive the video, got %+v, %v", res, err)
+	}
+	if res, err := c.SyncChannel(ctx, "chan", 1); err != nil || res.Skipped != 1 {
+		t.Fatalf("expected the video to be skipped once every destination has it, got %+v, %v", res, err)
+	}
+}
+
+func TestSyncChannelUsesSubscriptionPlatforms(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := store.AddSubscription(ctx, Subscription{ChannelID: "UC1", Limit: 1, Platforms: []string{"douyin"}, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	downloader := &stubDownloader{ids: []string{"vid"}, files: map[string][]string{videoURL("vid"): {video}}}
+	bilibili := &stubUploader{}
+	c := &Controller{Downloader: downloader, Uploader: bilibili, Store: store}
+	if _, err := c.SyncChannel(ctx, "UC1", 1); err == nil {
+		t.Fatal("expected an error for a platform without an uploader")
+	}
+
+	douyin := &stubUploader{}
+	c.ResolveDestination = func(name string) (Destination, error) {
+		return Destination{Platform: name, Uploader: douyin}, nil
+	}
+	if res, err := c.SyncChannel(ctx, "UC1", 1); err != nil || res.Uploaded != 1 {
+		t.Fatalf("unexpected result: %+v, %v", res, err)
+	}
+	if len(bilibili.uploads) != 0 || len(douyin.uploads) != 1 {
+		t.Fatalf("expected only the subscription platform, got bilibili %v, douyin %v", bilibili.uploads, douyin.uploads)
+	}
+	if uploaded, _ := store.IsUploaded(ctx, "vid", "douyin", ""); !uploaded {
+		t.Fatal("expected the douyin upload to be recorded")
+	}
+}
+
+func TestSyncVideoUsesSubscriptionPlatformsOfInfoJSONChannel(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := store.AddSubscription(ctx, Subscription{ChannelID: "UC1", Limit: 1, Platforms: []string{"douyin"}, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(infoJSONPath(video), []byte(`{"id":"vid","title":"Clip","channel_id":"UC1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	downloader := &stubDownloader{files: map[string][]string{videoURL("vid"): {video}}}
+	bilibili, douyin := &stubUploader{}, &stubUploader{}
+	c := &Controller{Downloader: downloader, Uploader: bilibili, Store: store, ResolveDestination: func(name string) (Destination, error) {
+		return Destination{Platform: name, Uploader: douyin}, nil
+	}}
+
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(bilibili.uploads) != 0 || len(douyin.uploads) != 1 {
+		t.Fatalf("expected only the subscription platform, got bilibili %v, douyin %v", bilibili.uploads, douyin.uploads)
+	}
+	job, err := store.GetJob(ctx, "vid")
+	if err != nil || job.ChannelID != "UC1" || job.State != JobUploaded {
+		t.Fatalf("expected the job to take the info.json channel, got %+v, %v", job, err)
+	}
+
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if len(downloader.downloads) != 1 || len(douyin.uploads) != 1 {
+		t.Fatalf("expected the second sync to find nothing to do, got downloads %v, uploads %v", downloader.downloads, douyin.uploads)
+	}
+}
+
+func TestSyncVideoRetriesOnlyFailedDestinations(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	downloader := &stubDownloader{files: map[string][]string{videoURL("vid"): {video}}}
+	bilibili := &scriptedUploader{}
+	douyin := &scriptedUploader{errs: []error{errors.New("timeout"), errors.New("timeout")}}
+	c := &Controller{Downloader: downloader, Store: store, Retry: RetryPolicy{MaxAttempts: 3}, Destinations: []Destination{
+		{Platform: "bilibili", Uploader: bilibili},
+		{Platform: "douyin", Uploader: douyin},
+	}}
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if bilibili.calls != 1 || douyin.calls != 3 {
+		t.Fatalf("expected only douyin to be retried, got %d bilibili and %d douyin uploads", bilibili.calls, douyin.calls)
+	}
+	uploads, err := store.Uploads(ctx, "vid")
+	if err != nil || len(uploads) != 2 || uploads[0].RemoteID != "id-"+video {
+		t.Fatalf("unexpected upload records: %+v, %v", uploads, err)
+	}
+}
+
+// partUploader fails uploads of the file named fail and records the rest.
+type partUploader struct {
+	fail    string
+	uploads []string
+}
+
+func (u *partUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	name := filepath.Base(req.Path)
+	if name == u.fail {
+		return UploadResult{}, errors.New("connection reset")
+	}
+	u.uploads = append(u.uploads, name)
+	return UploadResult{RemoteID: "id-" + name}, nil
+}
+
+func TestSyncChannelResumesPartialMultiFileUpload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"v.part1.mp4", "v.part2.mp4"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	downloader := &stubDownloader{ids: []string{"vid"}, files: map[string][]string{videoURL("vid"): files}}
+	bilibili := &partUploader{}
+	douyin := &partUploader{fail: "v.part2.mp4"}
+	c := &Controller{Downloader: downloader, Store: store, Retry: RetryPolicy{MaxAttempts: 1}, Destinations: []Destination{
+		{Platform: "bilibili", Uploader: bilibili},
+		{Platform: "douyin", Uploader: douyin},
+	}}
+
+	if res, err := c.SyncChannel(ctx, "chan", 1); err != nil || res.Failed != 1 {
+		t.Fatalf("expected the second douyin part to fail the video, got %+v, %v", res, err)
+	}
+	if uploaded, _ := store.IsUploaded(ctx, "vid", "douyin", ""); uploaded {
+		t.Fatal("a partly uploaded destination must not count as uploaded")
+	}
+	uploads, err := store.Uploads(ctx, "vid")
+	if err != nil || len(uploads) != 2 || !uploads[1].Partial || uploads[1].RemoteID != "id-v.part1.mp4" {
+		t.Fatalf("expected a partial douyin record with the first part, got %+v, %v", uploads, err)
+	}
+
+	douyin.fail = ""
+	if res, err := c.SyncChannel(ctx, "chan", 1); err != nil || res.Failed != 0 {
+		t.Fatalf("unexpected retry result: %+v, %v", res, err)
+	}
+	if len(bilibili.uploads) != 2 || len(douyin.uploads) != 2 || douyin.uploads[1] != "v.part2.mp4" {
+		t.Fatalf("expected douyin to get only the missing part, got bilibili %v, douyin %v", bilibili.uploads, douyin.uploads)
+	}
+	uploads, err = store.Uploads(ctx, "vid")
+	if err != nil || uploads[1].Partial || uploads[1].RemoteID != "id-v.part1.mp4,id-v.part2.mp4" {
+		t.Fatalf("expected the douyin upload to be complete, got %+v, %v", uploads, err)
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CoverOptions controls how a downloaded thumbnail is turned into an
+// upload cover. The zero value uses the thumbnail as is.
+type CoverOptions struct {
+	// AspectRatio such as "16:10" center-crops the thumbnail to that ratio.
+	AspectRatio string
+	// Width scales the cover to this many pixels wide, keeping its ratio.
+	Width int
+}
+
+func (o CoverOptions) enabled() bool {
+	return o.AspectRatio != "" || o.Width > 0
+}
+
+// Validate reports malformed options.
+func (o CoverOptions) Validate() error {
+	if o.AspectRatio != "" {
+		if _, _, err := parseAspectRatio(o.AspectRatio); err != nil {
+			return err
+		}
+	}
+	if o.Width < 0 {
+		return fmt.Errorf("cover width must be >= 0")
+	}
+	return nil
+}
+
+// PrepareCover crops and scales src with ffmpeg according to opts and
+// writes the result as <name>.cover.jpg next to it. It returns src
+// unchanged when opts is the zero value. A nil runner uses ExecRunner.
+func PrepareCover(ctx context.Context, runner CommandRunner, src string, opts CoverOptions) (string, error) {
+	if !opts.enabled() {
+		return src, nil
+	}
+	var filters []string
+	if opts.AspectRatio != "" {
+		w, h, err := parseAspectRatio(opts.AspectRatio)
+		if err != nil {
+			return "", err
+		}
+		filters = append(filters, fmt.Sprintf("crop='min(iw,ih*%d/%d)':'min(ih,iw*%d/%d)'", w, h, h, w))
+	}
+	if opts.Width > 0 {
+		filters = append(filters, fmt.Sprintf("scale=%d:-2", opts.Width))
+	}
+	dst := strings.TrimSuffix(src, filepath.Ext(src)) + ".cover.jpg"
+	args := []string{"-y", "-loglevel", "error", "-i", src, "-vf", strings.Join(filters, ","), "-frames:v", "1", dst}
+	if out, err := combinedOutput(ctx, runner, "ffmpeg", args...); err != nil {
+		return "", fmt.Errorf("ffmpeg cover conversion failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return dst, nil
+}
+
+func parseAspectRatio(value string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) == 2 {
+		w, errW := strconv.Atoi(strings.TrimSpace(parts[0]))
+		h, errH := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errW == nil && errH == nil && w > 0 && h > 0 {
+			return w, h, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid cover aspect ratio %q; use W:H such as 16:10", value)
+}
@@ -1,14 +1,12 @@
 package app
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -16,15 +14,49 @@ import (
 
 type Downloader interface {
 	ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error)
-	DownloadVideo(ctx context.Context, videoURL, outputDir string, jsRuntime, format string) ([]string, error)
+	DownloadVideo(ctx context.Context, videoURL, outputDir string, jsRuntime, format string) (DownloadResult, error)
+}
+
+// DownloadResult lists the artifacts a download produced together with
+// the original video's metadata, when yt-dlp wrote an info.json for it.
+type DownloadResult struct {
+	Artifacts []Artifact
+	Metadata  *VideoMetadata
+}
+
+// Videos returns the paths of the downloaded video files.
+func (r DownloadResult) Videos() []string {
+	return r.paths(ArtifactVideo)
+}
+
+// Thumbnail returns the downloaded thumbnail, or "" when there is none.
+func (r DownloadResult) Thumbnail() string {
+	if paths := r.paths(ArtifactThumbnail); len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+func (r DownloadResult) paths(kind ArtifactKind) []string {
+	var paths []string
+	for _, a := range r.Artifacts {
+		if a.Kind == kind {
+			paths = append(paths, a.Path)
+		}
+	}
+	return paths
 }
 
 type YtDlpDownloader struct {
-	sleep time.Duration
+	runner    CommandRunner
+	sleep     time.Duration
+	subtitles SubtitleOptions
 }
 
-func NewYtDlpDownloader(sleep time.Duration) *YtDlpDownloader {
-	return &YtDlpDownloader{sleep: sleep}
+// NewYtDlpDownloader returns a downloader that runs yt-dlp through runner
+// (ExecRunner when nil).
+func NewYtDlpDownloader(runner CommandRunner, sleep time.Duration, subtitles SubtitleOptions) *YtDlpDownloader {
+	return &YtDlpDownloader{runner: runnerOrDefault(runner), sleep: sleep, subtitles: subtitles}
 }
 
 func (d *YtDlpDownloader) ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error) {
@@ -43,7 +75,7 @@ func (d *YtDlpDownloader) ListChannelVideoIDs(ctx context.Context, channelURL st
 	if jsRuntime != "" {
 		args = append(args[:len(args)-1], "--js-runtimes", jsRuntime, channelURL)
 	}
-	lines, err := runYtDlpLines(ctx, args)
+	lines, err := runYtDlpLines(ctx, d.runner, args)
 	if err != nil {
 		return nil, err
 	}
@@ -57,17 +89,24 @@ func (d *YtDlpDownloader) ListChannelVideoIDs(ctx context.Context, channelURL st
 }
 
 // TODO: can return NA as path
-func (d *YtDlpDownloader) DownloadVideo(ctx context.Context, videoURL, outputDir string, jsRuntime, format string) ([]string, error) {
+func (d *YtDlpDownloader) DownloadVideo(ctx context.Context, videoURL, outputDir string, jsRuntime, format string) (DownloadResult, error) {
 	outputTemplate := filepath.Join(outputDir, "%(title)s.%(ext)s")
 	baseArgs := []string{
 		"--quiet",
 		"--no-warnings",
 		"--no-simulate",
+		"--write-info-json",
+		"--write-thumbnail",
 		"--remote-components", "ejs:github",
 		"-o", outputTemplate,
 	}
+	baseArgs = append(baseArgs, ytDlpProgressArgs()...)
+	baseArgs = append(baseArgs, d.subtitles.ytDlpArgs(HasExecutable("ffmpeg"))...)
 	if HasExecutable("ffmpeg") {
-		baseArgs = append(baseArgs, "--print", "after_postprocess:filepath")
+		baseArgs = append(baseArgs,
+			"--convert-thumbnails", "jpg",
+			"--print", "after_postprocess:filepath",
+		)
 	} else {
 		baseArgs = append(baseArgs, "--print", "after_move:filepath")
 	}
@@ -89,7 +128,7 @@ func (d *YtDlpDownloader) DownloadVideo(ctx context.Context, videoURL, outputDir
 		args = append(args, baseArgs...)
 		args = append(args, extra...)
 		args = append(args, videoURL)
-		return runYtDlp(ctx, args)
+		return runYtDlp(ctx, d.runner, args)
 	}
 
 	res, err := runWithExtras(nil)
@@ -98,24 +137,25 @@ func (d *YtDlpDownloader) DownloadVideo(ctx context.Context, videoURL, outputDir
 		res, err = runWithExtras([]string{"--allow-dynamic-mpd", "--concurrent-fragments", "1"})
 	}
 	if err != nil {
-		return filterDownloadedFiles(res.files), fmt.Errorf("yt-dlp failed: %w", err)
+		return DownloadResult{Artifacts: collectArtifacts(filterDownloadedFiles(res.files))}, newYtDlpError(res.stderr, err)
 	}
 
 	files := filterDownloadedFiles(res.files)
 	if len(files) == 0 {
-		existing, lookupErr := resolveExistingFiles(ctx, videoURL, outputTemplate, jsRuntime, format)
+		existing, lookupErr := resolveExistingFiles(ctx, d.runner, videoURL, outputTemplate, jsRuntime, format)
 		if lookupErr == nil && len(existing) > 0 {
-			return existing, nil
+			files = existing
 		}
 	}
-	return files, nil
+	result := DownloadResult{Artifacts: collectArtifacts(files)}
+	result.Metadata = metadataForFiles(result.Videos())
+	return result, nil
 }
 
-func runYtDlpLines(ctx context.Context, args []string) ([]string, error) {
-	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
-	output, err := cmd.CombinedOutput()
+func runYtDlpLines(ctx context.Context, runner CommandRunner, args []string) ([]string, error) {
+	output, err := combinedOutput(ctx, runner, "yt-dlp", args...)
 	if err != nil {
-		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+		return nil, newYtDlpError(string(output), err)
 	}
 	lines := []string{}
 	for _, line := range strings.Split(string(output), "\n") {
@@ -132,37 +172,39 @@ type ytDlpResult struct {
 	stderr string
 }
 
-func runYtDlp(ctx context.Context, args []string) (ytDlpResult, error) {
-	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return ytDlpResult{}, err
-	}
-	var stderrBuf bytes.Buffer
-	cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
-
-	if err := cmd.Start(); err != nil {
-		return ytDlpResult{}, err
-	}
-
+func runYtDlp(ctx context.Context, runner CommandRunner, args []string) (ytDlpResult, error) {
 	var files []string
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	stdoutLines := newLineWriter(func(line string) {
+		line = strings.TrimSpace(line)
+		if ev, ok := parseYtDlpProgress(line); ok {
+			reportProgress(ctx, ev)
+			return
+		}
 		if line != "" {
 			files = append(files, line)
 		}
-	}
-	if scanErr := scanner.Err(); scanErr != nil {
-		return ytDlpResult{files: files, stderr: stderrBuf.String()}, scanErr
-	}
-	if err := cmd.Wait(); err != nil {
-		return ytDlpResult{files: files, stderr: stderrBuf.String()}, err
-	}
-	return ytDlpResult{files: files, stderr: stderrBuf.String()}, nil
+	})
+	var stderrBuf bytes.Buffer
+	stderrLines := newLineWriter(func(line string) {
+		if ev, ok := parseYtDlpProgress(line); ok {
+			reportProgress(ctx, ev)
+			return
+		}
+		fmt.Fprintln(os.Stderr, line)
+	})
+
+	err := runner.Run(ctx, Command{
+		Name:   "yt-dlp",
+		Args:   args,
+		Stdout: stdoutLines,
+		Stderr: io.MultiWriter(&stderrBuf, stderrLines),
+	})
+	stdoutLines.Flush()
+	stderrLines.Flush()
+	return ytDlpResult{files: files, stderr: stderrBuf.String()}, err
 }
 
-func resolveExistingFiles(ctx context.Context, videoURL, outputTemplate, jsRuntime, format string) ([]string, error) {
+func resolveExistingFiles(ctx context.Context, runner CommandRunner, videoURL, outputTemplate, jsRuntime, format string) ([]string, error) {
 	args := []string{
 		"--quiet",
 		"--no-warnings",
@@ -179,7 +221,7 @@ func resolveExistingFiles(ctx context.Context, videoURL, outputTemplate, jsRunti
 	}
 	args = append(args, videoURL)
 
-	lines, err := runYtDlpLines(ctx, args)
+	lines, err := runYtDlpLines(ctx, runner, args)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DestinationResult is the outcome of one upload to one destination.
+type DestinationResult struct {
+	Destination Destination
+	Result      UploadResult
+	Err         error
+}
+
+// FanOutError lists the destinations a fan-out upload failed for; every
+// other destination succeeded. It is permanent only when all failures are.
+type FanOutError struct {
+	Failures []DestinationResult
+}
+
+func (e *FanOutError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Destination.String() + ": " + f.Err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *FanOutError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+func (e *FanOutError) permanent() bool {
+	for _, f := range e.Failures {
+		if ClassifyError(f.Err) != ErrorPermanent {
+			return false
+		}
+	}
+	return true
+}
+
+// FanOutUploader is an Uploader that publishes every request to several
+// destinations concurrently. Destinations that fail transiently are retried
+// according to Retry; the ones that succeeded are never sent the file
+// again. The controller runs one fan-out per file and attempt, with a zero
+// Retry, so that its own retries are counted on the video's job.
+type FanOutUploader struct {
+	Destinations []Destination
+	Retry        RetryPolicy
+}
+
+// Upload sends req to every destination. The combined result carries the
+// remote IDs comma-separated and the first URL. When some destinations
+// fail, the partial result is returned along with a *FanOutError.
+func (u *FanOutUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	results, err := u.UploadEach(ctx, req)
+	var combined UploadResult
+	var ids []string
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if r.Result.RemoteID != "" {
+			ids = append(ids, r.Result.RemoteID)
+		}
+		if combined.URL == "" {
+			combined.URL = r.Result.URL
+		}
+	}
+	combined.RemoteID = strings.Join(ids, ",")
+	return combined, err
+}
+
+// UploadEach sends req to every destination and returns one result per
+// destination, in the order of Destinations. The error is a *FanOutError
+// for the destinations that still failed after the retries.
+func (u *FanOutUploader) UploadEach(ctx context.Context, req UploadRequest) ([]DestinationResult, error) {
+	if len(u.Destinations) == 0 {
+		return nil, errFanOutEmpty
+	}
+	results := make([]DestinationResult, len(u.Destinations))
+	todo := make([]int, len(u.Destinations))
+	for i, dest := range u.Destinations {
+		results[i].Destination = dest
+		todo[i] = i
+	}
+	maxAttempts := u.Retry.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		dests := make([]Destination, len(todo))
+		for i, idx := range todo {
+			dests[i] = u.Destinations[idx]
+		}
+		var retry []int
+		for i, r := range uploadRound(ctx, req, dests) {
+			results[todo[i]] = r
+			if r.Err != nil && ClassifyError(r.Err) != ErrorPermanent && !errors.Is(r.Err, ErrNotLoggedIn) {
+				retry = append(retry, todo[i])
+			}
+		}
+		if len(retry) == 0 || ctx.Err() != nil || attempt >= maxAttempts {
+			break
+		}
+		todo = retry
+		delay := u.Retry.backoff(attempt)
+		log.Printf("upload of %s failed for %d destination(s) (attempt %d/%d), retrying them in %s", req.Path, len(todo), attempt, maxAttempts, delay.Round(time.Millisecond))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	return results, failures(results)
+}
+
+// failures returns a *FanOutError for the failed results, or nil.
+func failures(results []DestinationResult) error {
+	var failed []DestinationResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &FanOutError{Failures: failed}
+}
+
+// errFanOutEmpty is returned when a fan-out has nowhere to upload to.
+var errFanOutEmpty = errors.New("no upload destinations configured")
+
+// uploadRound uploads req to every destination at once and waits for all
+// of them.
+func uploadRound(ctx context.Context, req UploadRequest, dests []Destination) []DestinationResult {
+	results := make([]DestinationResult, len(dests))
+	var wg sync.WaitGroup
+	for i, dest := range dests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := dest.Uploader.Upload(ctx, req)
+			results[i] = DestinationResult{Destination: dest, Result: res, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
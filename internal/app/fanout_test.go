@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedUploader fails with the queued errors in order, then succeeds.
+type scriptedUploader struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (u *scriptedUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls++
+	if len(u.errs) > 0 {
+		err := u.errs[0]
+		u.errs = u.errs[1:]
+		return UploadResult{}, err
+	}
+	return UploadResult{RemoteID: "id-" + req.Path, URL: "https://example.com/" + req.Path}, nil
+}
+
+func TestFanOutUploaderRetriesOnlyFailedDestinations(t *testing.T) {
+	ok := &scriptedUploader{}
+	flaky := &scriptedUploader{errs: []error{errors.New("timeout")}}
+	broken := &scriptedUploader{errs: []error{Permanent(errors.New("title rejected"))}}
+	u := &FanOutUploader{
+		Destinations: []Destination{
+			{Platform: "bilibili", Uploader: ok},
+			{Platform: "douyin", Uploader: flaky},
+			{Platform: "xigua", Account: "alt", Uploader: broken},
+		},
+		Retry: RetryPolicy{MaxAttempts: 3},
+	}
+
+	results, err := u.UploadEach(context.Background(), UploadRequest{Path: "v.mp4"})
+	var fan *FanOutError
+	if !errors.As(err, &fan) || len(fan.Failures) != 1 || err.Error() != "xigua:alt: title rejected" {
+		t.Fatalf("expected only xigua to fail, got %v", err)
+	}
+	if ok.calls != 1 || flaky.calls != 2 || broken.calls != 1 {
+		t.Fatalf("expected only the transient failure to be retried, got %d/%d/%d calls", ok.calls, flaky.calls, broken.calls)
+	}
+	if results[1].Err != nil || results[1].Result.RemoteID != "id-v.mp4" || results[2].Err == nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	res, err := (&FanOutUploader{Destinations: u.Destinations[:2]}).Upload(context.Background(), UploadRequest{Path: "w.mp4"})
+	if err != nil || res.RemoteID != "id-w.mp4,id-w.mp4" || res.URL != "https://example.com/w.mp4" {
+		t.Fatalf("unexpected combined result: %+v, %v", res, err)
+	}
+	if _, err := (&FanOutUploader{}).Upload(context.Background(), UploadRequest{}); err == nil {
+		t.Fatal("expected an error without destinations")
+	}
+}
+
+func TestUploadToDestinationsRetriesOnlyFailedDestinations(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ok := &scriptedUploader{}
+	flaky := &scriptedUploader{errs: []error{errors.New("timeout")}}
+	broken := &scriptedUploader{errs: []error{Permanent(errors.New("title rejected"))}}
+	c := &Controller{
+		Downloader: &stubDownloader{files: map[string][]string{videoURL("vid"): {video}}},
+		Store:      store,
+		Retry:      RetryPolicy{MaxAttempts: 3},
+		Destinations: []Destination{
+			{Platform: "bilibili", Uploader: ok},
+			{Platform: "douyin", Uploader: flaky},
+			{Platform: "xigua", Account: "alt", Uploader: broken},
+		},
+	}
+
+	err := c.SyncVideo(ctx, "vid")
+	var fan *FanOutError
+	if !errors.As(err, &fan) || len(fan.Failures) != 1 || err.Error() != "xigua:alt: title rejected" {
+		t.Fatalf("expected only xigua to fail, got %v", err)
+	}
+	if ClassifyError(err) != ErrorPermanent {
+		t.Fatalf("expected a permanent error when every failure is permanent")
+	}
+	if ok.calls != 1 || flaky.calls != 2 || broken.calls != 1 {
+		t.Fatalf("expected only the transient failure to be retried, got %d/%d/%d calls", ok.calls, flaky.calls, broken.calls)
+	}
+	for _, dest := range []struct {
+		platform, account string
+		want              bool
+	}{{"bilibili", "", true}, {"douyin", "", true}, {"xigua", "alt", false}} {
+		if uploaded, _ := store.IsUploaded(ctx, "vid", dest.platform, dest.account); uploaded != dest.want {
+			t.Fatalf("%s:%s uploaded=%v, want %v", dest.platform, dest.account, uploaded, dest.want)
+		}
+	}
+}
+
+// barrierUploader blocks every upload until release is closed.
+type barrierUploader struct {
+	arrived chan<- struct{}
+	release <-chan struct{}
+}
+
+func (u barrierUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	u.arrived <- struct{}{}
+	select {
+	case <-u.release:
+		return UploadResult{}, nil
+	case <-ctx.Done():
+		return UploadResult{}, ctx.Err()
+	}
+}
+
+func TestUploadToDestinationsUploadsConcurrently(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		// Both uploads have to be in flight before either may finish.
+		<-arrived
+		<-arrived
+		close(release)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	up := barrierUploader{arrived: arrived, release: release}
+	c := &Controller{
+		Downloader:   &stubDownloader{files: map[string][]string{videoURL("vid"): {video}}},
+		Store:        newTestStore(t),
+		Destinations: []Destination{{Platform: "a", Uploader: up}, {Platform: "b", Uploader: up}},
+	}
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatalf("expected both uploads to run at once, got %v", err)
+	}
+}
@@ -3,63 +3,451 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 )
 
 type syncRequest struct {
 	ChannelID string `json:"channel_id"`
+	VideoID   string `json:"video_id"`
 	Limit     int    `json:"limit"`
 }
 
 type syncResponse struct {
-	Considered int    `json:"considered"`
-	Skipped    int    `json:"skipped"`
-	Downloaded int    `json:"downloaded"`
-	Uploaded   int    `json:"uploaded"`
-	Error      string `json:"error,omitempty"`
+	Considered   int                    `json:"considered"`
+	Skipped      int                    `json:"skipped"`
+	Downloaded   int                    `json:"downloaded"`
+	Uploaded     int                    `json:"uploaded"`
+	Failed       int                    `json:"failed"`
+	DeadLettered int                    `json:"dead_lettered"`
+	Videos       []videoOutcomeResponse `json:"videos"`
 }
 
-func ServeHTTP(addr string, controller *Controller) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
+type videoOutcomeResponse struct {
+	VideoID      string   `json:"video_id"`
+	State        string   `json:"state"`
+	Skipped      bool     `json:"skipped,omitempty"`
+	DeadLettered bool     `json:"dead_lettered,omitempty"`
+	RemoteIDs    []string `json:"remote_ids,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	ErrorKind    string   `json:"error_kind,omitempty"`
+	Action       string   `json:"action,omitempty"`
+}
+
+type deadLetterResponse struct {
+	VideoID   string    `json:"video_id"`
+	ChannelID string    `json:"channel_id"`
+	Stage     string    `json:"stage"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// subscriptionRequest is the body of POST /subscriptions (channel_id and
+// limit required) and PATCH /subscriptions/{id} (only the fields present
+// are changed).
+type subscriptionRequest struct {
+	ChannelID           string    `json:"channel_id"`
+	Platforms           *[]string `json:"platforms"`
+	Limit               *int      `json:"limit"`
+	Schedule            *string   `json:"schedule"`
+	TitleTemplate       *string   `json:"title_template"`
+	DescriptionTemplate *string   `json:"description_template"`
+	DynamicTemplate     *string   `json:"dynamic_template"`
+	Tags                *string   `json:"tags"`
+	Enabled             *bool     `json:"enabled"`
+}
+
+func (r subscriptionRequest) patch() SubscriptionPatch {
+	return SubscriptionPatch{
+		Platforms:   r.Platforms,
+		Limit:       r.Limit,
+		Schedule:    r.Schedule,
+		Title:       r.TitleTemplate,
+		Description: r.DescriptionTemplate,
+		Dynamic:     r.DynamicTemplate,
+		Tags:        r.Tags,
+		Enabled:     r.Enabled,
+	}
+}
+
+type subscriptionResponse struct {
+	ChannelID           string    `json:"channel_id"`
+	Platforms           []string  `json:"platforms"`
+	Limit               int       `json:"limit"`
+	Schedule            string    `json:"schedule"`
+	TitleTemplate       string    `json:"title_template"`
+	DescriptionTemplate string    `json:"description_template"`
+	DynamicTemplate     string    `json:"dynamic_template"`
+	Tags                string    `json:"tags"`
+	Enabled             bool      `json:"enabled"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+func toSubscriptionResponse(sub Subscription) subscriptionResponse {
+	return subscriptionResponse{
+		ChannelID:           sub.ChannelID,
+		Platforms:           nonNilStrings(sub.Platforms),
+		Limit:               sub.Limit,
+		Schedule:            sub.Schedule,
+		TitleTemplate:       sub.Templates.Title,
+		DescriptionTemplate: sub.Templates.Description,
+		DynamicTemplate:     sub.Templates.Dynamic,
+		Tags:                sub.Templates.Tags,
+		Enabled:             sub.Enabled,
+		CreatedAt:           sub.CreatedAt,
+		UpdatedAt:           sub.UpdatedAt,
+	}
+}
+
+type jobResponse struct {
+	ID         string            `json:"id"`
+	Status     string            `json:"status"`
+	ChannelID  string            `json:"channel_id,omitempty"`
+	VideoID    string            `json:"video_id,omitempty"`
+	Limit      int               `json:"limit,omitempty"`
+	Result     syncResponse      `json:"result"`
+	Error      string            `json:"error,omitempty"`
+	ErrorKind  string            `json:"error_kind,omitempty"`
+	Action     string            `json:"action,omitempty"`
+	Progress   *progressResponse `json:"progress,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+type progressResponse struct {
+	Stage   string    `json:"stage"`
+	VideoID string    `json:"video_id,omitempty"`
+	Percent *float64  `json:"percent,omitempty"`
+	Speed   string    `json:"speed,omitempty"`
+	ETA     string    `json:"eta,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// ServeHTTP runs the controller API on addr. With websub set, the server
+// also subscribes to push notifications for the enabled subscriptions.
+func ServeHTTP(addr string, controller *Controller, websub *WebSubOptions) error {
+	ctx := context.Background()
+	jobs := NewJobManager(controller)
+	go jobs.Run(ctx)
+
+	var subscriber *WebSubSubscriber
+	if websub != nil {
+		if err := websub.Validate(); err != nil {
+			return err
 		}
+		subscriber = NewWebSubSubscriber(*websub, controller.Store, jobs)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if subscriber != nil {
+		// Listen first so the hub's verification requests can get through.
+		go subscriber.Run(ctx)
+	}
+	log.Printf("controller listening on %s", addr)
+	return http.Serve(ln, newHTTPHandler(jobs, subscriber))
+}
+
+func newHTTPHandler(jobs *JobManager, websub *WebSubSubscriber) http.Handler {
+	mux := http.NewServeMux()
+	if websub != nil {
+		websub.register(mux)
+	}
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
 		var req syncRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid JSON body", http.StatusBadRequest)
 			return
 		}
-		if req.ChannelID == "" || req.Limit <= 0 {
-			http.Error(w, "channel_id and positive limit required", http.StatusBadRequest)
+		job, err := jobs.Submit(SyncRequest{ChannelID: req.ChannelID, VideoID: req.VideoID, Limit: req.Limit})
+		switch {
+		case errors.Is(err, ErrJobQueueFull):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, toJobResponse(job))
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		list := jobs.List()
+		payload := make([]jobResponse, 0, len(list))
+		for _, job := range list {
+			payload = append(payload, toJobResponse(job))
+		}
+		writeJSON(w, http.StatusOK, payload)
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := jobs.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, toJobResponse(job))
+	})
+	mux.HandleFunc("GET /dead-letters", func(w http.ResponseWriter, r *http.Request) {
+		list, err := jobs.controller.Store.DeadLetters(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload := make([]deadLetterResponse, 0, len(list))
+		for _, dl := range list {
+			payload = append(payload, deadLetterResponse(dl))
+		}
+		writeJSON(w, http.StatusOK, payload)
+	})
+	mux.HandleFunc("POST /dead-letters/{id}/requeue", func(w http.ResponseWriter, r *http.Request) {
+		ok, err := jobs.controller.Store.Requeue(r.Context(), r.PathValue("id"))
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case !ok:
+			http.Error(w, "video is not dead-lettered", http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	handleSubscriptions(mux, jobs.controller.Store)
+	mux.HandleFunc("GET /jobs/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		events, cancel, ok := jobs.Subscribe(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
 			return
 		}
-
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Minute)
 		defer cancel()
 
-		res, err := controller.SyncChannel(ctx, req.ChannelID, req.Limit)
-		payload := syncResponse{
-			Considered: res.Considered,
-			Skipped:    res.Skipped,
-			Downloaded: res.Downloaded,
-			Uploaded:   res.Uploaded,
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case ev, open := <-events:
+				if !open {
+					return
+				}
+				if err := writeSSE(w, ev); err != nil {
+					log.Printf("failed to write event: %v", err)
+					return
+				}
+			}
+			flusher.Flush()
 		}
+	})
+	return mux
+}
+
+func writeSSE(w http.ResponseWriter, ev JobEvent) error {
+	name := "progress"
+	var payload any
+	if ev.Job != nil {
+		name = "status"
+		payload = toJobResponse(*ev.Job)
+	} else {
+		payload = toProgressResponse(*ev.Progress)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+func handleSubscriptions(mux *http.ServeMux, store Store) {
+	mux.HandleFunc("GET /subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		subs, err := store.ListSubscriptions(r.Context())
 		if err != nil {
-			payload.Error = err.Error()
-			w.WriteHeader(http.StatusInternalServerError)
-		} else {
-			w.WriteHeader(http.StatusOK)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload := make([]subscriptionResponse, 0, len(subs))
+		for _, sub := range subs {
+			payload = append(payload, toSubscriptionResponse(sub))
+		}
+		writeJSON(w, http.StatusOK, payload)
+	})
+	mux.HandleFunc("GET /subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sub, err := store.GetSubscription(r.Context(), r.PathValue("id"))
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case sub == nil:
+			http.Error(w, "subscription not found", http.StatusNotFound)
+		default:
+			writeJSON(w, http.StatusOK, toSubscriptionResponse(*sub))
+		}
+	})
+	mux.HandleFunc("POST /subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var req subscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		sub := req.patch().Apply(Subscription{ChannelID: req.ChannelID, Enabled: true})
+		if err := sub.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := store.AddSubscription(r.Context(), sub)
+		switch {
+		case errors.Is(err, ErrSubscriptionExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saved, err := store.GetSubscription(r.Context(), sub.ChannelID)
+		if err != nil || saved == nil {
+			http.Error(w, fmt.Sprintf("reading subscription back: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "/subscriptions/"+sub.ChannelID)
+		writeJSON(w, http.StatusCreated, toSubscriptionResponse(*saved))
+	})
+	mux.HandleFunc("PATCH /subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req subscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		id := r.PathValue("id")
+		if req.ChannelID != "" && req.ChannelID != id {
+			http.Error(w, "channel_id cannot be changed", http.StatusBadRequest)
+			return
+		}
+		sub, err := store.GetSubscription(r.Context(), id)
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		case sub == nil:
+			http.Error(w, "subscription not found", http.StatusNotFound)
+			return
+		}
+		updated := req.patch().Apply(*sub)
+		if err := updated.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(payload); err != nil {
-			log.Printf("failed to write response: %v", err)
+		if _, err := store.UpdateSubscription(r.Context(), updated); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saved, err := store.GetSubscription(r.Context(), id)
+		if err != nil || saved == nil {
+			http.Error(w, fmt.Sprintf("reading subscription back: %v", err), http.StatusInternalServerError)
+			return
 		}
+		writeJSON(w, http.StatusOK, toSubscriptionResponse(*saved))
 	})
+	mux.HandleFunc("DELETE /subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ok, err := store.DeleteSubscription(r.Context(), r.PathValue("id"))
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case !ok:
+			http.Error(w, "subscription not found", http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
 
-	log.Printf("controller listening on %s", addr)
-	return http.ListenAndServe(addr, mux)
+func toProgressResponse(ev ProgressEvent) *progressResponse {
+	payload := &progressResponse{
+		Stage:   string(ev.Stage),
+		VideoID: ev.VideoID,
+		Speed:   ev.Speed,
+		ETA:     ev.ETA,
+		Message: ev.Message,
+		Time:    ev.Time,
+	}
+	if ev.Percent >= 0 {
+		percent := ev.Percent
+		payload.Percent = &percent
+	}
+	return payload
+}
+
+func toJobResponse(job SyncJob) jobResponse {
+	res := job.Result
+	payload := jobResponse{
+		ID:        job.ID,
+		Status:    string(job.Status),
+		ChannelID: job.Request.ChannelID,
+		VideoID:   job.Request.VideoID,
+		Limit:     job.Request.Limit,
+		Error:     job.Error,
+		ErrorKind: string(job.ErrorKind),
+		Action:    string(job.Action),
+		CreatedAt: job.CreatedAt,
+		Result: syncResponse{
+			Considered:   res.Considered,
+			Skipped:      res.Skipped,
+			Downloaded:   res.Downloaded,
+			Uploaded:     res.Uploaded,
+			Failed:       res.Failed,
+			DeadLettered: res.DeadLettered,
+			Videos:       make([]videoOutcomeResponse, 0, len(res.Videos)),
+		},
+	}
+	if job.Progress != nil {
+		payload.Progress = toProgressResponse(*job.Progress)
+	}
+	if !job.StartedAt.IsZero() {
+		payload.StartedAt = &job.StartedAt
+	}
+	if !job.FinishedAt.IsZero() {
+		payload.FinishedAt = &job.FinishedAt
+	}
+	for _, v := range res.Videos {
+		payload.Result.Videos = append(payload.Result.Videos, videoOutcomeResponse{
+			VideoID:      v.VideoID,
+			State:        string(v.State),
+			Skipped:      v.Skipped,
+			DeadLettered: v.DeadLettered,
+			RemoteIDs:    v.RemoteIDs,
+			Error:        v.Error,
+			ErrorKind:    string(v.ErrorKind),
+			Action:       string(v.Action),
+		})
+	}
+	return payload
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
 }
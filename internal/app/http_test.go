@@ -0,0 +1,278 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, c *Controller) *httptest.Server {
+	t.Helper()
+	jobs := NewJobManager(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go jobs.Run(ctx)
+	srv := httptest.NewServer(newHTTPHandler(jobs, nil))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func waitForJob(t *testing.T, srv *httptest.Server, id string) jobResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(srv.URL + "/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job jobResponse
+		err = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == string(SyncJobSucceeded) || job.Status == string(SyncJobFailed) {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return jobResponse{}
+}
+
+func TestSyncEndpointQueuesJob(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.MarkUploaded(context.Background(), UploadRecord{VideoID: "done", ChannelID: "chan", Platform: DefaultPlatform}); err != nil {
+		t.Fatal(err)
+	}
+	downloader := &stubDownloader{
+		ids:   []string{"done", "fresh"},
+		files: map[string][]string{videoURL("fresh"): {"fresh.mp4"}},
+	}
+	srv := newTestServer(t, &Controller{Downloader: downloader, Uploader: &stubUploader{}, Store: store})
+
+	resp, err := http.Post(srv.URL+"/sync", "application/json", strings.NewReader(`{"channel_id":"chan","limit":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status=%d, want 202", resp.StatusCode)
+	}
+	var queued jobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&queued); err != nil {
+		t.Fatal(err)
+	}
+	if queued.ID == "" || resp.Header.Get("Location") != "/jobs/"+queued.ID {
+		t.Fatalf("unexpected queued job %+v (location %q)", queued, resp.Header.Get("Location"))
+	}
+
+	job := waitForJob(t, srv, queued.ID)
+	if job.Status != string(SyncJobSucceeded) {
+		t.Fatalf("job failed: %+v", job)
+	}
+	if job.Result.Considered != 2 || job.Result.Skipped != 1 || job.Result.Uploaded != 1 {
+		t.Fatalf("unexpected result: %+v", job.Result)
+	}
+	if len(job.Result.Videos) != 2 || job.Result.Videos[1].State != string(JobUploaded) {
+		t.Fatalf("unexpected per-video outcomes: %+v", job.Result.Videos)
+	}
+
+	listResp, err := http.Get(srv.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listResp.Body.Close()
+	var list []jobResponse
+	if err := json.NewDecoder(listResp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != queued.ID {
+		t.Fatalf("unexpected job list: %+v", list)
+	}
+}
+
+func TestSyncEndpointReportsFailure(t *testing.T) {
+	downloader := &stubDownloader{ids: []string{"vid"}, files: map[string][]string{}}
+	srv := newTestServer(t, &Controller{Downloader: downloader, Uploader: &stubUploader{}, Store: newTestStore(t)})
+
+	resp, err := http.Post(srv.URL+"/sync", "application/json", strings.NewReader(`{"video_id":"vid"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queued jobResponse
+	json.NewDecoder(resp.Body).Decode(&queued)
+	resp.Body.Close()
+
+	job := waitForJob(t, srv, queued.ID)
+	if job.Status != string(SyncJobFailed) || !strings.Contains(job.Error, "no files downloaded") {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if len(job.Result.Videos) != 1 || job.Result.Videos[0].State != string(JobFailed) {
+		t.Fatalf("unexpected outcomes: %+v", job.Result.Videos)
+	}
+}
+
+func TestSyncEndpointValidation(t *testing.T) {
+	srv := newTestServer(t, &Controller{})
+	for _, body := range []string{`{`, `{"channel_id":"chan"}`, `{}`, `{"channel_id":"c","video_id":"v","limit":1}`} {
+		resp, err := http.Post(srv.URL+"/sync", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("body %s: status=%d, want 400", body, resp.StatusCode)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/jobs/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status=%d, want 404", resp.StatusCode)
+	}
+}
+
+type progressUploader struct {
+	release chan struct{}
+}
+
+func (u *progressUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	<-u.release
+	reportProgress(ctx, ProgressEvent{Stage: StageUpload, Percent: 50, Speed: "1MiB/s"})
+	return UploadResult{}, nil
+}
+
+func TestJobEventsStream(t *testing.T) {
+	downloader := &stubDownloader{files: map[string][]string{videoURL("vid"): {"vid.mp4"}}}
+	uploader := &progressUploader{release: make(chan struct{})}
+	srv := newTestServer(t, &Controller{Downloader: downloader, Uploader: uploader, Store: newTestStore(t)})
+
+	resp, err := http.Post(srv.URL+"/sync", "application/json", strings.NewReader(`{"video_id":"vid"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queued jobResponse
+	json.NewDecoder(resp.Body).Decode(&queued)
+	resp.Body.Close()
+
+	stream, err := http.Get(srv.URL + "/jobs/" + queued.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	close(uploader.release)
+
+	body, err := io.ReadAll(stream.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(body)
+	for _, want := range []string{
+		"event: status",
+		`"stage":"upload","video_id":"vid","percent":50,"speed":"1MiB/s"`,
+		`"status":"succeeded"`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("stream missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestHTTPDeadLettersListAndRequeue(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := store.AddDeadLetter(ctx, DeadLetter{VideoID: "gone", ChannelID: "chan", Stage: "download", Attempts: 3, Error: "Private video"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, &Controller{Downloader: &stubDownloader{}, Uploader: &stubUploader{}, Store: store})
+
+	resp, err := http.Get(srv.URL + "/dead-letters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []deadLetterResponse
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].VideoID != "gone" || list[0].Error != "Private video" {
+		t.Fatalf("unexpected dead letters: %+v", list)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		resp, err := http.Post(srv.URL+"/dead-letters/gone/requeue", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("requeue status %d, want %d", resp.StatusCode, want)
+		}
+	}
+}
+
+func TestHTTPSubscriptionsCRUD(t *testing.T) {
+	srv := newTestServer(t, &Controller{Downloader: &stubDownloader{}, Uploader: &stubUploader{}, Store: newTestStore(t)})
+	do := func(method, path, body string) (*http.Response, subscriptionResponse) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var sub subscriptionResponse
+		if resp.Header.Get("Content-Type") == "application/json" {
+			json.NewDecoder(resp.Body).Decode(&sub)
+		}
+		return resp, sub
+	}
+
+	resp, sub := do("POST", "/subscriptions", `{"channel_id":"UC1","limit":3,"schedule":"@daily","platforms":["Bilibili"],"tags":"music"}`)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/subscriptions/UC1" {
+		t.Fatalf("create: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if !sub.Enabled || sub.Limit != 3 || sub.Tags != "music" || len(sub.Platforms) != 1 || sub.Platforms[0] != "bilibili" {
+		t.Fatalf("unexpected subscription: %+v", sub)
+	}
+	if resp, _ := do("POST", "/subscriptions", `{"channel_id":"UC1","limit":3}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate create: status %d", resp.StatusCode)
+	}
+	if resp, _ := do("POST", "/subscriptions", `{"channel_id":"UC2","limit":1,"schedule":"every day"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid schedule: status %d", resp.StatusCode)
+	}
+
+	resp, sub = do("PATCH", "/subscriptions/UC1", `{"enabled":false,"title_template":"[搬运] {{.Title}}"}`)
+	if resp.StatusCode != http.StatusOK || sub.Enabled || sub.TitleTemplate != "[搬运] {{.Title}}" || sub.Limit != 3 || sub.Schedule != "@daily" {
+		t.Fatalf("patch: status %d, %+v", resp.StatusCode, sub)
+	}
+	if resp, _ := do("PATCH", "/subscriptions/UC9", `{"limit":2}`); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("patch missing: status %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(srv.URL + "/subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []subscriptionResponse
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].ChannelID != "UC1" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		if resp, _ := do("DELETE", "/subscriptions/UC1", ""); resp.StatusCode != want {
+			t.Fatalf("delete status %d, want %d", resp.StatusCode, want)
+		}
+	}
+}
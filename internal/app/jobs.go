@@ -0,0 +1,300 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// SyncJobStatus is the lifecycle state of an asynchronous sync request.
+type SyncJobStatus string
+
+const (
+	SyncJobQueued    SyncJobStatus = "queued"
+	SyncJobRunning   SyncJobStatus = "running"
+	SyncJobSucceeded SyncJobStatus = "succeeded"
+	SyncJobFailed    SyncJobStatus = "failed"
+)
+
+// ErrJobQueueFull is returned by Submit when too many jobs are waiting.
+var ErrJobQueueFull = errors.New("job queue is full")
+
+const (
+	jobQueueSize    = 64
+	jobHistoryLimit = 200
+)
+
+// SyncRequest describes what a queued job should sync: either a channel
+// (with a positive Limit) or a single video. A single video may name the
+// channel it belongs to, so it is synced with that channel's subscription.
+type SyncRequest struct {
+	ChannelID string
+	VideoID   string
+	Limit     int
+}
+
+func (r SyncRequest) Validate() error {
+	switch {
+	case r.VideoID != "" && r.Limit > 0:
+		return errors.New("limit only applies to channel syncs; omit it to sync a single video")
+	case r.ChannelID != "" && r.VideoID == "" && r.Limit <= 0:
+		return errors.New("channel_id and positive limit required")
+	case r.ChannelID == "" && r.VideoID == "":
+		return errors.New("channel_id and positive limit, or video_id, required")
+	}
+	return nil
+}
+
+// SyncJob is a snapshot of a queued or finished sync request.
+type SyncJob struct {
+	ID         string
+	Request    SyncRequest
+	Status     SyncJobStatus
+	Result     SyncResult
+	Error      string
+	ErrorKind  YtDlpErrorKind
+	Action     ErrorAction
+	Progress   *ProgressEvent
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+func (j SyncJob) finished() bool {
+	return j.Status == SyncJobSucceeded || j.Status == SyncJobFailed
+}
+
+// JobEvent is delivered to job watchers: either a progress update or, when
+// Job is set, a snapshot taken after the job changed status.
+type JobEvent struct {
+	Progress *ProgressEvent
+	Job      *SyncJob
+}
+
+// JobManager runs sync requests one at a time in the background and keeps
+// their outcome in memory so HTTP clients can poll for it.
+type JobManager struct {
+	controller *Controller
+
+	mu       sync.Mutex
+	jobs     map[string]*SyncJob
+	order    []string
+	queue    chan string
+	watchers map[string][]chan JobEvent
+}
+
+func NewJobManager(controller *Controller) *JobManager {
+	return &JobManager{
+		controller: controller,
+		jobs:       make(map[string]*SyncJob),
+		queue:      make(chan string, jobQueueSize),
+		watchers:   make(map[string][]chan JobEvent),
+	}
+}
+
+// Run processes queued jobs until ctx is cancelled.
+func (m *JobManager) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-m.queue:
+			m.run(ctx, id)
+		}
+	}
+}
+
+// Submit validates and enqueues req, returning the queued job.
+func (m *JobManager) Submit(req SyncRequest) (SyncJob, error) {
+	if err := req.Validate(); err != nil {
+		return SyncJob{}, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return SyncJob{}, err
+	}
+	job := &SyncJob{ID: id, Request: req, Status: SyncJobQueued, CreatedAt: time.Now().UTC()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case m.queue <- id:
+	default:
+		return SyncJob{}, ErrJobQueueFull
+	}
+	m.jobs[id] = job
+	m.order = append(m.order, id)
+	m.trimLocked()
+	return *job, nil
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *JobManager) Get(id string) (SyncJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return SyncJob{}, false
+	}
+	return snapshotJob(job), true
+}
+
+// List returns snapshots of all retained jobs, newest first.
+func (m *JobManager) List() []SyncJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]SyncJob, 0, len(m.order))
+	for i := len(m.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, snapshotJob(m.jobs[m.order[i]]))
+	}
+	return jobs
+}
+
+// Subscribe streams events of the job with the given ID. The channel first
+// receives the current status, then progress and status updates, and is
+// closed once the job finishes. Call cancel to stop watching early.
+func (m *JobManager) Subscribe(id string) (events <-chan JobEvent, cancel func(), ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	ch := make(chan JobEvent, 64)
+	snap := snapshotJob(job)
+	ch <- JobEvent{Job: &snap}
+	if snap.finished() {
+		close(ch)
+		return ch, func() {}, true
+	}
+	m.watchers[id] = append(m.watchers[id], ch)
+	cancel = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		watchers := m.watchers[id]
+		for i, w := range watchers {
+			if w == ch {
+				m.watchers[id] = append(watchers[:i], watchers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+	return ch, cancel, true
+}
+
+// publishLocked fans ev out to the job's watchers, dropping it for
+// watchers that are not keeping up.
+func (m *JobManager) publishLocked(id string, ev JobEvent) {
+	for _, ch := range m.watchers[id] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (m *JobManager) publishStatusLocked(job *SyncJob) {
+	snap := snapshotJob(job)
+	m.publishLocked(job.ID, JobEvent{Job: &snap})
+	if snap.finished() {
+		for _, ch := range m.watchers[job.ID] {
+			close(ch)
+		}
+		delete(m.watchers, job.ID)
+	}
+}
+
+func (m *JobManager) run(ctx context.Context, id string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if ok {
+		job.Status = SyncJobRunning
+		job.StartedAt = time.Now().UTC()
+		m.publishStatusLocked(job)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx = WithProgress(ctx, func(ev ProgressEvent) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		job.Progress = &ev
+		m.publishLocked(id, JobEvent{Progress: &ev})
+	})
+
+	var (
+		res SyncResult
+		err error
+	)
+	req := job.Request
+	if req.VideoID == "" {
+		log.Printf("job %s: syncing channel %s (limit %d)", id, req.ChannelID, req.Limit)
+		res, err = m.controller.SyncChannel(ctx, req.ChannelID, req.Limit)
+	} else {
+		log.Printf("job %s: syncing video %s", id, req.VideoID)
+		res, err = m.controller.syncSingleVideo(ctx, req.VideoID, req.ChannelID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishStatusLocked(job)
+	job.Result = res
+	job.FinishedAt = time.Now().UTC()
+	if err != nil {
+		job.Status = SyncJobFailed
+		job.Error = err.Error()
+		job.ErrorKind, job.Action = describeError(err)
+		log.Printf("job %s failed: %v", id, err)
+		return
+	}
+	job.Status = SyncJobSucceeded
+}
+
+// trimLocked drops the oldest finished jobs once more than jobHistoryLimit
+// are retained. Queued and running jobs are never dropped.
+func (m *JobManager) trimLocked() {
+	excess := len(m.order) - jobHistoryLimit
+	if excess <= 0 {
+		return
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if excess > 0 && m.jobs[id].finished() {
+			delete(m.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+func snapshotJob(job *SyncJob) SyncJob {
+	snap := *job
+	snap.Result.Videos = make([]VideoOutcome, len(job.Result.Videos))
+	for i, v := range job.Result.Videos {
+		v.RemoteIDs = append([]string(nil), v.RemoteIDs...)
+		snap.Result.Videos[i] = v
+	}
+	if job.Progress != nil {
+		progress := *job.Progress
+		snap.Progress = &progress
+	}
+	return snap
+}
+
+func newJobID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating job id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
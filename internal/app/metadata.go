@@ -0,0 +1,129 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VideoMetadata is the subset of yt-dlp's info.json that uploaders use to
+// describe a repost.
+type VideoMetadata struct {
+	ID          string
+	Title       string
+	Description string
+	Tags        []string
+	Categories  []string
+	Channel     string
+	ChannelID   string
+	ChannelURL  string
+	UploadDate  time.Time
+	Duration    time.Duration
+	WebpageURL  string
+	Thumbnail   string
+	Chapters    []Chapter
+}
+
+// Chapter is a titled section of the original video.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// SourceURL returns the canonical link to the original video.
+func (m *VideoMetadata) SourceURL() string {
+	if m.WebpageURL != "" {
+		return m.WebpageURL
+	}
+	if m.ID != "" {
+		return videoURL(m.ID)
+	}
+	return ""
+}
+
+type ytDlpInfo struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	FullTitle   string   `json:"fulltitle"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Categories  []string `json:"categories"`
+	Channel     string   `json:"channel"`
+	Uploader    string   `json:"uploader"`
+	ChannelID   string   `json:"channel_id"`
+	ChannelURL  string   `json:"channel_url"`
+	UploadDate  string   `json:"upload_date"`
+	Duration    float64  `json:"duration"`
+	WebpageURL  string   `json:"webpage_url"`
+	Thumbnail   string   `json:"thumbnail"`
+	Chapters    []struct {
+		Title     string  `json:"title"`
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+	} `json:"chapters"`
+}
+
+// LoadVideoMetadata parses an info.json file written by yt-dlp's
+// --write-info-json.
+func LoadVideoMetadata(path string) (*VideoMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info ytDlpInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	meta := &VideoMetadata{
+		ID:          info.ID,
+		Title:       firstNonEmpty(info.Title, info.FullTitle),
+		Description: info.Description,
+		Tags:        filterEmpty(info.Tags),
+		Categories:  filterEmpty(info.Categories),
+		Channel:     firstNonEmpty(info.Channel, info.Uploader),
+		ChannelID:   info.ChannelID,
+		ChannelURL:  info.ChannelURL,
+		Duration:    secondsToDuration(info.Duration),
+		WebpageURL:  info.WebpageURL,
+		Thumbnail:   info.Thumbnail,
+	}
+	if info.UploadDate != "" {
+		if date, err := time.Parse("20060102", info.UploadDate); err == nil {
+			meta.UploadDate = date
+		}
+	}
+	for _, ch := range info.Chapters {
+		meta.Chapters = append(meta.Chapters, Chapter{
+			Title: ch.Title,
+			Start: secondsToDuration(ch.StartTime),
+			End:   secondsToDuration(ch.EndTime),
+		})
+	}
+	return meta, nil
+}
+
+// infoJSONPath returns where yt-dlp writes the info.json of a downloaded
+// file: next to it, with the media extension replaced.
+func infoJSONPath(mediaPath string) string {
+	return strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath)) + ".info.json"
+}
+
+// metadataForFiles loads the info.json written alongside the first of
+// files that has one. It returns nil when none is found.
+func metadataForFiles(files []string) *VideoMetadata {
+	for _, file := range files {
+		meta, err := LoadVideoMetadata(infoJSONPath(file))
+		if err == nil {
+			return meta
+		}
+	}
+	return nil
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleInfoJSON = `{
+	"id": "dQw4w9WgXcQ",
+	"title": "Never Gonna Give You Up",
+	"description": "The official video.",
+	"tags": ["rick astley", "", "music"],
+	"channel": "Rick Astley",
+	"channel_id": "UCuAXFkgsw1L7xaCfnd5JJOw",
+	"upload_date": "20091025",
+	"duration": 212.5,
+	"webpage_url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+	"chapters": [{"title": "Intro", "start_time": 0, "end_time": 18.5}]
+}`
+
+func TestLoadVideoMetadata(t *testing.T) {
+	video := filepath.Join(t.TempDir(), "Never Gonna Give You Up.mp4")
+	if err := os.WriteFile(infoJSONPath(video), []byte(sampleInfoJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := infoJSONPath(video); !strings.HasSuffix(got, "Never Gonna Give You Up.info.json") {
+		t.Fatalf("info path %s", got)
+	}
+
+	meta := metadataForFiles([]string{"missing.mp4", video})
+	if meta == nil {
+		t.Fatal("expected metadata")
+	}
+	if meta.Title != "Never Gonna Give You Up" || meta.Channel != "Rick Astley" || meta.Description != "The official video." {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	if len(meta.Tags) != 2 || meta.Tags[1] != "music" {
+		t.Fatalf("tags=%v", meta.Tags)
+	}
+	if !meta.UploadDate.Equal(time.Date(2009, 10, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("upload date %v", meta.UploadDate)
+	}
+	if meta.Duration != 212500*time.Millisecond {
+		t.Fatalf("duration %v", meta.Duration)
+	}
+	if len(meta.Chapters) != 1 || meta.Chapters[0].End != 18500*time.Millisecond {
+		t.Fatalf("chapters %+v", meta.Chapters)
+	}
+	if meta.SourceURL() != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Fatalf("source %s", meta.SourceURL())
+	}
+}
+
+func TestBuildBilibiliMetadata(t *testing.T) {
+	meta := &VideoMetadata{
+		ID:          "abc",
+		Title:       "Original",
+		Description: "Original description",
+		Tags:        []string{"music", "Music", strings.Repeat("x", 21)},
+	}
+	templates := MetadataTemplates{Title: "[搬运] {{.Title}}", Tags: `repost,{{join "," .Tags}}`}
+	got, err := buildBilibiliMetadata(UploadRequest{Path: "/tmp/file.mp4", Metadata: meta}, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "[搬运] Original" {
+		t.Fatalf("title %q", got.Title)
+	}
+	if got.Description != "Original description\n\nSource: https://www.youtube.com/watch?v=abc" {
+		t.Fatalf("description %q", got.Description)
+	}
+	if got.Tag != "repost,music" || got.Source != "https://www.youtube.com/watch?v=abc" {
+		t.Fatalf("tag %q source %q", got.Tag, got.Source)
+	}
+
+	got, err = buildBilibiliMetadata(UploadRequest{Path: "/tmp/file.mp4"}, MetadataTemplates{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "file" || got.Description != "Uploaded automatically: file" || got.Source != "" || got.Tag != "" {
+		t.Fatalf("unexpected metadata without info.json: %+v", got)
+	}
+}
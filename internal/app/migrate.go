@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds one directory of numbered SQL files per dialect.
+// Migrations are append-only: once released, a file is never edited;
+// schema changes go into a new file with the next number. 0001_initial
+// must keep its IF NOT EXISTS clauses so it adopts databases created
+// before migrations existed.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// release than this one; running against it could lose data.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// Migration is one NNNN_name.sql schema change.
+type Migration struct {
+	Version int
+	Name    string
+	// AppliedAt is zero while the migration is pending.
+	AppliedAt time.Time
+
+	sql string
+}
+
+// SchemaStatus compares the migrations applied to a database with the
+// ones this build ships.
+type SchemaStatus struct {
+	// Current is the highest applied version, 0 for a database that was
+	// never migrated.
+	Current int
+	// Latest is the highest version this build knows.
+	Latest int
+	// Migrations lists the known migrations and any applied ones this
+	// build does not know, ordered by version.
+	Migrations []Migration
+}
+
+// Pending lists the migrations EnsureSchema would apply.
+func (s *SchemaStatus) Pending() []Migration {
+	var pending []Migration
+	for _, m := range s.Migrations {
+		if m.Version > s.Current {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// loadMigrations reads the NNNN_name.sql files of fsys in version order.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(names))
+	seen := make(map[int]string, len(names))
+	for _, file := range names {
+		number, name, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 || name == "" {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.sql", file)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+		}
+		seen[version] = file
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func (s *sqlStore) schemaVersionTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at ` + s.dialect.timestamp + ` NOT NULL
+)`
+}
+
+// EnsureSchema applies the pending migrations in one transaction, so a
+// failing migration leaves the schema as it was. It refuses to touch a
+// database migrated by a newer release with ErrSchemaTooNew.
+func (s *sqlStore) EnsureSchema(ctx context.Context) error {
+	migrations, err := loadMigrations(s.dialect.migrations)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if s.dialect.lock != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lock); err != nil {
+			return fmt.Errorf("lock schema: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.schemaVersionTable()); err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return err
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d; upgrade yttransfer", ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`),
+			m.Version, m.Name, time.Now().UTC()); err != nil {
+			return err
+		}
+		log.Printf("Applied schema migration %04d_%s", m.Version, m.Name)
+	}
+	return tx.Commit()
+}
+
+// SchemaStatus reports which migrations the database has, without
+// changing it.
+func (s *sqlStore) SchemaStatus(ctx context.Context) (*SchemaStatus, error) {
+	migrations, err := loadMigrations(s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+	status := &SchemaStatus{Migrations: migrations}
+	if len(migrations) > 0 {
+		status.Latest = migrations[len(migrations)-1].Version
+	}
+
+	var n int
+	if err := s.queryRow(ctx, s.dialect.tableExists, "schema_version").Scan(&n); err != nil || n == 0 {
+		return status, err
+	}
+	rows, err := s.query(ctx, `SELECT version, name, applied_at FROM schema_version ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := make(map[int]int, len(migrations))
+	for i, m := range migrations {
+		known[m.Version] = i
+	}
+	for rows.Next() {
+		var m Migration
+		if err := rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := known[m.Version]; ok {
+			status.Migrations[i].AppliedAt = m.AppliedAt
+		} else {
+			status.Migrations = append(status.Migrations, m)
+		}
+		status.Current = max(status.Current, m.Version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(status.Migrations, func(i, j int) bool { return status.Migrations[i].Version < status.Migrations[j].Version })
+	return status, nil
+}
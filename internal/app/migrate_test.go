@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(fstest.MapFS{
+		"0010_tenth.sql":   {Data: []byte("SELECT 10")},
+		"0002_second.sql":  {Data: []byte("SELECT 2")},
+		"0001_initial.sql": {Data: []byte("SELECT 1")},
+		"README":           {Data: []byte("not a migration")},
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Name)
+	}
+	if strings.Join(got, ",") != "initial,second,tenth" || migrations[2].Version != 10 || migrations[1].sql != "SELECT 2" {
+		t.Fatalf("unexpected migrations: %+v", migrations)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":  {"init.sql": {}},
+		"version 0": {"0000_zero.sql": {}},
+		"no name":   {"0001_.sql": {}},
+		"duplicate": {"0001_a.sql": {}, "1_b.sql": {}},
+	} {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsMatch(t *testing.T) {
+	sqlite, err := loadMigrations(sqliteDialect.migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres, err := loadMigrations(postgresDialect.migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqlite) == 0 || len(sqlite) != len(postgres) {
+		t.Fatalf("expected the same migrations for both dialects, got %d sqlite and %d postgres", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %d: sqlite %04d_%s, postgres %04d_%s", i, sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+	}
+}
+
+// withMigrations returns the embedded SQLite migrations plus extra.
+func withMigrations(t *testing.T, extra fstest.MapFS) fs.FS {
+	t.Helper()
+	files := fstest.MapFS{}
+	for k, v := range extra {
+		files[k] = v
+	}
+	entries, err := fs.Glob(sqliteDialect.migrations, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range entries {
+		data, err := fs.ReadFile(sqliteDialect.migrations, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = &fstest.MapFile{Data: data}
+	}
+	return files
+}
+
+func TestEnsureSchemaAppliesNewMigrations(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	known := mustLoad(t, sqliteDialect.migrations)
+	latest := known[len(known)-1].Version
+
+	store.dialect.migrations = withMigrations(t, fstest.MapFS{
+		"9001_job_notes.sql": {Data: []byte(`ALTER TABLE jobs ADD COLUMN note TEXT NOT NULL DEFAULT '';`)},
+	})
+	status, err := store.SchemaStatus(ctx)
+	if err != nil || status.Current != latest || len(status.Pending()) != 1 {
+		t.Fatalf("expected one pending migration, got %+v, %v", status, err)
+	}
+	if err := store.EnsureSchema(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := store.exec(ctx, `UPDATE jobs SET note = 'x'`); err != nil {
+		t.Fatalf("expected the new column: %v", err)
+	}
+
+	// A failing migration rolls back the whole batch.
+	store.dialect.migrations = withMigrations(t, fstest.MapFS{
+		"9001_job_notes.sql": {Data: []byte(`ALTER TABLE jobs ADD COLUMN note TEXT NOT NULL DEFAULT '';`)},
+		"9002_tags.sql":      {Data: []byte(`CREATE TABLE tags (name TEXT PRIMARY KEY);`)},
+		"9003_broken.sql":    {Data: []byte(`ALTER TABLE missing ADD COLUMN x TEXT;`)},
+	})
+	if err := store.EnsureSchema(ctx); err == nil || !strings.Contains(err.Error(), "9003_broken") {
+		t.Fatalf("expected the broken migration to fail, got %v", err)
+	}
+	if status, err := store.SchemaStatus(ctx); err != nil || status.Current != 9001 {
+		t.Fatalf("expected version 9001 after the failed batch, got %+v, %v", status, err)
+	}
+	var n int
+	if err := store.queryRow(ctx, sqliteDialect.tableExists, "tags").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected 9002 to be rolled back, got %d tables, %v", n, err)
+	}
+}
+
+func TestEnsureSchemaAdoptsLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	// Releases before migrations created the tables without schema_version.
+	initial, err := fs.ReadFile(sqliteDialect.migrations, "0001_initial.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.db.ExecContext(ctx, string(initial)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.exec(ctx, `INSERT INTO uploads (video_id, channel_id, uploaded_at) VALUES (?, ?, ?)`, "vid1", "chan", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.EnsureSchema(ctx); err != nil {
+		t.Fatalf("migrate legacy database: %v", err)
+	}
+	if uploaded, err := store.IsUploaded(ctx, "vid1", DefaultPlatform, ""); err != nil || !uploaded {
+		t.Fatalf("expected existing rows to survive, got %v, %v", uploaded, err)
+	}
+}
+
+func TestEnsureSchemaRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if _, err := store.exec(ctx, `INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, 9999, "from_the_future"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnsureSchema(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+	status, err := store.SchemaStatus(ctx)
+	if err != nil || status.Current != 9999 || status.Migrations[len(status.Migrations)-1].Name != "from_the_future" {
+		t.Fatalf("expected the unknown migration in the status, got %+v, %v", status, err)
+	}
+}
+
+func mustLoad(t *testing.T, fsys fs.FS) []Migration {
+	t.Helper()
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
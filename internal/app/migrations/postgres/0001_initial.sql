@@ -0,0 +1,51 @@
+-- The tables as created before versioned migrations. IF NOT EXISTS lets
+-- this migration adopt databases from those releases unchanged.
+CREATE TABLE IF NOT EXISTS uploads (
+	video_id TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL,
+	uploaded_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS jobs (
+	video_id TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL,
+	state TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	files TEXT NOT NULL DEFAULT '[]',
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_channel_state ON jobs (channel_id, state);
+CREATE TABLE IF NOT EXISTS dead_letters (
+	video_id TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL,
+	stage TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	error TEXT NOT NULL,
+	failed_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS channel_runs (
+	channel_id TEXT PRIMARY KEY,
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ NOT NULL,
+	last_error TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS subscriptions (
+	channel_id TEXT PRIMARY KEY,
+	platforms TEXT NOT NULL DEFAULT '[]',
+	video_limit INTEGER NOT NULL,
+	schedule TEXT NOT NULL DEFAULT '',
+	title_template TEXT NOT NULL DEFAULT '',
+	description_template TEXT NOT NULL DEFAULT '',
+	dynamic_template TEXT NOT NULL DEFAULT '',
+	tags_template TEXT NOT NULL DEFAULT '',
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS websub_leases (
+	channel_id TEXT PRIMARY KEY,
+	topic TEXT NOT NULL,
+	state TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,5 @@
+-- A video split into several files can reach a destination only partly.
+-- Such uploads are kept with partial set and the names of the files that
+-- made it, so a later sync uploads just the rest.
+ALTER TABLE uploads ADD COLUMN files TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE uploads ADD COLUMN partial BOOLEAN NOT NULL DEFAULT FALSE;
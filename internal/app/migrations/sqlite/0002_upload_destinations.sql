@@ -0,0 +1,17 @@
+-- Uploads are recorded per destination, so one video can be published to
+-- several platforms and accounts. Every upload before this migration went
+-- to the default Bilibili account.
+CREATE TABLE uploads_by_destination (
+	video_id TEXT NOT NULL,
+	platform TEXT NOT NULL,
+	account TEXT NOT NULL DEFAULT '',
+	channel_id TEXT NOT NULL,
+	remote_id TEXT NOT NULL DEFAULT '',
+	url TEXT NOT NULL DEFAULT '',
+	uploaded_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (video_id, platform, account)
+);
+INSERT INTO uploads_by_destination (video_id, platform, account, channel_id, uploaded_at)
+SELECT video_id, 'bilibili', '', channel_id, uploaded_at FROM uploads;
+DROP TABLE uploads;
+ALTER TABLE uploads_by_destination RENAME TO uploads;
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// PipelineOptions sets how many videos a channel sync downloads and uploads
+// at the same time. Downloads feed uploads through a bounded queue, so the
+// next video downloads while the previous one uploads.
+type PipelineOptions struct {
+	// Downloads is the number of concurrent yt-dlp runs (default 1).
+	Downloads int
+	// Uploads is the number of concurrent uploads (default 1).
+	Uploads int
+	// Unordered lets a video start uploading as soon as it is downloaded.
+	// By default uploads start in listing order, so the target channel
+	// receives videos in the same order as the source, and
+	// SyncResult.Videos is reported in that order too.
+	Unordered bool
+}
+
+func (o PipelineOptions) workers() (downloads, uploads int) {
+	downloads, uploads = o.Downloads, o.Uploads
+	if downloads <= 0 {
+		downloads = 1
+	}
+	if uploads <= 0 {
+		uploads = 1
+	}
+	return downloads, uploads
+}
+
+// pipelineItem carries one video from the download stage to the upload
+// stage and finally into the SyncResult.
+type pipelineItem struct {
+	index     int
+	videoID   string
+	channelID string
+	// channelHint is the channel a single-video sync was told the video
+	// belongs to. Unlike channelID it keeps single-video semantics.
+	channelHint string
+
+	job *VideoJob
+	// destinations are where the video goes; pending are the ones that
+	// do not have it yet.
+	destinations []Destination
+	pending      []Destination
+	files        []string
+	meta         *VideoMetadata
+	thumb        string
+
+	// done is set when the item needs no upload: it was skipped, already
+	// finished, or failed before uploading.
+	done    bool
+	skipped bool
+	// failed is set when the video itself failed (as opposed to the store
+	// or a cancellation); such failures do not stop the rest of the sync.
+	failed       bool
+	deadLettered bool
+	downloaded   int
+	uploaded     int
+	remoteIDs    []string
+	err          error
+}
+
+// uploadError reports failed uploads, naming the destinations unless the
+// video only has one.
+func (item *pipelineItem) uploadError(failed []DestinationResult) error {
+	if len(item.destinations) == 1 && len(failed) == 1 {
+		return failed[0].Err
+	}
+	return &FanOutError{Failures: failed}
+}
+
+func (item *pipelineItem) record(result *SyncResult) {
+	if item.skipped {
+		result.Skipped++
+		state := JobUploaded
+		if item.deadLettered {
+			state = JobFailed
+		}
+		result.Videos = append(result.Videos, VideoOutcome{VideoID: item.videoID, State: state, Skipped: true, DeadLettered: item.deadLettered})
+		return
+	}
+	result.Downloaded += item.downloaded
+	result.Uploaded += item.uploaded
+	if item.failed {
+		result.Failed++
+	}
+	if item.deadLettered {
+		result.DeadLettered++
+	}
+	outcome := VideoOutcome{VideoID: item.videoID, RemoteIDs: item.remoteIDs, DeadLettered: item.deadLettered}
+	if item.job != nil {
+		outcome.State = item.job.State
+	}
+	if item.err != nil {
+		outcome.Error = item.err.Error()
+		outcome.ErrorKind, outcome.Action = describeError(item.err)
+	}
+	result.Videos = append(result.Videos, outcome)
+}
+
+// runPipeline syncs ids with c.Pipeline's download and upload workers.
+// Failed videos are reported in result and the sync moves on; any other
+// error (the store, a cancelled context) cancels both stages and is
+// returned. Videos interrupted by the cancellation keep their in-progress
+// job state and are resumed by the next sync.
+func (c *Controller) runPipeline(ctx context.Context, ids []string, channelID string, dests []Destination, result *SyncResult) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	downloadWorkers, uploadWorkers := c.Pipeline.workers()
+
+	queued := make(chan *pipelineItem)
+	downloaded := make(chan *pipelineItem, uploadWorkers)
+	uploads := make(chan *pipelineItem, uploadWorkers)
+	finished := make(chan *pipelineItem, uploadWorkers)
+	// window caps how far downloads may run ahead of the oldest video the
+	// ordered sequencer is still waiting for: a slot is taken per video
+	// dispatched and given back once it is forwarded in order, so one slow
+	// download cannot make the sequencer buffer the rest of the channel.
+	window := make(chan struct{}, downloadWorkers+uploadWorkers)
+
+	go func() {
+		defer close(queued)
+		for i, id := range ids {
+			if !c.Pipeline.Unordered {
+				select {
+				case window <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case queued <- &pipelineItem{index: i, videoID: id, channelID: channelID, destinations: dests}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var downloadWG sync.WaitGroup
+	for i := 0; i < downloadWorkers; i++ {
+		downloadWG.Add(1)
+		go func() {
+			defer downloadWG.Done()
+			for item := range queued {
+				c.downloadStage(ctx, item)
+				downloaded <- item
+			}
+		}()
+	}
+	go func() {
+		downloadWG.Wait()
+		close(downloaded)
+	}()
+
+	// The sequencer routes finished downloads to the upload workers,
+	// holding them back until all earlier videos went ahead unless the
+	// pipeline is unordered.
+	var uploadWG sync.WaitGroup
+	uploadWG.Add(1)
+	go func() {
+		defer uploadWG.Done()
+		defer close(uploads)
+		forward := func(item *pipelineItem) {
+			if item.done {
+				finished <- item
+			} else {
+				uploads <- item
+			}
+		}
+		pending := map[int]*pipelineItem{}
+		next := 0
+		for item := range downloaded {
+			if c.Pipeline.Unordered {
+				forward(item)
+				continue
+			}
+			pending[item.index] = item
+			for pending[next] != nil {
+				forward(pending[next])
+				delete(pending, next)
+				next++
+				<-window
+			}
+		}
+		// A cancelled feeder leaves gaps; release whatever arrived.
+		for _, item := range pending {
+			forward(item)
+		}
+	}()
+	for i := 0; i < uploadWorkers; i++ {
+		uploadWG.Add(1)
+		go func() {
+			defer uploadWG.Done()
+			for item := range uploads {
+				c.uploadStage(ctx, item)
+				finished <- item
+			}
+		}()
+	}
+	go func() {
+		uploadWG.Wait()
+		close(finished)
+	}()
+
+	var (
+		items    []*pipelineItem
+		firstErr error
+	)
+	for item := range finished {
+		items = append(items, item)
+		if item.err != nil && !item.failed && firstErr == nil {
+			firstErr = item.err
+			cancel()
+		}
+	}
+	if !c.Pipeline.Unordered {
+		sort.Slice(items, func(i, j int) bool { return items[i].index < items[j].index })
+	}
+	for _, item := range items {
+		item.record(result)
+	}
+	return firstErr
+}
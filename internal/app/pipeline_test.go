@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedDownloader and gatedUploader block until the test releases them and
+// track how many calls run at once.
+type gatedDownloader struct {
+	gate    chan struct{}
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (d *gatedDownloader) ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error) {
+	return []string{"v0", "v1", "v2", "v3"}[:limit], nil
+}
+
+func (d *gatedDownloader) DownloadVideo(ctx context.Context, url, outputDir, jsRuntime, format string) (DownloadResult, error) {
+	d.mu.Lock()
+	d.active++
+	if d.active > d.maxSeen {
+		d.maxSeen = d.active
+	}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.active--
+		d.mu.Unlock()
+	}()
+	select {
+	case <-d.gate:
+	case <-ctx.Done():
+		return DownloadResult{}, ctx.Err()
+	}
+	id := url[len(url)-2:]
+	return DownloadResult{Artifacts: []Artifact{{Kind: ArtifactVideo, Path: id + ".mp4"}}}, nil
+}
+
+type gatedUploader struct {
+	delay   map[string]time.Duration
+	block   chan struct{}
+	mu      sync.Mutex
+	started []string
+}
+
+func (u *gatedUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	u.mu.Lock()
+	u.started = append(u.started, req.Path)
+	u.mu.Unlock()
+	if u.block != nil {
+		select {
+		case <-u.block:
+		case <-ctx.Done():
+			return UploadResult{}, ctx.Err()
+		}
+	}
+	time.Sleep(u.delay[req.Path])
+	return UploadResult{RemoteID: req.Path}, nil
+}
+
+func TestPipelineRunsStagesConcurrently(t *testing.T) {
+	downloader := &gatedDownloader{gate: make(chan struct{})}
+	uploader := &gatedUploader{delay: map[string]time.Duration{"v0.mp4": 30 * time.Millisecond}}
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   uploader,
+		Store:      newTestStore(t),
+		Pipeline:   PipelineOptions{Downloads: 2, Uploads: 2},
+	}
+	go func() {
+		// Hold every download until both workers are busy.
+		for {
+			downloader.mu.Lock()
+			busy := downloader.active == 2
+			downloader.mu.Unlock()
+			if busy {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		close(downloader.gate)
+	}()
+
+	result, err := c.SyncChannel(context.Background(), "chan", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloader.maxSeen != 2 {
+		t.Fatalf("max concurrent downloads = %d, want 2", downloader.maxSeen)
+	}
+	if result.Uploaded != 4 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	// v0 uploads slowest, but ordered results follow the listing.
+	for i, want := range []string{"v0", "v1", "v2", "v3"} {
+		if result.Videos[i].VideoID != want {
+			t.Fatalf("videos out of order: %+v", result.Videos)
+		}
+	}
+}
+
+// stalledDownloader holds the download of v0 until release is closed and
+// finishes every other video at once.
+type stalledDownloader struct {
+	release chan struct{}
+	mu      sync.Mutex
+	started int
+}
+
+func (d *stalledDownloader) ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error) {
+	return []string{"v0", "v1", "v2", "v3", "v4", "v5", "v6", "v7"}[:limit], nil
+}
+
+func (d *stalledDownloader) DownloadVideo(ctx context.Context, url, outputDir, jsRuntime, format string) (DownloadResult, error) {
+	d.mu.Lock()
+	d.started++
+	d.mu.Unlock()
+	id := url[len(url)-2:]
+	if id == "v0" {
+		select {
+		case <-d.release:
+		case <-ctx.Done():
+			return DownloadResult{}, ctx.Err()
+		}
+	}
+	return DownloadResult{Artifacts: []Artifact{{Kind: ArtifactVideo, Path: id + ".mp4"}}}, nil
+}
+
+func TestPipelineBoundsDownloadsAheadOfStalledVideo(t *testing.T) {
+	downloader := &stalledDownloader{release: make(chan struct{})}
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   &gatedUploader{},
+		Store:      newTestStore(t),
+		Pipeline:   PipelineOptions{Downloads: 2, Uploads: 1},
+	}
+	done := make(chan SyncResult, 1)
+	go func() {
+		result, err := c.SyncChannel(context.Background(), "chan", 8)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	downloader.mu.Lock()
+	started := downloader.started
+	downloader.mu.Unlock()
+	if started > 3 {
+		t.Fatalf("%d downloads started while v0 stalled, want at most 3", started)
+	}
+	close(downloader.release)
+
+	select {
+	case result := <-done:
+		if result.Uploaded != 8 || result.Videos[0].VideoID != "v0" || result.Videos[7].VideoID != "v7" {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not finish after v0 was released")
+	}
+}
+
+func TestPipelineUnorderedReportsCompletionOrder(t *testing.T) {
+	downloader := &gatedDownloader{gate: make(chan struct{})}
+	close(downloader.gate)
+	uploader := &gatedUploader{delay: map[string]time.Duration{"v0.mp4": 50 * time.Millisecond}}
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   uploader,
+		Store:      newTestStore(t),
+		Pipeline:   PipelineOptions{Downloads: 2, Uploads: 2, Unordered: true},
+	}
+
+	result, err := c.SyncChannel(context.Background(), "chan", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Videos) != 2 || result.Videos[0].VideoID != "v1" {
+		t.Fatalf("expected v1 to finish first: %+v", result.Videos)
+	}
+}
+
+func TestPipelineCancellationStopsBothStages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	downloader := &gatedDownloader{gate: make(chan struct{})}
+	close(downloader.gate)
+	uploader := &gatedUploader{block: make(chan struct{})}
+	store := newTestStore(t)
+	c := &Controller{Downloader: downloader, Uploader: uploader, Store: store}
+
+	done := make(chan error, 1)
+	var result SyncResult
+	go func() {
+		var err error
+		result, err = c.SyncChannel(ctx, "chan", 4)
+		done <- err
+	}()
+	for {
+		uploader.mu.Lock()
+		started := len(uploader.started)
+		uploader.mu.Unlock()
+		if started > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pipeline did not stop after cancellation")
+	}
+	if result.Uploaded != 0 || len(uploader.started) != 1 {
+		t.Fatalf("uploads continued after cancel: %+v, started %v", result, uploader.started)
+	}
+	// The interrupted upload is not a failure; the next sync resumes it.
+	job, err := store.GetJob(context.Background(), "v0")
+	if err != nil || job == nil || job.State != JobUploading {
+		t.Fatalf("unexpected job after cancel: %+v, %v", job, err)
+	}
+}
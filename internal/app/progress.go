@@ -0,0 +1,232 @@
+package app
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressStage names the pipeline step a ProgressEvent belongs to.
+type ProgressStage string
+
+const (
+	StageDownload    ProgressStage = "download"
+	StagePostprocess ProgressStage = "postprocess"
+	StageUpload      ProgressStage = "upload"
+)
+
+// ProgressEvent is a structured progress update emitted while a video is
+// being downloaded or uploaded. Percent is negative when unknown.
+type ProgressEvent struct {
+	Stage   ProgressStage
+	VideoID string
+	Percent float64
+	Speed   string
+	ETA     string
+	Message string
+	Time    time.Time
+}
+
+// ProgressFunc receives progress events. It must not block.
+type ProgressFunc func(ProgressEvent)
+
+type progressKey struct{}
+
+type progressScope struct {
+	fn      ProgressFunc
+	videoID string
+}
+
+// WithProgress returns a context whose downloads and uploads report
+// progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, progressScope{fn: fn})
+}
+
+// withProgressVideo tags events reported under ctx with videoID so
+// downloaders and uploaders do not need to know which video they serve.
+func withProgressVideo(ctx context.Context, videoID string) context.Context {
+	scope, ok := ctx.Value(progressKey{}).(progressScope)
+	if !ok {
+		return ctx
+	}
+	scope.videoID = videoID
+	return context.WithValue(ctx, progressKey{}, scope)
+}
+
+func reportProgress(ctx context.Context, ev ProgressEvent) {
+	scope, ok := ctx.Value(progressKey{}).(progressScope)
+	if !ok || scope.fn == nil {
+		return
+	}
+	if ev.VideoID == "" {
+		ev.VideoID = scope.videoID
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	scope.fn(ev)
+}
+
+const (
+	ytDlpProgressPrefix    = "[yttransfer-progress]"
+	ytDlpPostprocessPrefix = "[yttransfer-postprocess]"
+)
+
+// ytDlpProgressArgs makes yt-dlp print machine-readable progress lines, one
+// per update, even though the downloader runs it with --quiet.
+func ytDlpProgressArgs() []string {
+	return []string{
+		"--progress",
+		"--newline",
+		"--progress-template", "download:" + ytDlpProgressPrefix + " %(info.id)s|%(progress._percent_str)s|%(progress._speed_str)s|%(progress._eta_str)s",
+		"--progress-template", "postprocess:" + ytDlpPostprocessPrefix + " %(info.id)s|%(progress.postprocessor)s|%(progress.status)s",
+	}
+}
+
+// parseYtDlpProgress decodes a line produced by ytDlpProgressArgs.
+func parseYtDlpProgress(line string) (ProgressEvent, bool) {
+	line = strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(line, ytDlpProgressPrefix):
+		parts := strings.Split(strings.TrimSpace(strings.TrimPrefix(line, ytDlpProgressPrefix)), "|")
+		if len(parts) != 4 {
+			return ProgressEvent{}, false
+		}
+		return ProgressEvent{
+			Stage:   StageDownload,
+			VideoID: cleanProgressField(parts[0]),
+			Percent: parsePercent(parts[1]),
+			Speed:   cleanProgressField(parts[2]),
+			ETA:     cleanProgressField(parts[3]),
+		}, true
+	case strings.HasPrefix(line, ytDlpPostprocessPrefix):
+		parts := strings.Split(strings.TrimSpace(strings.TrimPrefix(line, ytDlpPostprocessPrefix)), "|")
+		if len(parts) != 3 {
+			return ProgressEvent{}, false
+		}
+		return ProgressEvent{
+			Stage:   StagePostprocess,
+			VideoID: cleanProgressField(parts[0]),
+			Percent: -1,
+			Message: strings.TrimSpace(cleanProgressField(parts[1]) + " " + cleanProgressField(parts[2])),
+		}, true
+	}
+	return ProgressEvent{}, false
+}
+
+var (
+	percentPattern   = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+	byteRatioPattern = regexp.MustCompile(`([\d.]+)\s*([KMGT]?i?B)\s*/\s*([\d.]+)\s*([KMGT]?i?B)`)
+	speedPattern     = regexp.MustCompile(`([\d.]+\s*[KMGT]?i?B/s)`)
+	etaPattern       = regexp.MustCompile(`(?:ETA|eta)[:\s]+([\dhms:]+)|B/s,\s*([\dhms:]+)\)`)
+)
+
+// parseBiliupProgress extracts upload progress from a biliup output line.
+// biliup renders an indicatif bar such as
+// "[00:00:05] [###>---] 12.50 MiB/100.00 MiB (2.50 MiB/s, 35s)"; plain
+// percentages are understood as well.
+func parseBiliupProgress(line string) (ProgressEvent, bool) {
+	ev := ProgressEvent{Stage: StageUpload, Percent: -1}
+	found := false
+	if m := byteRatioPattern.FindStringSubmatch(line); m != nil {
+		done := parseByteSize(m[1], m[2])
+		total := parseByteSize(m[3], m[4])
+		if total > 0 {
+			ev.Percent = done / total * 100
+			found = true
+		}
+	}
+	if !found {
+		if m := percentPattern.FindStringSubmatch(line); m != nil {
+			ev.Percent, _ = strconv.ParseFloat(m[1], 64)
+			found = true
+		}
+	}
+	if !found {
+		return ProgressEvent{}, false
+	}
+	if m := speedPattern.FindStringSubmatch(line); m != nil {
+		ev.Speed = strings.ReplaceAll(m[1], " ", "")
+	}
+	if m := etaPattern.FindStringSubmatch(line); m != nil {
+		ev.ETA = m[1] + m[2]
+	}
+	return ev, true
+}
+
+func parseByteSize(value, unit string) float64 {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	multipliers := map[string]float64{
+		"B": 1, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+	}
+	return n * multipliers[unit]
+}
+
+func parsePercent(value string) float64 {
+	value = strings.TrimSuffix(cleanProgressField(value), "%")
+	pct, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return -1
+	}
+	return pct
+}
+
+// cleanProgressField strips padding and ANSI colour codes yt-dlp puts
+// around its preformatted progress strings.
+func cleanProgressField(value string) string {
+	value = ansiPattern.ReplaceAllString(value, "")
+	value = strings.TrimSpace(value)
+	if value == "NA" || value == "Unknown" {
+		return ""
+	}
+	return value
+}
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// lineWriter is an io.Writer that hands every complete line to fn. Both
+// "\n" and "\r" terminate a line so redrawn progress bars are seen as
+// separate updates. Call Flush once the writer is done to emit a trailing
+// partial line.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func newLineWriter(fn func(line string)) *lineWriter {
+	return &lineWriter{fn: fn}
+}
+
+func (w *lineWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		idx := strings.IndexAny(string(w.buf), "\r\n")
+		if idx < 0 {
+			break
+		}
+		w.emit(string(w.buf[:idx]))
+		w.buf = w.buf[idx+1:]
+	}
+	return len(data), nil
+}
+
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) emit(line string) {
+	line = strings.TrimSpace(line)
+	if line != "" {
+		w.fn(line)
+	}
+}
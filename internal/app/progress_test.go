@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseYtDlpProgress(t *testing.T) {
+	ev, ok := parseYtDlpProgress("[yttransfer-progress] abc123|  42.5%|   1.20MiB/s|00:31")
+	if !ok {
+		t.Fatal("expected progress line to parse")
+	}
+	want := ProgressEvent{Stage: StageDownload, VideoID: "abc123", Percent: 42.5, Speed: "1.20MiB/s", ETA: "00:31"}
+	if !reflect.DeepEqual(ev, want) {
+		t.Fatalf("got %+v, want %+v", ev, want)
+	}
+
+	ev, ok = parseYtDlpProgress("[yttransfer-progress] abc123|NA|Unknown|NA")
+	if !ok || ev.Percent != -1 || ev.Speed != "" || ev.ETA != "" {
+		t.Fatalf("unexpected unknown-field parse: %+v, %v", ev, ok)
+	}
+
+	ev, ok = parseYtDlpProgress("[yttransfer-postprocess] abc123|Merger|started")
+	if !ok || ev.Stage != StagePostprocess || ev.Message != "Merger started" {
+		t.Fatalf("unexpected postprocess parse: %+v, %v", ev, ok)
+	}
+
+	if _, ok := parseYtDlpProgress("downloads/video.mp4"); ok {
+		t.Fatal("file path must not parse as progress")
+	}
+}
+
+func TestParseBiliupProgress(t *testing.T) {
+	ev, ok := parseBiliupProgress("[00:00:05] [####>-----] 25.00 MiB/100.00 MiB (2.50 MiB/s, 30s)")
+	if !ok {
+		t.Fatal("expected bar to parse")
+	}
+	if ev.Stage != StageUpload || ev.Percent != 25 || ev.Speed != "2.50MiB/s" || ev.ETA != "30s" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	ev, ok = parseBiliupProgress("uploading chunk 3/10 37.5%")
+	if !ok || ev.Percent != 37.5 {
+		t.Fatalf("unexpected percent parse: %+v, %v", ev, ok)
+	}
+
+	if _, ok := parseBiliupProgress("INFO login success"); ok {
+		t.Fatal("plain log line must not parse as progress")
+	}
+}
+
+func TestLineWriterSplitsCarriageReturns(t *testing.T) {
+	var lines []string
+	w := newLineWriter(func(line string) { lines = append(lines, line) })
+	w.Write([]byte("10%\r20"))
+	w.Write([]byte("%\r\nlast"))
+	w.Flush()
+	if !reflect.DeepEqual(lines, []string{"10%", "20%", "last"}) {
+		t.Fatalf("lines=%q", lines)
+	}
+}
+
+func TestReportProgressTagsVideo(t *testing.T) {
+	var got []ProgressEvent
+	ctx := WithProgress(context.Background(), func(ev ProgressEvent) { got = append(got, ev) })
+	reportProgress(withProgressVideo(ctx, "vid"), ProgressEvent{Stage: StageUpload, Percent: 50})
+	reportProgress(context.Background(), ProgressEvent{Stage: StageUpload})
+	if len(got) != 1 || got[0].VideoID != "vid" || got[0].Time.IsZero() {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+}
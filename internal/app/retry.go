@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// ErrorClass tells the retry policy whether trying again can help.
+type ErrorClass int
+
+const (
+	// ErrorTransient covers network hiccups, rate limits and anything not
+	// known to be permanent.
+	ErrorTransient ErrorClass = iota
+	// ErrorPermanent errors fail the same way on every attempt, e.g. a
+	// private video or a rejected title.
+	ErrorPermanent
+)
+
+func (c ErrorClass) String() string {
+	if c == ErrorPermanent {
+		return "permanent"
+	}
+	return "transient"
+}
+
+// PermanentError marks an error that retrying cannot fix.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err so ClassifyError reports it as ErrorPermanent.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// ClassifyError decides whether err is worth retrying.
+func ClassifyError(err error) ErrorClass {
+	var fan *FanOutError
+	if errors.As(err, &fan) {
+		if fan.permanent() {
+			return ErrorPermanent
+		}
+		return ErrorTransient
+	}
+	var perm *PermanentError
+	if errors.As(err, &perm) {
+		return ErrorPermanent
+	}
+	var ytErr *YtDlpError
+	if errors.As(err, &ytErr) {
+		if ytErr.Kind.Action() == ActionGiveUp {
+			return ErrorPermanent
+		}
+		return ErrorTransient
+	}
+	var platformErr *PlatformAPIError
+	if errors.As(err, &platformErr) {
+		switch {
+		case platformErr.Transient, platformErr.LoggedOut, platformErr.Status == http.StatusTooManyRequests, platformErr.Status >= 500:
+			return ErrorTransient
+		case platformErr.Code != 0, platformErr.Status >= 400:
+			return ErrorPermanent
+		}
+	}
+	return ErrorTransient
+}
+
+// describeError returns the yt-dlp error kind of err ("" for other
+// errors) and what an operator should do about it.
+func describeError(err error) (YtDlpErrorKind, ErrorAction) {
+	var ytErr *YtDlpError
+	if errors.As(err, &ytErr) {
+		return ytErr.Kind, ytErr.Kind.Action()
+	}
+	if errors.Is(err, ErrNotLoggedIn) {
+		return "", ActionRefreshCookies
+	}
+	if ClassifyError(err) == ErrorPermanent {
+		return "", ActionGiveUp
+	}
+	return "", ActionWait
+}
+
+// RetryPolicy controls how often a failing download or upload is retried
+// within one sync and when a video is given up on. The zero value makes a
+// single attempt and only dead-letters permanent errors.
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries per stage and sync (default 1).
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry; it doubles on every
+	// further retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomises each delay by up to ±Jitter (0–1) of its length so
+	// parallel workers do not retry in lockstep.
+	Jitter float64
+	// DeadLetterAfter moves a video to the dead-letter table once its job
+	// has used this many attempts across syncs, even if its errors look
+	// transient. Zero disables the limit.
+	DeadLetterAfter int
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay after the given failed attempt (1-based).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 && delay > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// shouldDeadLetter reports whether a video whose job has used attempts
+// tries should stop being retried after failing with err. A logged-out
+// session is never the video's fault.
+func (p RetryPolicy) shouldDeadLetter(err error, attempts int) bool {
+	if errors.Is(err, ErrNotLoggedIn) {
+		return false
+	}
+	if ClassifyError(err) == ErrorPermanent {
+		return true
+	}
+	return p.DeadLetterAfter > 0 && attempts >= p.DeadLetterAfter
+}
+
+// withRetry runs fn until it succeeds, fails permanently, finds the
+// session logged out or the policy's attempts are used up. Every retry is
+// counted on the item's job.
+func (c *Controller) withRetry(ctx context.Context, item *pipelineItem, stage ProgressStage, fn func() error) error {
+	maxAttempts := c.Retry.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= maxAttempts || errors.Is(err, ErrNotLoggedIn) || c.Retry.shouldDeadLetter(err, item.job.Attempts) {
+			return err
+		}
+		delay := c.Retry.backoff(attempt)
+		log.Printf("%s of %s failed (attempt %d/%d), retrying in %s: %v", stage, item.videoID, attempt, maxAttempts, delay.Round(time.Millisecond), err)
+		reportProgress(ctx, ProgressEvent{Stage: stage, Percent: -1, Message: "retrying after error: " + err.Error()})
+		item.job.Attempts++
+		item.job.LastError = err.Error()
+		if saveErr := c.Store.SaveJob(ctx, item.job); saveErr != nil {
+			log.Printf("failed to record retry for %s: %v", item.videoID, saveErr)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDownloader fails each video with its scripted errors, in order, and
+// succeeds once they are used up.
+type flakyDownloader struct {
+	ids []string
+
+	mu        sync.Mutex
+	errs      map[string][]error
+	downloads map[string]int
+}
+
+func (d *flakyDownloader) ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error) {
+	return d.ids, nil
+}
+
+func (d *flakyDownloader) DownloadVideo(ctx context.Context, url, outputDir, jsRuntime, format string) (DownloadResult, error) {
+	id := url[len(videoURL("")):]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.downloads == nil {
+		d.downloads = map[string]int{}
+	}
+	d.downloads[id]++
+	if errs := d.errs[id]; len(errs) > 0 {
+		d.errs[id] = errs[1:]
+		return DownloadResult{}, errs[0]
+	}
+	return DownloadResult{Artifacts: []Artifact{{Kind: ArtifactVideo, Path: id + ".mp4"}}}, nil
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"plain", errors.New("connection reset"), ErrorTransient},
+		{"permanent", Permanent(errors.New("private video")), ErrorPermanent},
+		{"wrapped permanent", errors.Join(errors.New("context"), Permanent(errors.New("gone"))), ErrorPermanent},
+		{"bilibili rejected", bilibiliAPIError("submit", 21070, ""), ErrorPermanent},
+		{"bilibili rate limited", bilibiliAPIError("submit", 601, ""), ErrorTransient},
+		{"bilibili 502", &PlatformAPIError{Platform: "bilibili", Endpoint: "chunk upload", Status: http.StatusBadGateway}, ErrorTransient},
+		{"bilibili 403", &PlatformAPIError{Platform: "bilibili", Endpoint: "preupload", Status: http.StatusForbidden}, ErrorPermanent},
+		{"douyin rejected", douyinStatus{StatusCode: 2}.err("create"), ErrorPermanent},
+		{"douyin rate limited", douyinStatus{StatusCode: 7}.err("create"), ErrorTransient},
+		{"douyin logged out", douyinStatus{StatusCode: 8}.err("upload apply"), ErrorTransient},
+		{"douyin 429", &PlatformAPIError{Platform: "douyin", Endpoint: "apply", Status: http.StatusTooManyRequests}, ErrorTransient},
+		{"douyin 403", &PlatformAPIError{Platform: "douyin", Endpoint: "apply", Status: http.StatusForbidden}, ErrorPermanent},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := p.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("jittered backoff %s outside ±50%% of 2s", got)
+		}
+	}
+}
+
+func TestSyncChannelRetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	downloader := &flakyDownloader{
+		ids:  []string{"vid"},
+		errs: map[string][]error{"vid": {errors.New("HTTP Error 503"), errors.New("timed out")}},
+	}
+	store := newTestStore(t)
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   &stubUploader{},
+		Store:      store,
+		Retry:      RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	}
+
+	result, err := c.SyncChannel(ctx, "chan", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 1 || result.Failed != 0 || downloader.downloads["vid"] != 3 {
+		t.Fatalf("unexpected result %+v after %d downloads", result, downloader.downloads["vid"])
+	}
+	job, _ := store.GetJob(ctx, "vid")
+	if job.State != JobUploaded || job.Attempts != 3 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
+
+func TestSyncChannelDeadLettersAndContinues(t *testing.T) {
+	ctx := context.Background()
+	downloader := &flakyDownloader{
+		ids:  []string{"private", "ok"},
+		errs: map[string][]error{"private": {Permanent(errors.New("Private video"))}},
+	}
+	uploader := &stubUploader{}
+	store := newTestStore(t)
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   uploader,
+		Store:      store,
+		Retry:      RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	}
+
+	result, err := c.SyncChannel(ctx, "chan", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 1 || result.DeadLettered != 1 || result.Uploaded != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if downloader.downloads["private"] != 1 {
+		t.Fatalf("permanent error was retried %d times", downloader.downloads["private"])
+	}
+	if v := result.Videos[0]; v.VideoID != "private" || !v.DeadLettered || v.Error != "Private video" {
+		t.Fatalf("unexpected outcome: %+v", v)
+	}
+	dl, err := store.GetDeadLetter(ctx, "private")
+	if err != nil || dl == nil || dl.Stage != "download" || dl.ChannelID != "chan" {
+		t.Fatalf("unexpected dead letter: %+v, %v", dl, err)
+	}
+
+	// Later syncs skip the video until it is requeued.
+	result, err = c.SyncChannel(ctx, "chan", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != 2 || downloader.downloads["private"] != 1 {
+		t.Fatalf("dead-lettered video was not skipped: %+v", result)
+	}
+	if err := c.SyncVideo(ctx, "private"); err == nil {
+		t.Fatal("expected single-video sync of a dead-lettered video to fail")
+	}
+
+	if ok, err := store.Requeue(ctx, "private"); err != nil || !ok {
+		t.Fatalf("requeue: %v, %v", ok, err)
+	}
+	result, err = c.SyncChannel(ctx, "chan", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 1 || downloader.downloads["private"] != 2 {
+		t.Fatalf("requeued video was not retried: %+v", result)
+	}
+	if ok, _ := store.Requeue(ctx, "private"); ok {
+		t.Fatal("requeue of a video that is not dead-lettered reported success")
+	}
+}
+
+func TestSyncChannelDeadLettersAfterRepeatedTransientFailures(t *testing.T) {
+	ctx := context.Background()
+	flaky := errors.New("HTTP Error 503")
+	downloader := &flakyDownloader{ids: []string{"vid"}, errs: map[string][]error{"vid": {flaky, flaky, flaky, flaky}}}
+	store := newTestStore(t)
+	c := &Controller{
+		Downloader: downloader,
+		Uploader:   &stubUploader{},
+		Store:      store,
+		Retry:      RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, DeadLetterAfter: 3},
+	}
+
+	result, err := c.SyncChannel(ctx, "chan", 1)
+	if err != nil || result.Failed != 1 || result.DeadLettered != 0 {
+		t.Fatalf("first sync: %+v, %v", result, err)
+	}
+	result, err = c.SyncChannel(ctx, "chan", 1)
+	if err != nil || result.DeadLettered != 1 {
+		t.Fatalf("second sync: %+v, %v", result, err)
+	}
+	if downloader.downloads["vid"] != 3 {
+		t.Fatalf("expected 3 download attempts, got %d", downloader.downloads["vid"])
+	}
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+)
+
+// Command is one invocation of an external tool. Stdout and Stderr may be
+// nil to discard the stream, or the same writer to combine them.
+type Command struct {
+	Name   string
+	Args   []string
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// CommandRunner runs external tools (yt-dlp, biliup, ffmpeg). Tests swap in
+// a fake that replays recorded output instead of spawning processes.
+type CommandRunner interface {
+	Run(ctx context.Context, cmd Command) error
+}
+
+// ExecRunner runs commands with os/exec.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, c Command) error {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return cmd.Run()
+}
+
+func runnerOrDefault(r CommandRunner) CommandRunner {
+	if r == nil {
+		return ExecRunner{}
+	}
+	return r
+}
+
+// combinedOutput runs name and returns its interleaved stdout and stderr,
+// like exec.Cmd.CombinedOutput.
+func combinedOutput(ctx context.Context, r CommandRunner, name string, args ...string) ([]byte, error) {
+	var out bytes.Buffer
+	err := runnerOrDefault(r).Run(ctx, Command{Name: name, Args: args, Stdout: &out, Stderr: &out})
+	return out.Bytes(), err
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeStep is one scripted command: the binary and arguments the code under
+// test is expected to run, and the output and exit code to replay.
+type fakeStep struct {
+	name     string
+	contains []string
+	stdout   string
+	stderr   string
+	exitCode int
+	// create lists files to write before the output is replayed, the way
+	// yt-dlp leaves downloads on disk.
+	create []string
+}
+
+// fakeRunner replays a script of recorded yt-dlp/biliup/ffmpeg runs and
+// fails the test on any command it was not told about. Each command
+// consumes the first unused step it matches, so steps for one video stay in
+// order while the pipeline interleaves videos.
+type fakeRunner struct {
+	t *testing.T
+
+	mu     sync.Mutex
+	script []fakeStep
+	calls  []Command
+}
+
+func newFakeRunner(t *testing.T, script ...fakeStep) *fakeRunner {
+	f := &fakeRunner{t: t, script: script}
+	t.Cleanup(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.script) > 0 {
+			t.Errorf("%d scripted command(s) never ran, next: %s %v", len(f.script), f.script[0].name, f.script[0].contains)
+		}
+	})
+	return f
+}
+
+func (s fakeStep) matches(cmd Command) bool {
+	if cmd.Name != s.name {
+		return false
+	}
+	for _, want := range s.contains {
+		if !hasArg(cmd.Args, want) {
+			return false
+		}
+	}
+	return true
+}
+
+type fakeExitError struct{ code int }
+
+func (e *fakeExitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+
+func (f *fakeRunner) Run(ctx context.Context, cmd Command) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, cmd)
+	index := -1
+	for i, step := range f.script {
+		if step.matches(cmd) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		f.mu.Unlock()
+		f.t.Errorf("unexpected command: %s %s", cmd.Name, strings.Join(cmd.Args, " "))
+		return errors.New("unexpected command")
+	}
+	step := f.script[index]
+	f.script = append(f.script[:index:index], f.script[index+1:]...)
+	f.mu.Unlock()
+
+	for _, path := range step.create {
+		if err := os.WriteFile(path, []byte("media"), 0o644); err != nil {
+			f.t.Error(err)
+		}
+	}
+	replay(cmd.Stdout, step.stdout)
+	replay(cmd.Stderr, step.stderr)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if step.exitCode != 0 {
+		return &fakeExitError{code: step.exitCode}
+	}
+	return nil
+}
+
+func (f *fakeRunner) commands() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.calls...)
+}
+
+func hasArg(args []string, want string) bool {
+	for _, arg := range args {
+		if arg == want {
+			return true
+		}
+	}
+	return false
+}
+
+func replay(w io.Writer, output string) {
+	if w != nil && output != "" {
+		io.WriteString(w, output)
+	}
+}
+
+// stubExecutables makes LookPath report exactly the given tools as
+// installed, so argument lists do not depend on the test machine.
+func stubExecutables(t *testing.T, names ...string) {
+	restore := LookPath
+	t.Cleanup(func() { LookPath = restore })
+	LookPath = func(name string) (string, error) {
+		for _, n := range names {
+			if n == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+}
+
+func TestRunYtDlpSeparatesProgressFromFiles(t *testing.T) {
+	runner := newFakeRunner(t, fakeStep{
+		name:   "yt-dlp",
+		stdout: "[yttransfer-progress] abc|  50.0%|1.00MiB/s|00:10\r[yttransfer-progress] abc| 100.0%|1.00MiB/s|00:00\n/tmp/out/clip.mp4\nNA\n",
+		stderr: "WARNING: SABR streaming",
+	})
+	var events []ProgressEvent
+	ctx := WithProgress(context.Background(), func(ev ProgressEvent) { events = append(events, ev) })
+
+	res, err := runYtDlp(ctx, runner, []string{"https://youtu.be/abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.files) != 2 || res.files[0] != "/tmp/out/clip.mp4" {
+		t.Fatalf("files=%v", res.files)
+	}
+	if !strings.Contains(res.stderr, "SABR streaming") {
+		t.Fatalf("stderr=%q", res.stderr)
+	}
+	if len(events) != 2 || events[1].Percent != 100 {
+		t.Fatalf("events=%+v", events)
+	}
+}
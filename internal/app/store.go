@@ -3,13 +3,163 @@ package app
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// JobState is the position of a single video in the download/upload pipeline.
+type JobState string
+
+const (
+	JobDiscovered  JobState = "discovered"
+	JobDownloading JobState = "downloading"
+	JobDownloaded  JobState = "downloaded"
+	JobUploading   JobState = "uploading"
+	JobUploaded    JobState = "uploaded"
+	JobFailed      JobState = "failed"
+)
+
+// DeadLetter records a video the controller gave up on. Syncs skip it until
+// it is requeued.
+type DeadLetter struct {
+	VideoID   string
+	ChannelID string
+	Stage     string
+	Attempts  int
+	Error     string
+	FailedAt  time.Time
+}
+
+// UploadRecord is one video published to one destination.
+type UploadRecord struct {
+	VideoID   string
+	ChannelID string
+	Platform  string
+	Account   string
+	// RemoteID and URL identify what the uploader created; they are
+	// empty for uploaders that cannot tell. Videos split into several
+	// files record the IDs comma-separated and the first URL.
+	RemoteID string
+	URL      string
+	// Partial marks a video split into several files that reached the
+	// destination only in part; Files names the ones that did. IsUploaded
+	// ignores partial records.
+	Partial    bool
+	Files      []string
+	UploadedAt time.Time
+}
+
+// ChannelRun is the last completed scheduled sync of a watched channel.
+type ChannelRun struct {
+	ChannelID  string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	LastError  string
+}
+
+// VideoJob is the persisted progress of one video through the pipeline.
+type VideoJob struct {
+	VideoID   string
+	ChannelID string
+	State     JobState
+	Attempts  int
+	LastError string
+	Files     []string
+	UpdatedAt time.Time
+}
+
+// Store persists pipeline state, subscriptions and WebSub leases. The
+// SQLite and PostgreSQL implementations share their SQL and must pass the
+// same conformance tests (store_test.go).
+type Store interface {
+	Close() error
+	EnsureSchema(ctx context.Context) error
+	SchemaStatus(ctx context.Context) (*SchemaStatus, error)
+
+	IsUploaded(ctx context.Context, videoID, platform, account string) (bool, error)
+	MarkUploaded(ctx context.Context, rec UploadRecord) error
+	Uploads(ctx context.Context, videoID string) ([]UploadRecord, error)
+	GetJob(ctx context.Context, videoID string) (*VideoJob, error)
+	SaveJob(ctx context.Context, job *VideoJob) error
+	PendingJobs(ctx context.Context, channelID string) ([]VideoJob, error)
+	RecentJobs(ctx context.Context, channelID string, limit int) ([]VideoJob, error)
+	JobCounts(ctx context.Context) (map[JobState]int, error)
+	Forget(ctx context.Context, videoID string) (bool, error)
+
+	AddDeadLetter(ctx context.Context, dl DeadLetter) error
+	GetDeadLetter(ctx context.Context, videoID string) (*DeadLetter, error)
+	DeadLetters(ctx context.Context) ([]DeadLetter, error)
+	Requeue(ctx context.Context, videoID string) (bool, error)
+
+	LastChannelRun(ctx context.Context, channelID string) (*ChannelRun, error)
+	ChannelRuns(ctx context.Context) ([]ChannelRun, error)
+	RecordChannelRun(ctx context.Context, run ChannelRun) error
+
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	GetSubscription(ctx context.Context, channelID string) (*Subscription, error)
+	AddSubscription(ctx context.Context, sub Subscription) error
+	UpdateSubscription(ctx context.Context, sub Subscription) (bool, error)
+	DeleteSubscription(ctx context.Context, channelID string) (bool, error)
+
+	SaveWebSubLease(ctx context.Context, lease WebSubLease) error
+	GetWebSubLease(ctx context.Context, channelID string) (*WebSubLease, error)
+	WebSubLeases(ctx context.Context) ([]WebSubLease, error)
+	DeleteWebSubLease(ctx context.Context, channelID string) (bool, error)
+}
+
+// OpenStore opens a PostgreSQL store for postgres:// and postgresql://
+// URLs and a SQLite database file otherwise.
+func OpenStore(location string) (Store, error) {
+	if IsPostgresURL(location) {
+		return NewPostgresStore(location)
+	}
+	return NewSQLiteStore(location)
+}
+
+// IsPostgresURL reports whether OpenStore treats location as a PostgreSQL
+// connection URL rather than a SQLite file path.
+func IsPostgresURL(location string) bool {
+	return strings.HasPrefix(location, "postgres://") || strings.HasPrefix(location, "postgresql://")
+}
+
+// sqlDialect holds what differs between the database/sql backends.
+type sqlDialect struct {
+	// migrations holds the dialect's NNNN_name.sql files (migrate.go).
+	migrations fs.FS
+	// tableExists counts the tables called ? in the current schema.
+	tableExists string
+	// numbered rewrites ? placeholders to $1, $2, ...
+	numbered bool
+	// timestamp is the column type of schema_version.applied_at.
+	timestamp string
+	// lock, when set, runs first in the migration transaction to
+	// serialise concurrent migrations.
+	lock string
+}
+
+var sqliteDialect = sqlDialect{
+	migrations:  mustSub(migrationFiles, "migrations/sqlite"),
+	tableExists: `SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	timestamp:   "TIMESTAMP",
+}
+
+// sqlStore implements Store on database/sql. Queries are written with ?
+// placeholders and portable SQL (ON CONFLICT upserts, no engine-specific
+// functions) so both dialects run them unchanged.
+type sqlStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// SQLiteStore keeps the metadata in a local SQLite file.
 type SQLiteStore struct {
-	db *sql.DB
+	sqlStore
 }
 
 func NewSQLiteStore(path string) (*SQLiteStore, error) {
@@ -17,36 +167,575 @@ func NewSQLiteStore(path string) (*SQLiteStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &SQLiteStore{db: db}, nil
+	// The download and upload workers share the store; funnel them through
+	// one connection so concurrent writes queue instead of failing with
+	// SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	return &SQLiteStore{sqlStore{db: db, dialect: sqliteDialect}}, nil
 }
 
-func (s *SQLiteStore) EnsureSchema(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, `
-CREATE TABLE IF NOT EXISTS uploads (
-	video_id TEXT PRIMARY KEY,
-	channel_id TEXT NOT NULL,
-	uploaded_at TIMESTAMP NOT NULL
-);`)
-	return err
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
 }
 
-func (s *SQLiteStore) IsUploaded(ctx context.Context, videoID string) (bool, error) {
+// IsUploaded reports whether videoID was completely published to account
+// on platform.
+func (s *sqlStore) IsUploaded(ctx context.Context, videoID, platform, account string) (bool, error) {
 	var count int
-	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM uploads WHERE video_id = ?`, videoID).Scan(&count); err != nil {
+	if err := s.queryRow(ctx, `
+SELECT COUNT(1) FROM uploads WHERE video_id = ? AND platform = ? AND account = ? AND NOT partial`, videoID, platform, account).Scan(&count); err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
-func (s *SQLiteStore) MarkUploaded(ctx context.Context, videoID, channelID string) error {
-	if channelID == "" {
-		channelID = "unknown"
+// MarkUploaded records (or refreshes) the upload of a video to one
+// destination.
+func (s *sqlStore) MarkUploaded(ctx context.Context, rec UploadRecord) error {
+	if rec.ChannelID == "" {
+		rec.ChannelID = "unknown"
+	}
+	if rec.UploadedAt.IsZero() {
+		rec.UploadedAt = time.Now().UTC()
+	}
+	files, err := json.Marshal(nonNilStrings(rec.Files))
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `
+INSERT INTO uploads (video_id, platform, account, channel_id, remote_id, url, partial, files, uploaded_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(video_id, platform, account) DO UPDATE SET
+	channel_id = excluded.channel_id,
+	remote_id = excluded.remote_id,
+	url = excluded.url,
+	partial = excluded.partial,
+	files = excluded.files,
+	uploaded_at = excluded.uploaded_at;`,
+		rec.VideoID, rec.Platform, rec.Account, rec.ChannelID, rec.RemoteID, rec.URL, rec.Partial, string(files), rec.UploadedAt.UTC())
+	return err
+}
+
+// Uploads lists the destinations videoID was published to, including
+// partial uploads, ordered by platform and account.
+func (s *sqlStore) Uploads(ctx context.Context, videoID string) ([]UploadRecord, error) {
+	rows, err := s.query(ctx, `
+SELECT video_id, platform, account, channel_id, remote_id, url, partial, files, uploaded_at
+FROM uploads WHERE video_id = ? ORDER BY platform, account`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []UploadRecord
+	for rows.Next() {
+		var rec UploadRecord
+		var files string
+		if err := rows.Scan(&rec.VideoID, &rec.Platform, &rec.Account, &rec.ChannelID, &rec.RemoteID, &rec.URL, &rec.Partial, &files, &rec.UploadedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(files), &rec.Files); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
 	}
-	_, err := s.db.ExecContext(ctx, `
-INSERT INTO uploads (video_id, channel_id, uploaded_at)
-VALUES (?, ?, ?)
+	return records, rows.Err()
+}
+
+// GetJob returns the persisted job for videoID, or nil when the video has
+// never been seen.
+func (s *sqlStore) GetJob(ctx context.Context, videoID string) (*VideoJob, error) {
+	row := s.queryRow(ctx, `
+SELECT video_id, channel_id, state, attempts, last_error, files, updated_at
+FROM jobs WHERE video_id = ?`, videoID)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// SaveJob upserts the job row and stamps its UpdatedAt.
+func (s *sqlStore) SaveJob(ctx context.Context, job *VideoJob) error {
+	if job.ChannelID == "" {
+		job.ChannelID = "unknown"
+	}
+	files, err := json.Marshal(nonNilStrings(job.Files))
+	if err != nil {
+		return err
+	}
+	job.UpdatedAt = time.Now().UTC()
+	_, err = s.exec(ctx, `
+INSERT INTO jobs (video_id, channel_id, state, attempts, last_error, files, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
 ON CONFLICT(video_id) DO UPDATE SET
 	channel_id = excluded.channel_id,
-	uploaded_at = excluded.uploaded_at;`, videoID, channelID, time.Now().UTC())
+	state = excluded.state,
+	attempts = excluded.attempts,
+	last_error = excluded.last_error,
+	files = excluded.files,
+	updated_at = excluded.updated_at;`,
+		job.VideoID, job.ChannelID, string(job.State), job.Attempts, job.LastError, string(files), job.UpdatedAt)
+	return err
+}
+
+// PendingJobs lists jobs of channelID that were started but never reached
+// the uploaded state, oldest first, so an interrupted sync can pick them up.
+func (s *sqlStore) PendingJobs(ctx context.Context, channelID string) ([]VideoJob, error) {
+	rows, err := s.query(ctx, `
+SELECT video_id, channel_id, state, attempts, last_error, files, updated_at
+FROM jobs WHERE channel_id = ? AND state NOT IN (?, ?)
+ORDER BY updated_at ASC`, channelID, string(JobUploaded), string(JobFailed))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []VideoJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// RecentJobs lists the most recently updated jobs, newest first, limited
+// to channelID unless it is empty.
+func (s *sqlStore) RecentJobs(ctx context.Context, channelID string, limit int) ([]VideoJob, error) {
+	rows, err := s.query(ctx, `
+SELECT video_id, channel_id, state, attempts, last_error, files, updated_at
+FROM jobs WHERE ? = '' OR channel_id = ?
+ORDER BY updated_at DESC LIMIT ?`, channelID, channelID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []VideoJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// JobCounts returns the number of jobs in each state.
+func (s *sqlStore) JobCounts(ctx context.Context) (map[JobState]int, error) {
+	rows, err := s.query(ctx, `SELECT state, COUNT(1) FROM jobs GROUP BY state`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[JobState]int{}
+	for rows.Next() {
+		var (
+			state string
+			n     int
+		)
+		if err := rows.Scan(&state, &n); err != nil {
+			return nil, err
+		}
+		counts[JobState(state)] = n
+	}
+	return counts, rows.Err()
+}
+
+// Forget deletes everything recorded about videoID (upload, job and
+// dead-letter rows) so the next channel sync treats it as new. It reports
+// false when nothing was recorded.
+func (s *sqlStore) Forget(ctx context.Context, videoID string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var removed int64
+	for _, table := range []string{"uploads", "jobs", "dead_letters"} {
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM `+table+` WHERE video_id = ?`), videoID)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		removed += n
+	}
+	return removed > 0, tx.Commit()
+}
+
+// AddDeadLetter records (or refreshes) a dead-lettered video.
+func (s *sqlStore) AddDeadLetter(ctx context.Context, dl DeadLetter) error {
+	if dl.ChannelID == "" {
+		dl.ChannelID = "unknown"
+	}
+	if dl.FailedAt.IsZero() {
+		dl.FailedAt = time.Now().UTC()
+	}
+	_, err := s.exec(ctx, `
+INSERT INTO dead_letters (video_id, channel_id, stage, attempts, error, failed_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(video_id) DO UPDATE SET
+	channel_id = excluded.channel_id,
+	stage = excluded.stage,
+	attempts = excluded.attempts,
+	error = excluded.error,
+	failed_at = excluded.failed_at;`,
+		dl.VideoID, dl.ChannelID, dl.Stage, dl.Attempts, dl.Error, dl.FailedAt)
+	return err
+}
+
+// GetDeadLetter returns the dead-letter entry of videoID, or nil when the
+// video is not dead-lettered.
+func (s *sqlStore) GetDeadLetter(ctx context.Context, videoID string) (*DeadLetter, error) {
+	row := s.queryRow(ctx, `
+SELECT video_id, channel_id, stage, attempts, error, failed_at
+FROM dead_letters WHERE video_id = ?`, videoID)
+	var dl DeadLetter
+	err := row.Scan(&dl.VideoID, &dl.ChannelID, &dl.Stage, &dl.Attempts, &dl.Error, &dl.FailedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// DeadLetters lists all dead-lettered videos, most recent first.
+func (s *sqlStore) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	rows, err := s.query(ctx, `
+SELECT video_id, channel_id, stage, attempts, error, failed_at
+FROM dead_letters ORDER BY failed_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []DeadLetter
+	for rows.Next() {
+		var dl DeadLetter
+		if err := rows.Scan(&dl.VideoID, &dl.ChannelID, &dl.Stage, &dl.Attempts, &dl.Error, &dl.FailedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, dl)
+	}
+	return list, rows.Err()
+}
+
+// Requeue removes videoID from the dead-letter table and resets its job so
+// the next channel sync picks it up again as pending, reusing already
+// downloaded files. It reports false when the video was not dead-lettered.
+func (s *sqlStore) Requeue(ctx context.Context, videoID string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM dead_letters WHERE video_id = ?`), videoID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`
+UPDATE jobs SET
+	state = CASE WHEN files = '[]' THEN ? ELSE ? END,
+	attempts = 0,
+	last_error = '',
+	updated_at = ?
+WHERE video_id = ?`), string(JobDiscovered), string(JobDownloaded), time.Now().UTC(), videoID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// LastChannelRun returns the last recorded run of channelID, or nil when
+// the channel was never synced by the scheduler.
+func (s *sqlStore) LastChannelRun(ctx context.Context, channelID string) (*ChannelRun, error) {
+	var run ChannelRun
+	err := s.queryRow(ctx, `
+SELECT channel_id, started_at, finished_at, last_error FROM channel_runs WHERE channel_id = ?`, channelID).
+		Scan(&run.ChannelID, &run.StartedAt, &run.FinishedAt, &run.LastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ChannelRuns lists the last run of every scheduled channel, ordered by
+// channel ID.
+func (s *sqlStore) ChannelRuns(ctx context.Context) ([]ChannelRun, error) {
+	rows, err := s.query(ctx, `
+SELECT channel_id, started_at, finished_at, last_error FROM channel_runs ORDER BY channel_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []ChannelRun
+	for rows.Next() {
+		var run ChannelRun
+		if err := rows.Scan(&run.ChannelID, &run.StartedAt, &run.FinishedAt, &run.LastError); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// RecordChannelRun upserts the last run of a channel.
+func (s *sqlStore) RecordChannelRun(ctx context.Context, run ChannelRun) error {
+	_, err := s.exec(ctx, `
+INSERT INTO channel_runs (channel_id, started_at, finished_at, last_error)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(channel_id) DO UPDATE SET
+	started_at = excluded.started_at,
+	finished_at = excluded.finished_at,
+	last_error = excluded.last_error;`,
+		run.ChannelID, run.StartedAt.UTC(), run.FinishedAt.UTC(), run.LastError)
 	return err
 }
+
+const subscriptionColumns = `channel_id, platforms, video_limit, schedule, title_template,
+description_template, dynamic_template, tags_template, enabled, created_at, updated_at`
+
+// ListSubscriptions returns all subscriptions ordered by channel ID.
+func (s *sqlStore) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	rows, err := s.query(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions ORDER BY channel_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// GetSubscription returns the subscription of channelID, or nil when the
+// channel is not subscribed.
+func (s *sqlStore) GetSubscription(ctx context.Context, channelID string) (*Subscription, error) {
+	row := s.queryRow(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE channel_id = ?`, channelID)
+	sub, err := scanSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// AddSubscription inserts sub, failing with ErrSubscriptionExists when the
+// channel is already subscribed.
+func (s *sqlStore) AddSubscription(ctx context.Context, sub Subscription) error {
+	platforms, err := json.Marshal(nonNilStrings(sub.Platforms))
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	res, err := s.exec(ctx, `
+INSERT INTO subscriptions (`+subscriptionColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(channel_id) DO NOTHING;`,
+		sub.ChannelID, string(platforms), sub.Limit, sub.Schedule, sub.Templates.Title,
+		sub.Templates.Description, sub.Templates.Dynamic, sub.Templates.Tags, sub.Enabled, now, now)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSubscriptionExists
+	}
+	return nil
+}
+
+// UpdateSubscription overwrites the settings of an existing subscription
+// and reports whether it existed.
+func (s *sqlStore) UpdateSubscription(ctx context.Context, sub Subscription) (bool, error) {
+	platforms, err := json.Marshal(nonNilStrings(sub.Platforms))
+	if err != nil {
+		return false, err
+	}
+	res, err := s.exec(ctx, `
+UPDATE subscriptions SET
+	platforms = ?, video_limit = ?, schedule = ?, title_template = ?,
+	description_template = ?, dynamic_template = ?, tags_template = ?, enabled = ?, updated_at = ?
+WHERE channel_id = ?`,
+		string(platforms), sub.Limit, sub.Schedule, sub.Templates.Title, sub.Templates.Description,
+		sub.Templates.Dynamic, sub.Templates.Tags, sub.Enabled, time.Now().UTC(), sub.ChannelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteSubscription removes a subscription and reports whether it existed.
+// Jobs and upload records of the channel are kept.
+func (s *sqlStore) DeleteSubscription(ctx context.Context, channelID string) (bool, error) {
+	res, err := s.exec(ctx, `DELETE FROM subscriptions WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SaveWebSubLease upserts the hub subscription state of a channel.
+func (s *sqlStore) SaveWebSubLease(ctx context.Context, lease WebSubLease) error {
+	_, err := s.exec(ctx, `
+INSERT INTO websub_leases (channel_id, topic, state, expires_at, updated_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(channel_id) DO UPDATE SET
+	topic = excluded.topic,
+	state = excluded.state,
+	expires_at = excluded.expires_at,
+	updated_at = excluded.updated_at;`,
+		lease.ChannelID, lease.Topic, string(lease.State), lease.ExpiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+// GetWebSubLease returns the hub subscription of channelID, or nil when
+// none was requested.
+func (s *sqlStore) GetWebSubLease(ctx context.Context, channelID string) (*WebSubLease, error) {
+	row := s.queryRow(ctx, `
+SELECT channel_id, topic, state, expires_at, updated_at FROM websub_leases WHERE channel_id = ?`, channelID)
+	lease, err := scanWebSubLease(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return lease, err
+}
+
+// WebSubLeases lists all hub subscriptions ordered by channel ID.
+func (s *sqlStore) WebSubLeases(ctx context.Context) ([]WebSubLease, error) {
+	rows, err := s.query(ctx, `
+SELECT channel_id, topic, state, expires_at, updated_at FROM websub_leases ORDER BY channel_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leases []WebSubLease
+	for rows.Next() {
+		lease, err := scanWebSubLease(rows)
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, *lease)
+	}
+	return leases, rows.Err()
+}
+
+// DeleteWebSubLease forgets the hub subscription of a channel and reports
+// whether there was one.
+func (s *sqlStore) DeleteWebSubLease(ctx context.Context, channelID string) (bool, error) {
+	res, err := s.exec(ctx, `DELETE FROM websub_leases WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func scanWebSubLease(row rowScanner) (*WebSubLease, error) {
+	var (
+		lease WebSubLease
+		state string
+	)
+	if err := row.Scan(&lease.ChannelID, &lease.Topic, &state, &lease.ExpiresAt, &lease.UpdatedAt); err != nil {
+		return nil, err
+	}
+	lease.State = WebSubState(state)
+	return &lease, nil
+}
+
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	var (
+		sub       Subscription
+		platforms string
+	)
+	err := row.Scan(&sub.ChannelID, &platforms, &sub.Limit, &sub.Schedule, &sub.Templates.Title,
+		&sub.Templates.Description, &sub.Templates.Dynamic, &sub.Templates.Tags, &sub.Enabled,
+		&sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(platforms), &sub.Platforms); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*VideoJob, error) {
+	var (
+		job   VideoJob
+		state string
+		files string
+	)
+	if err := row.Scan(&job.VideoID, &job.ChannelID, &state, &job.Attempts, &job.LastError, &files, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
+	job.State = JobState(state)
+	if err := json.Unmarshal([]byte(files), &job.Files); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore keeps the metadata in a PostgreSQL database so several
+// hosts can share one queue and upload history.
+type PostgresStore struct {
+	sqlStore
+}
+
+var postgresDialect = sqlDialect{
+	migrations:  mustSub(migrationFiles, "migrations/postgres"),
+	tableExists: `SELECT COUNT(1) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`,
+	numbered:    true,
+	timestamp:   "TIMESTAMPTZ",
+	// Hosts sharing the database may start at once; the first one
+	// migrates while the others wait and then find nothing to do.
+	lock: `SELECT pg_advisory_xact_lock(7368706)`,
+}
+
+// NewPostgresStore connects to the database at dsn, a postgres:// URL or
+// a key=value connection string as understood by lib/pq.
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{sqlStore{db: db, dialect: postgresDialect}}, nil
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSubscriptionExists is returned by AddSubscription for a channel that
+// is already subscribed.
+var ErrSubscriptionExists = errors.New("channel is already subscribed")
+
+// Subscription is a channel the team mirrors, with its own sync settings.
+type Subscription struct {
+	ChannelID string
+	// Platforms lists the targets to publish to; empty means the
+	// controller's default uploader.
+	Platforms []string
+	Limit     int
+	// Schedule is a ParseSchedule spec. Empty means the channel is only
+	// synced on demand.
+	Schedule string
+	// Templates override the uploader's metadata templates field by field
+	// for this channel's videos.
+	Templates MetadataTemplates
+	// Enabled subscriptions are synced by the watcher; disabled ones keep
+	// their settings but are not scheduled.
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Validate checks the limit, schedule and templates and normalises the
+// platform names.
+func (s *Subscription) Validate() error {
+	s.ChannelID = strings.TrimSpace(s.ChannelID)
+	if s.ChannelID == "" {
+		return errors.New("channel_id is required")
+	}
+	if s.Limit <= 0 {
+		return errors.New("limit must be > 0")
+	}
+	if s.Schedule != "" {
+		if _, err := ParseSchedule(s.Schedule); err != nil {
+			return err
+		}
+	}
+	if err := s.Templates.Validate(); err != nil {
+		return err
+	}
+	platforms := make([]string, 0, len(s.Platforms))
+	seen := map[string]bool{}
+	for _, p := range s.Platforms {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		platforms = append(platforms, p)
+	}
+	s.Platforms = platforms
+	return nil
+}
+
+// SubscriptionPatch changes the fields of a Subscription that are non-nil.
+type SubscriptionPatch struct {
+	Platforms   *[]string
+	Limit       *int
+	Schedule    *string
+	Title       *string
+	Description *string
+	Dynamic     *string
+	Tags        *string
+	Enabled     *bool
+}
+
+// Apply returns sub with the patch applied. Call Validate on the result.
+func (p SubscriptionPatch) Apply(sub Subscription) Subscription {
+	if p.Platforms != nil {
+		sub.Platforms = append([]string(nil), (*p.Platforms)...)
+	}
+	if p.Limit != nil {
+		sub.Limit = *p.Limit
+	}
+	if p.Schedule != nil {
+		sub.Schedule = strings.TrimSpace(*p.Schedule)
+	}
+	if p.Title != nil {
+		sub.Templates.Title = *p.Title
+	}
+	if p.Description != nil {
+		sub.Templates.Description = *p.Description
+	}
+	if p.Dynamic != nil {
+		sub.Templates.Dynamic = *p.Dynamic
+	}
+	if p.Tags != nil {
+		sub.Templates.Tags = *p.Tags
+	}
+	if p.Enabled != nil {
+		sub.Enabled = *p.Enabled
+	}
+	return sub
+}
+
+// watchEntry turns an enabled, scheduled subscription into a WatchEntry.
+func (s Subscription) watchEntry(jitter time.Duration) (WatchEntry, error) {
+	schedule, err := ParseSchedule(s.Schedule)
+	if err != nil {
+		return WatchEntry{}, fmt.Errorf("subscription %s: %w", s.ChannelID, err)
+	}
+	return WatchEntry{ChannelID: s.ChannelID, Limit: s.Limit, Schedule: schedule, Jitter: jitter}, nil
+}
+
+// subscriptionTemplates returns the metadata templates of the subscription
+// covering a video, looked up by the job's channel and then by the channel
+// in the video's info.json. It returns nil when no subscription sets any.
+func (c *Controller) subscriptionTemplates(ctx context.Context, channelID string, meta *VideoMetadata) (*MetadataTemplates, error) {
+	candidates := []string{channelID}
+	if meta != nil && meta.ChannelID != channelID {
+		candidates = append(candidates, meta.ChannelID)
+	}
+	for _, id := range candidates {
+		if !knownChannel(id) {
+			continue
+		}
+		sub, err := c.Store.GetSubscription(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if sub != nil && sub.Templates != (MetadataTemplates{}) {
+			return &sub.Templates, nil
+		}
+	}
+	return nil, nil
+}
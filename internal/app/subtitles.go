@@ -0,0 +1,216 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubtitleMode selects how downloaded subtitles are published.
+type SubtitleMode string
+
+const (
+	// SubtitlesOff skips subtitle downloads entirely.
+	SubtitlesOff SubtitleMode = "none"
+	// SubtitlesBurn renders the preferred subtitle track into the video.
+	SubtitlesBurn SubtitleMode = "burn"
+	// SubtitlesCC hands subtitle files to the uploader to attach as closed
+	// captions (Bilibili CC subtitles).
+	SubtitlesCC SubtitleMode = "cc"
+)
+
+// SubtitleOptions configures subtitle download and publishing.
+type SubtitleOptions struct {
+	Mode SubtitleMode
+	// Languages are yt-dlp --sub-langs entries in preference order, e.g.
+	// "zh-Hans", "zh.*", "en".
+	Languages []string
+	// Auto also fetches YouTube's auto-generated (and auto-translated)
+	// captions when no manual track exists.
+	Auto bool
+	// Format is the file format subtitles are converted to: srt or ass.
+	Format string
+}
+
+func (o SubtitleOptions) enabled() bool {
+	return o.Mode == SubtitlesBurn || o.Mode == SubtitlesCC
+}
+
+// Validate reports unsupported modes or formats.
+func (o SubtitleOptions) Validate() error {
+	switch o.Mode {
+	case "", SubtitlesOff, SubtitlesBurn, SubtitlesCC:
+	default:
+		return fmt.Errorf("subtitle mode must be none, burn or cc")
+	}
+	switch o.Format {
+	case "", "srt", "ass":
+	default:
+		return fmt.Errorf("subtitle format must be srt or ass")
+	}
+	if o.enabled() && len(o.Languages) == 0 {
+		return fmt.Errorf("subtitle languages are required when subtitles are enabled")
+	}
+	return nil
+}
+
+// ytDlpArgs returns the yt-dlp flags that download the configured tracks.
+func (o SubtitleOptions) ytDlpArgs(hasFFmpeg bool) []string {
+	if !o.enabled() {
+		return nil
+	}
+	args := []string{"--write-subs", "--sub-langs", strings.Join(o.Languages, ",")}
+	if o.Auto {
+		args = append(args, "--write-auto-subs")
+	}
+	if hasFFmpeg {
+		args = append(args, "--convert-subs", firstNonEmpty(o.Format, "srt"))
+	}
+	return args
+}
+
+// Subtitle is a downloaded subtitle track.
+type Subtitle struct {
+	Path     string
+	Language string
+}
+
+var subtitleExtensions = []string{".srt", ".ass", ".vtt"}
+
+// findSubtitles lists <video base>.<lang>.<ext> files yt-dlp wrote next to
+// video, ordered by the position of their language in preferred.
+func findSubtitles(video string, preferred []string) []Subtitle {
+	base := strings.TrimSuffix(video, filepath.Ext(video))
+	var subs []Subtitle
+	for _, ext := range subtitleExtensions {
+		matches, _ := filepath.Glob(escapeGlob(base) + ".*" + ext)
+		for _, match := range matches {
+			lang := strings.TrimSuffix(strings.TrimPrefix(match, base+"."), ext)
+			if lang == "" || strings.Contains(lang, ".") {
+				continue
+			}
+			subs = append(subs, Subtitle{Path: match, Language: lang})
+		}
+	}
+	sort.SliceStable(subs, func(i, j int) bool {
+		return languageRank(subs[i].Language, preferred) < languageRank(subs[j].Language, preferred)
+	})
+	return subs
+}
+
+func languageRank(lang string, preferred []string) int {
+	for i, pattern := range preferred {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err == nil && re.MatchString(lang) {
+			return i
+		}
+	}
+	return len(preferred)
+}
+
+func escapeGlob(path string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(path)
+}
+
+// BurnSubtitles renders sub into video with ffmpeg and returns the path of
+// the new file, <name>.subbed.mp4. An existing output is reused so a
+// resumed job does not encode twice. A nil runner uses ExecRunner.
+func BurnSubtitles(ctx context.Context, runner CommandRunner, video string, sub Subtitle) (string, error) {
+	dst := strings.TrimSuffix(video, filepath.Ext(video)) + ".subbed.mp4"
+	if fileExists(dst) {
+		return dst, nil
+	}
+	tmp := dst + ".part.mp4"
+	args := []string{
+		"-y", "-loglevel", "error",
+		"-i", video,
+		"-vf", "subtitles=" + escapeFilterValue(sub.Path),
+		"-c:a", "copy",
+		tmp,
+	}
+	if out, err := combinedOutput(ctx, runner, "ffmpeg", args...); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("ffmpeg subtitle burn-in failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// escapeFilterValue quotes a path for use as an ffmpeg filter option.
+func escapeFilterValue(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `:`, `\:`, `'`, `\'`).Replace(value)
+	return "'" + value + "'"
+}
+
+// SubtitleCue is one timed caption line.
+type SubtitleCue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+var cueTimingPattern = regexp.MustCompile(`(\d+):(\d{2}):(\d{2})[,.](\d{3})\s*-->\s*(\d+):(\d{2}):(\d{2})[,.](\d{3})`)
+
+// ParseSubtitleCues reads an SRT or WebVTT file.
+func ParseSubtitleCues(path string) ([]SubtitleCue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		cues    []SubtitleCue
+		current *SubtitleCue
+		text    []string
+	)
+	flush := func() {
+		if current != nil && len(text) > 0 {
+			current.Text = strings.Join(text, "\n")
+			cues = append(cues, *current)
+		}
+		current, text = nil, nil
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if m := cueTimingPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			current = &SubtitleCue{Start: cueTime(m[1:5]), End: cueTime(m[5:9])}
+			continue
+		}
+		if line == "" {
+			flush()
+			continue
+		}
+		if current != nil {
+			text = append(text, line)
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no subtitle cues found in %s", path)
+	}
+	return cues, nil
+}
+
+func cueTime(parts []string) time.Duration {
+	var n [4]int
+	for i, p := range parts {
+		n[i], _ = strconv.Atoi(p)
+	}
+	return time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute +
+		time.Duration(n[2])*time.Second + time.Duration(n[3])*time.Millisecond
+}
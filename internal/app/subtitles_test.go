@@ -0,0 +1,72 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindSubtitlesOrdersByPreference(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "clip [abc].mp4")
+	for _, name := range []string{"clip [abc].mp4", "clip [abc].en.srt", "clip [abc].zh-Hant.srt", "clip [abc].zh-Hans.vtt", "clip [abc].info.json", "other.en.srt"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+
+	subs := findSubtitles(video, []string{"zh-Hans", "zh.*", "en"})
+	var langs []string
+	for _, sub := range subs {
+		langs = append(langs, sub.Language)
+	}
+	want := []string{"zh-Hans", "zh-Hant", "en"}
+	if len(langs) != len(want) {
+		t.Fatalf("languages=%v, want %v", langs, want)
+	}
+	for i := range want {
+		if langs[i] != want[i] {
+			t.Fatalf("languages=%v, want %v", langs, want)
+		}
+	}
+}
+
+func TestParseSubtitleCues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.en.vtt")
+	vtt := "\ufeffWEBVTT\n\n00:00:01.000 --> 00:00:02.000 align:start\nHello\nthere\n\n01:02:03.450 --> 01:02:04.000\nBye\n"
+	if err := os.WriteFile(path, []byte(vtt), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cues, err := ParseSubtitleCues(path)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(cues) != 2 || cues[0].Text != "Hello\nthere" || cues[0].End != 2*time.Second {
+		t.Fatalf("unexpected cues: %+v", cues)
+	}
+	if want := time.Hour + 2*time.Minute + 3450*time.Millisecond; cues[1].Start != want {
+		t.Fatalf("start=%v, want %v", cues[1].Start, want)
+	}
+}
+
+func TestSubtitleOptionsValidate(t *testing.T) {
+	if err := (SubtitleOptions{Mode: SubtitlesCC}).Validate(); err == nil {
+		t.Fatal("expected error for cc mode without languages")
+	}
+	if err := (SubtitleOptions{Mode: SubtitlesBurn, Languages: []string{"en"}, Format: "vtt"}).Validate(); err == nil {
+		t.Fatal("expected error for vtt format")
+	}
+	opts := SubtitleOptions{Mode: SubtitlesCC, Languages: []string{"zh.*", "en"}, Auto: true}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	args := opts.ytDlpArgs(true)
+	want := []string{"--write-subs", "--sub-langs", "zh.*,en", "--write-auto-subs", "--convert-subs", "srt"}
+	if len(args) != len(want) {
+		t.Fatalf("args=%v, want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("args=%v, want %v", args, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultTitleTemplate       = `{{.Title}}`
+	DefaultDescriptionTemplate = `{{with .Description}}{{.}}{{else}}Uploaded automatically: {{.Title}}{{end}}{{with .URL}}
+
+Source: {{.}}{{end}}`
+	DefaultTagsTemplate = `{{join "," .Tags}}`
+)
+
+// MetadataTemplates holds text/template sources for the fields an upload is
+// published with. Empty fields use the Default*Template constants; an empty
+// Dynamic reuses the rendered description.
+type MetadataTemplates struct {
+	Title       string
+	Description string
+	Dynamic     string
+	// Tags renders to a comma-separated list.
+	Tags string
+}
+
+// TemplateData is what metadata templates are executed against.
+type TemplateData struct {
+	ID          string
+	Title       string
+	Description string
+	Channel     string
+	ChannelID   string
+	ChannelURL  string
+	URL         string
+	UploadDate  time.Time
+	Duration    time.Duration
+	Tags        []string
+	Categories  []string
+	Chapters    []Chapter
+	Filename    string
+}
+
+// RenderedMetadata is the result of executing MetadataTemplates.
+type RenderedMetadata struct {
+	Title       string
+	Description string
+	Dynamic     string
+	Tags        []string
+}
+
+// NewTemplateData exposes the upload's video metadata to templates. Without
+// an info.json only Title (taken from the file name) and Filename are set.
+func NewTemplateData(req UploadRequest) TemplateData {
+	base := filepath.Base(req.Path)
+	data := TemplateData{
+		Title:    strings.TrimSuffix(base, filepath.Ext(base)),
+		Filename: base,
+	}
+	if strings.TrimSpace(data.Title) == "" {
+		data.Title = base
+	}
+	meta := req.Metadata
+	if meta == nil {
+		return data
+	}
+	if strings.TrimSpace(meta.Title) != "" {
+		data.Title = strings.TrimSpace(meta.Title)
+	}
+	data.ID = meta.ID
+	data.Description = strings.TrimSpace(meta.Description)
+	data.Channel = meta.Channel
+	data.ChannelID = meta.ChannelID
+	data.ChannelURL = meta.ChannelURL
+	data.URL = meta.SourceURL()
+	data.UploadDate = meta.UploadDate
+	data.Duration = meta.Duration
+	data.Tags = meta.Tags
+	data.Categories = meta.Categories
+	data.Chapters = meta.Chapters
+	return data
+}
+
+// Validate parses every template and executes it against sample data so
+// typos in field or function names are reported at startup rather than on
+// the first upload.
+func (t MetadataTemplates) Validate() error {
+	sample := TemplateData{
+		ID:         "dQw4w9WgXcQ",
+		Title:      "Sample",
+		Channel:    "Channel",
+		URL:        videoURL("dQw4w9WgXcQ"),
+		UploadDate: time.Now(),
+		Duration:   time.Minute,
+		Tags:       []string{"tag"},
+		Chapters:   []Chapter{{Title: "Intro", End: time.Minute}},
+		Filename:   "Sample.mp4",
+	}
+	_, err := t.Render(sample)
+	return err
+}
+
+// Override returns t with every non-empty field of o taking precedence.
+func (t MetadataTemplates) Override(o MetadataTemplates) MetadataTemplates {
+	t.Title = firstNonEmpty(o.Title, t.Title)
+	t.Description = firstNonEmpty(o.Description, t.Description)
+	t.Dynamic = firstNonEmpty(o.Dynamic, t.Dynamic)
+	t.Tags = firstNonEmpty(o.Tags, t.Tags)
+	return t
+}
+
+// Render executes the templates against data.
+func (t MetadataTemplates) Render(data TemplateData) (RenderedMetadata, error) {
+	var (
+		out RenderedMetadata
+		err error
+	)
+	if out.Title, err = renderTemplate("title", firstNonEmpty(t.Title, DefaultTitleTemplate), data); err != nil {
+		return out, err
+	}
+	if out.Description, err = renderTemplate("description", firstNonEmpty(t.Description, DefaultDescriptionTemplate), data); err != nil {
+		return out, err
+	}
+	out.Dynamic = out.Description
+	if strings.TrimSpace(t.Dynamic) != "" {
+		if out.Dynamic, err = renderTemplate("dynamic", t.Dynamic, data); err != nil {
+			return out, err
+		}
+	}
+	tags, err := renderTemplate("tags", firstNonEmpty(t.Tags, DefaultTagsTemplate), data)
+	if err != nil {
+		return out, err
+	}
+	out.Tags = filterEmpty(strings.Split(tags, ","))
+	return out, nil
+}
+
+func renderTemplate(name, source string, data TemplateData) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("rendering %s template: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+var templateFuncs = template.FuncMap{
+	"truncate": truncateWithEllipsis,
+	"date":     formatDate,
+	"duration": formatClock,
+	"join":     func(sep string, values []string) string { return strings.Join(values, sep) },
+	"default": func(fallback, value string) string {
+		if strings.TrimSpace(value) == "" {
+			return fallback
+		}
+		return value
+	},
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+}
+
+// truncateWithEllipsis shortens value to at most limit runes, marking the
+// cut with "…". Use it as {{truncate 80 .Title}} for Bilibili titles.
+func truncateWithEllipsis(limit int, value string) string {
+	runes := []rune(value)
+	if limit <= 0 || len(runes) <= limit {
+		return value
+	}
+	if limit == 1 {
+		return "…"
+	}
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+// formatDate formats t with a Go layout ({{date "2006-01-02" .UploadDate}}).
+// Zero times render as an empty string.
+func formatDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// formatClock renders d as m:ss or h:mm:ss, the way video players and
+// chapter lists show timestamps.
+func formatClock(d time.Duration) string {
+	total := int(d.Round(time.Second) / time.Second)
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataTemplatesRender(t *testing.T) {
+	data := NewTemplateData(UploadRequest{
+		Path: "/downloads/ignored.mp4",
+		Metadata: &VideoMetadata{
+			ID:         "vid",
+			Title:      strings.Repeat("长", 90),
+			Channel:    "Kurzgesagt",
+			UploadDate: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+			Duration:   3723 * time.Second,
+			Tags:       []string{"science", "space"},
+			Chapters: []Chapter{
+				{Title: "Intro", Start: 0},
+				{Title: "Black holes", Start: 95 * time.Second},
+			},
+		},
+	})
+	templates := MetadataTemplates{
+		Title: `【{{.Channel}}】{{truncate 80 .Title}}`,
+		Description: `{{date "2006-01-02" .UploadDate}} · {{duration .Duration}}{{range .Chapters}}
+{{duration .Start}} {{.Title}}{{end}}
+{{.URL}}`,
+		Dynamic: `{{upper .Channel}} {{default "n/a" .Description}}`,
+		Tags:    `{{join "," .Tags}},{{lower .Channel}}`,
+	}
+	got, err := templates.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "【Kurzgesagt】" + strings.Repeat("长", 79) + "…"; got.Title != want {
+		t.Fatalf("title %q", got.Title)
+	}
+	wantDesc := "2024-03-09 · 1:02:03\n0:00 Intro\n1:35 Black holes\nhttps://www.youtube.com/watch?v=vid"
+	if got.Description != wantDesc {
+		t.Fatalf("description %q", got.Description)
+	}
+	if got.Dynamic != "KURZGESAGT n/a" {
+		t.Fatalf("dynamic %q", got.Dynamic)
+	}
+	if strings.Join(got.Tags, "|") != "science|space|kurzgesagt" {
+		t.Fatalf("tags %v", got.Tags)
+	}
+}
+
+func TestMetadataTemplatesValidate(t *testing.T) {
+	if err := (MetadataTemplates{}).Validate(); err != nil {
+		t.Fatalf("defaults must validate: %v", err)
+	}
+	for _, tmpl := range []MetadataTemplates{
+		{Title: "{{.Titel}}"},
+		{Description: "{{truncate .Title}}"},
+		{Tags: "{{nosuchfunc .Tags}}"},
+		{Dynamic: "{{"},
+	} {
+		if err := tmpl.Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", tmpl)
+		}
+	}
+}
+
+func TestMetadataTemplatesOverride(t *testing.T) {
+	base := MetadataTemplates{Title: "[搬运] {{.Title}}", Description: "{{.URL}}", Tags: "youtube"}
+	got := base.Override(MetadataTemplates{Title: "{{.Channel}}: {{.Title}}", Tags: "music"})
+	want := MetadataTemplates{Title: "{{.Channel}}: {{.Title}}", Description: "{{.URL}}", Tags: "music"}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,673 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bilibiliMemberURL     = "https://member.bilibili.com"
+	bilibiliAPIURL        = "https://api.bilibili.com"
+	bilibiliVideoURL      = "https://www.bilibili.com/video/"
+	bilibiliTitleLimit    = 80
+	bilibiliDefaultChunk  = 10 << 20
+	bilibiliUploadProfile = "ugcupos/bup"
+)
+
+// BilibiliUploaderOptions configures the native Bilibili uploader. The
+// metadata knobs mirror BiliupUploaderOptions so both uploaders can be fed
+// from the same flags.
+type BilibiliUploaderOptions struct {
+	CookiePath string
+	Line       string
+	Limit      int
+	TID        int
+	Copyright  int
+	Source     string
+	Templates  MetadataTemplates
+	// BaseURL overrides the member API root (tests point it at httptest).
+	BaseURL string
+	// APIBaseURL overrides the public API root used for CC subtitles.
+	APIBaseURL string
+	HTTPClient *http.Client
+}
+
+// BilibiliUploader talks to the Bilibili member API directly: it requests an
+// upload slot (preupload), sends the file in chunks to the returned UPOS
+// endpoint and submits the archive, without shelling out to biliup.
+type BilibiliUploader struct {
+	opts   BilibiliUploaderOptions
+	client *http.Client
+}
+
+func NewBilibiliUploader(opts BilibiliUploaderOptions) *BilibiliUploader {
+	if opts.Limit <= 0 {
+		opts.Limit = 3
+	}
+	if opts.TID <= 0 {
+		opts.TID = 171
+	}
+	if opts.Copyright == 0 {
+		opts.Copyright = 2
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "cookies.json"
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = bilibiliMemberURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	if opts.APIBaseURL == "" {
+		opts.APIBaseURL = bilibiliAPIURL
+	}
+	opts.APIBaseURL = strings.TrimRight(opts.APIBaseURL, "/")
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &BilibiliUploader{opts: opts, client: client}
+}
+
+// bilibiliTransientCodes are API codes that mean "slow down" rather than
+// "this submission is wrong".
+var bilibiliTransientCodes = map[int]bool{
+	-412: true, // request intercepted by risk control
+	-509: true, // too many requests
+	601:  true, // submitting too frequently
+}
+
+// bilibiliLoggedOutCodes mean the SESSDATA cookie is no longer valid.
+var bilibiliLoggedOutCodes = map[int]bool{
+	-101: true, // account not logged in
+}
+
+// bilibiliAPIError reports a Bilibili response that carried an error in
+// its JSON body; codes Bilibili uses for rate limiting are transient.
+func bilibiliAPIError(endpoint string, code int, message string) *PlatformAPIError {
+	return &PlatformAPIError{Platform: "bilibili", Endpoint: endpoint, Status: http.StatusOK, Code: code, Message: message,
+		Transient: bilibiliTransientCodes[code], LoggedOut: bilibiliLoggedOutCodes[code]}
+}
+
+func (u *BilibiliUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	filePath := req.Path
+	creds, err := loadBilibiliCredentials(u.opts.CookiePath)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	meta, err := buildBilibiliMetadata(req, u.opts.Templates)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	name := filepath.Base(filePath)
+	log.Println("Uploading the video at path:" + filePath)
+
+	pre, err := u.preupload(ctx, creds, name, info.Size())
+	if err != nil {
+		return UploadResult{}, err
+	}
+	uploadID, err := u.initUpload(ctx, pre)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	parts, err := u.uploadChunks(ctx, file, info.Size(), pre, uploadID)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := u.completeUpload(ctx, pre, uploadID, name, parts); err != nil {
+		return UploadResult{}, err
+	}
+
+	coverURL := ""
+	if req.Cover != "" {
+		// A missing cover is not worth failing an otherwise finished
+		// upload over; Bilibili then picks a frame itself.
+		if coverURL, err = u.uploadCover(ctx, creds, req.Cover); err != nil {
+			log.Printf("bilibili cover upload failed, continuing without cover: %v", err)
+		}
+	}
+	remoteName := strings.TrimSuffix(path.Base(pre.UposURI), path.Ext(pre.UposURI))
+	archive, err := u.submit(ctx, creds, meta, coverURL, remoteName, pre.BizID)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	log.Printf("Bilibili accepted %s as %s (av%d)", name, archive.BVID, archive.AID)
+	if len(req.Subtitles) > 0 {
+		// Like the cover, captions are an extra: the archive is already
+		// submitted, so a rejected draft is logged rather than retried.
+		if err := u.uploadSubtitles(ctx, creds, archive.BVID, req.Subtitles); err != nil {
+			log.Printf("bilibili subtitle upload failed for %s: %v", archive.BVID, err)
+		}
+	}
+	return UploadResult{RemoteID: archive.BVID, URL: bilibiliVideoURL + archive.BVID}, nil
+}
+
+type bilibiliPreupload struct {
+	OK        int    `json:"OK"`
+	Auth      string `json:"auth"`
+	BizID     int64  `json:"biz_id"`
+	ChunkSize int64  `json:"chunk_size"`
+	Endpoint  string `json:"endpoint"`
+	UposURI   string `json:"upos_uri"`
+	Message   string `json:"message"`
+	uploadURL string
+}
+
+func (u *BilibiliUploader) preupload(ctx context.Context, creds *bilibiliCredentials, name string, size int64) (*bilibiliPreupload, error) {
+	query := url.Values{
+		"name":          {name},
+		"size":          {strconv.FormatInt(size, 10)},
+		"r":             {"upos"},
+		"profile":       {bilibiliUploadProfile},
+		"ssl":           {"0"},
+		"version":       {"2.14.0"},
+		"build":         {"2140000"},
+		"probe_version": {"20221109"},
+	}
+	if u.opts.Line != "" {
+		query.Set("upcdn", u.opts.Line)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.opts.BaseURL+"/preupload?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	creds.apply(req)
+
+	var pre bilibiliPreupload
+	if err := doCreatorJSON(u.client, req, "bilibili", "preupload", &pre); err != nil {
+		return nil, err
+	}
+	if pre.OK != 1 || pre.Endpoint == "" || pre.UposURI == "" {
+		return nil, bilibiliAPIError("preupload", 0, firstNonEmpty(pre.Message, "no upload slot returned"))
+	}
+	if pre.ChunkSize <= 0 {
+		pre.ChunkSize = bilibiliDefaultChunk
+	}
+	scheme := "https"
+	if base, err := url.Parse(u.opts.BaseURL); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	pre.uploadURL = scheme + ":" + pre.Endpoint + "/" + strings.TrimPrefix(pre.UposURI, "upos://")
+	return &pre, nil
+}
+
+func (u *BilibiliUploader) initUpload(ctx context.Context, pre *bilibiliPreupload) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pre.uploadURL+"?uploads&output=json", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Upos-Auth", pre.Auth)
+
+	var resp struct {
+		OK       int    `json:"OK"`
+		UploadID string `json:"upload_id"`
+	}
+	if err := doCreatorJSON(u.client, req, "bilibili", "upload init", &resp); err != nil {
+		return "", err
+	}
+	if resp.OK != 1 || resp.UploadID == "" {
+		return "", bilibiliAPIError("upload init", 0, "no upload id returned")
+	}
+	return resp.UploadID, nil
+}
+
+type bilibiliPart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"eTag"`
+}
+
+// uploadChunks PUTs the file in pre.ChunkSize pieces using up to
+// opts.Limit concurrent requests.
+func (u *BilibiliUploader) uploadChunks(ctx context.Context, file io.ReaderAt, size int64, pre *bilibiliPreupload, uploadID string) ([]bilibiliPart, error) {
+	chunks := int(max((size+pre.ChunkSize-1)/pre.ChunkSize, 1))
+	etags, err := uploadInChunks(ctx, "bilibili", file, size, pre.ChunkSize, u.opts.Limit, func(ctx context.Context, index int, chunk *io.SectionReader) (string, error) {
+		return u.putChunk(ctx, pre, uploadID, chunk, index, chunks, int64(index)*pre.ChunkSize, chunk.Size(), size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]bilibiliPart, len(etags))
+	for i, etag := range etags {
+		parts[i] = bilibiliPart{PartNumber: i + 1, ETag: etag}
+	}
+	return parts, nil
+}
+
+func (u *BilibiliUploader) putChunk(ctx context.Context, pre *bilibiliPreupload, uploadID string, chunk io.Reader, index, chunks int, start, length, total int64) (string, error) {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(index + 1)},
+		"uploadId":   {uploadID},
+		"chunk":      {strconv.Itoa(index)},
+		"chunks":     {strconv.Itoa(chunks)},
+		"size":       {strconv.FormatInt(length, 10)},
+		"start":      {strconv.FormatInt(start, 10)},
+		"end":        {strconv.FormatInt(start+length, 10)},
+		"total":      {strconv.FormatInt(total, 10)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, pre.uploadURL+"?"+query.Encode(), chunk)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = length
+	req.Header.Set("X-Upos-Auth", pre.Auth)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", &PlatformAPIError{Platform: "bilibili", Endpoint: "chunk upload", Status: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	if etag := strings.Trim(resp.Header.Get("ETag"), `"`); etag != "" {
+		return etag, nil
+	}
+	return "etag", nil
+}
+
+func (u *BilibiliUploader) completeUpload(ctx context.Context, pre *bilibiliPreupload, uploadID, name string, parts []bilibiliPart) error {
+	query := url.Values{
+		"output":   {"json"},
+		"name":     {name},
+		"profile":  {bilibiliUploadProfile},
+		"uploadId": {uploadID},
+		"biz_id":   {strconv.FormatInt(pre.BizID, 10)},
+	}
+	body, err := json.Marshal(map[string][]bilibiliPart{"parts": parts})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pre.uploadURL+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Upos-Auth", pre.Auth)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		OK      int    `json:"OK"`
+		Message string `json:"message"`
+	}
+	if err := doCreatorJSON(u.client, req, "bilibili", "upload complete", &resp); err != nil {
+		return err
+	}
+	if resp.OK != 1 {
+		return bilibiliAPIError("upload complete", 0, firstNonEmpty(resp.Message, "upload not acknowledged"))
+	}
+	return nil
+}
+
+type bilibiliArchive struct {
+	AID  int64  `json:"aid"`
+	BVID string `json:"bvid"`
+}
+
+type bilibiliSubmitVideo struct {
+	Filename string `json:"filename"`
+	Title    string `json:"title"`
+	Desc     string `json:"desc"`
+	CID      int64  `json:"cid"`
+}
+
+type bilibiliSubmission struct {
+	Copyright int                   `json:"copyright"`
+	Source    string                `json:"source,omitempty"`
+	TID       int                   `json:"tid"`
+	Cover     string                `json:"cover"`
+	Title     string                `json:"title"`
+	Desc      string                `json:"desc"`
+	Dynamic   string                `json:"dynamic"`
+	Tag       string                `json:"tag"`
+	Videos    []bilibiliSubmitVideo `json:"videos"`
+}
+
+func (u *BilibiliUploader) submit(ctx context.Context, creds *bilibiliCredentials, meta biliupMetadata, coverURL, remoteName string, bizID int64) (*bilibiliArchive, error) {
+	sub := bilibiliSubmission{
+		Copyright: u.opts.Copyright,
+		TID:       u.opts.TID,
+		Cover:     coverURL,
+		Title:     meta.Title,
+		Desc:      meta.Description,
+		Dynamic:   meta.Dynamic,
+		Tag:       meta.Tag,
+		Videos:    []bilibiliSubmitVideo{{Filename: remoteName, CID: bizID}},
+	}
+	if sub.Copyright == 2 {
+		// Reposts must name their source; everything we upload comes
+		// from YouTube.
+		sub.Source = firstNonEmpty(meta.Source, u.opts.Source, "https://www.youtube.com")
+	}
+	body, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := u.opts.BaseURL + "/x/vu/web/add/v3?csrf=" + url.QueryEscape(creds.csrf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    bilibiliArchive `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "bilibili", "submit", &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, bilibiliAPIError("submit", resp.Code, resp.Message)
+	}
+	if resp.Data.BVID == "" {
+		return nil, bilibiliAPIError("submit", 0, "no bvid returned")
+	}
+	return &resp.Data, nil
+}
+
+// uploadCover posts the cover image as a data URI and returns the URL
+// Bilibili stored it under.
+func (u *BilibiliUploader) uploadCover(ctx context.Context, creds *bilibiliCredentials, coverPath string) (string, error) {
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"csrf":  {creds.csrf},
+		"cover": {"data:" + imageContentType(coverPath) + ";base64," + base64.StdEncoding.EncodeToString(data)},
+	}
+	endpoint := u.opts.BaseURL + "/x/vu/web/cover/up?ts=" + strconv.FormatInt(time.Now().UnixMilli(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "bilibili", "cover upload", &resp); err != nil {
+		return "", err
+	}
+	if resp.Code != 0 || resp.Data.URL == "" {
+		return "", bilibiliAPIError("cover upload", resp.Code, firstNonEmpty(resp.Message, "no cover url returned"))
+	}
+	return resp.Data.URL, nil
+}
+
+// bilibiliSubtitleLanguages maps yt-dlp language codes onto the codes the
+// Bilibili subtitle editor accepts.
+var bilibiliSubtitleLanguages = map[string]string{
+	"zh":      "zh-CN",
+	"zh-hans": "zh-CN",
+	"zh-cn":   "zh-CN",
+	"zh-hant": "zh-TW",
+	"zh-tw":   "zh-TW",
+	"zh-hk":   "zh-HK",
+	"en":      "en-US",
+	"en-us":   "en-US",
+	"en-gb":   "en-US",
+	"ja":      "ja",
+	"ko":      "ko",
+}
+
+func bilibiliSubtitleLanguage(lang string) string {
+	if mapped, ok := bilibiliSubtitleLanguages[strings.ToLower(lang)]; ok {
+		return mapped
+	}
+	return lang
+}
+
+// bilibiliBCC is the JSON caption format the Bilibili player uses.
+type bilibiliBCC struct {
+	FontSize        float64            `json:"font_size"`
+	FontColor       string             `json:"font_color"`
+	BackgroundAlpha float64            `json:"background_alpha"`
+	BackgroundColor string             `json:"background_color"`
+	Stroke          string             `json:"Stroke"`
+	Body            []bilibiliBCCEntry `json:"body"`
+}
+
+type bilibiliBCCEntry struct {
+	From     float64 `json:"from"`
+	To       float64 `json:"to"`
+	Location int     `json:"location"`
+	Content  string  `json:"content"`
+}
+
+func newBilibiliBCC(cues []SubtitleCue) bilibiliBCC {
+	bcc := bilibiliBCC{
+		FontSize:        0.4,
+		FontColor:       "#FFFFFF",
+		BackgroundAlpha: 0.5,
+		BackgroundColor: "#9C27B0",
+		Stroke:          "none",
+	}
+	for _, cue := range cues {
+		bcc.Body = append(bcc.Body, bilibiliBCCEntry{
+			From:     cue.Start.Seconds(),
+			To:       cue.End.Seconds(),
+			Location: 2,
+			Content:  cue.Text,
+		})
+	}
+	return bcc
+}
+
+// uploadSubtitles attaches each subtitle as a CC track of the first page of
+// bvid. Only one track per Bilibili language is sent.
+func (u *BilibiliUploader) uploadSubtitles(ctx context.Context, creds *bilibiliCredentials, bvid string, subs []Subtitle) error {
+	cid, err := u.pageCID(ctx, creds, bvid)
+	if err != nil {
+		return err
+	}
+	sent := map[string]bool{}
+	var errs []error
+	for _, sub := range subs {
+		lang := bilibiliSubtitleLanguage(sub.Language)
+		if sent[lang] {
+			continue
+		}
+		if err := u.saveSubtitle(ctx, creds, bvid, cid, lang, sub.Path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.Language, err))
+			continue
+		}
+		sent[lang] = true
+		log.Printf("Attached %s subtitles to %s", lang, bvid)
+	}
+	return errors.Join(errs...)
+}
+
+// pageCID resolves the cid of the first page of a freshly submitted
+// archive; subtitles are attached per page rather than per archive.
+func (u *BilibiliUploader) pageCID(ctx context.Context, creds *bilibiliCredentials, bvid string) (int64, error) {
+	endpoint := u.opts.APIBaseURL + "/x/player/pagelist?bvid=" + url.QueryEscape(bvid)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	creds.apply(req)
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    []struct {
+			CID int64 `json:"cid"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "bilibili", "pagelist", &resp); err != nil {
+		return 0, err
+	}
+	if resp.Code != 0 || len(resp.Data) == 0 {
+		return 0, bilibiliAPIError("pagelist", resp.Code, firstNonEmpty(resp.Message, "no pages returned"))
+	}
+	return resp.Data[0].CID, nil
+}
+
+func (u *BilibiliUploader) saveSubtitle(ctx context.Context, creds *bilibiliCredentials, bvid string, cid int64, lang, path string) error {
+	cues, err := ParseSubtitleCues(path)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(newBilibiliBCC(cues))
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"type":   {"1"},
+		"oid":    {strconv.FormatInt(cid, 10)},
+		"lan":    {lang},
+		"data":   {string(data)},
+		"submit": {"true"},
+		"sign":   {"false"},
+		"bvid":   {bvid},
+		"csrf":   {creds.csrf},
+	}
+	endpoint := u.opts.APIBaseURL + "/x/v2/dm/subtitle/draft/save"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := doCreatorJSON(u.client, req, "bilibili", "subtitle save", &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return bilibiliAPIError("subtitle save", resp.Code, resp.Message)
+	}
+	return nil
+}
+
+// bilibiliCookieFile is the cookies.json layout written by `biliup login`.
+type bilibiliCookieFile struct {
+	CookieInfo struct {
+		Cookies []struct {
+			Name    string `json:"name"`
+			Value   string `json:"value"`
+			Expires int64  `json:"expires"`
+		} `json:"cookies"`
+	} `json:"cookie_info"`
+}
+
+type bilibiliCredentials struct {
+	cookies []*http.Cookie
+	csrf    string
+	expires time.Time
+}
+
+func (c *bilibiliCredentials) apply(req *http.Request) {
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// CheckBilibiliCookie validates a cookies.json written by `biliup login`
+// and returns when its session expires (zero when the file does not say).
+func CheckBilibiliCookie(path string) (time.Time, error) {
+	creds, err := loadBilibiliCredentials(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return creds.expires, nil
+}
+
+func loadBilibiliCredentials(path string) (*bilibiliCredentials, error) {
+	if err := ensureCookieExists(path); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading bilibili cookie: %w", err)
+	}
+	var file bilibiliCookieFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing bilibili cookie %s: %w", path, err)
+	}
+	creds := &bilibiliCredentials{}
+	hasSession := false
+	for _, c := range file.CookieInfo.Cookies {
+		if c.Name == "" {
+			continue
+		}
+		creds.cookies = append(creds.cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		switch c.Name {
+		case "bili_jct":
+			creds.csrf = c.Value
+		case "SESSDATA":
+			hasSession = c.Value != ""
+			if c.Expires > 0 {
+				creds.expires = time.Unix(c.Expires, 0)
+			}
+		}
+	}
+	if !hasSession || creds.csrf == "" {
+		return nil, errors.New("bilibili cookie is missing SESSDATA or bili_jct; run `biliup login` again")
+	}
+	return creds, nil
+}
+
+func uploadProgressEvent(done, total int64, elapsed time.Duration) ProgressEvent {
+	ev := ProgressEvent{Stage: StageUpload, Percent: 100}
+	if total > 0 {
+		ev.Percent = float64(done) / float64(total) * 100
+	}
+	if secs := elapsed.Seconds(); secs > 0 && done > 0 {
+		rate := float64(done) / secs
+		ev.Speed = fmt.Sprintf("%.2fMiB/s", rate/(1<<20))
+		remaining := time.Duration(float64(total-done) / rate * float64(time.Second))
+		ev.ETA = remaining.Round(time.Second).String()
+	}
+	return ev
+}
+
+func truncateRunes(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,295 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBilibili is an httptest stand-in for the member API and its UPOS
+// upload endpoint.
+type fakeBilibili struct {
+	t          *testing.T
+	server     *httptest.Server
+	chunkSize  int64
+	submitCode int
+
+	mu         sync.Mutex
+	chunks     map[int][]byte
+	failChunk  int
+	completed  []bilibiliPart
+	submission bilibiliSubmission
+	csrf       string
+	subtitles  []url.Values
+}
+
+func newFakeBilibili(t *testing.T, chunkSize int64) *fakeBilibili {
+	f := &fakeBilibili{t: t, chunkSize: chunkSize, chunks: map[int][]byte{}, failChunk: -1}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /preupload", f.preupload)
+	mux.HandleFunc("/ugcboss/", f.upos)
+	mux.HandleFunc("POST /x/vu/web/add/v3", f.submit)
+	mux.HandleFunc("POST /x/vu/web/cover/up", f.cover)
+	mux.HandleFunc("GET /x/player/pagelist", f.pagelist)
+	mux.HandleFunc("POST /x/v2/dm/subtitle/draft/save", f.saveSubtitle)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeBilibili) preupload(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("SESSDATA"); err != nil || cookie.Value != "sess" {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("name") == "" || r.URL.Query().Get("size") == "" {
+		http.Error(w, "missing file info", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"OK":         1,
+		"auth":       "upos-auth",
+		"biz_id":     42,
+		"chunk_size": f.chunkSize,
+		"endpoint":   "//" + strings.TrimPrefix(f.server.URL, "http://"),
+		"upos_uri":   "upos://ugcboss/n001remote.mp4",
+	})
+}
+
+func (f *fakeBilibili) upos(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Upos-Auth") != "upos-auth" {
+		http.Error(w, "bad auth", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		writeJSON(w, http.StatusOK, map[string]any{"OK": 1, "upload_id": "up-1"})
+	case r.Method == http.MethodPut:
+		index, _ := strconv.Atoi(q.Get("chunk"))
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if index == f.failChunk {
+			f.failChunk = -1
+			http.Error(w, "flaky", http.StatusBadGateway)
+			return
+		}
+		if q.Get("uploadId") != "up-1" || strconv.Itoa(len(body)) != q.Get("size") {
+			http.Error(w, "bad chunk", http.StatusBadRequest)
+			return
+		}
+		f.chunks[index] = body
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "up-1":
+		var req struct {
+			Parts []bilibiliPart `json:"parts"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.completed = req.Parts
+		f.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"OK": 1})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeBilibili) submit(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.csrf = r.URL.Query().Get("csrf")
+	json.NewDecoder(r.Body).Decode(&f.submission)
+	if f.submitCode != 0 {
+		writeJSON(w, http.StatusOK, map[string]any{"code": f.submitCode, "message": "标题过长"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "0", "data": map[string]any{"aid": 170001, "bvid": "BV1xx411c7mD"}})
+}
+
+func (f *fakeBilibili) cover(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("csrf") != "csrf-token" || !strings.HasPrefix(r.FormValue("cover"), "data:image/jpeg;base64,") {
+		writeJSON(w, http.StatusOK, map[string]any{"code": -400, "message": "bad cover"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "data": map[string]any{"url": "https://i0.hdslb.com/bfs/archive/cover.jpg"}})
+}
+
+func (f *fakeBilibili) pagelist(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("bvid") != "BV1xx411c7mD" {
+		writeJSON(w, http.StatusOK, map[string]any{"code": -404, "message": "啥都木有"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "data": []map[string]any{{"cid": 9001, "page": 1}}})
+}
+
+func (f *fakeBilibili) saveSubtitle(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	f.subtitles = append(f.subtitles, r.PostForm)
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0})
+}
+
+func writeBilibiliCookie(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	data := `{"cookie_info":{"cookies":[{"name":"SESSDATA","value":"sess","expires":4102444800},{"name":"bili_jct","value":"csrf-token"}]}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeVideoFile(t *testing.T, name string, size int) (string, []byte) {
+	t.Helper()
+	content := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, content
+}
+
+func TestBilibiliUploaderUploadsInChunks(t *testing.T) {
+	fake := newFakeBilibili(t, 1000)
+	fake.failChunk = 1
+	path, content := writeVideoFile(t, "My Video.mp4", 3500)
+	cover, _ := writeVideoFile(t, "My Video.jpg", 64)
+
+	u := NewBilibiliUploader(BilibiliUploaderOptions{
+		CookiePath: writeBilibiliCookie(t),
+		BaseURL:    fake.server.URL,
+		Limit:      2,
+		Templates:  MetadataTemplates{Title: "[搬运] {{.Title}}", Tags: "youtube, ,music"},
+	})
+	var events []ProgressEvent
+	var mu sync.Mutex
+	ctx := WithProgress(context.Background(), func(ev ProgressEvent) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	})
+
+	res, err := u.Upload(ctx, UploadRequest{Path: path, Cover: cover})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if res.RemoteID != "BV1xx411c7mD" || res.URL != "https://www.bilibili.com/video/BV1xx411c7mD" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var got []byte
+	for i := 0; i < 4; i++ {
+		got = append(got, fake.chunks[i]...)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("reassembled %d bytes, want %d", len(got), len(content))
+	}
+	if len(fake.completed) != 4 || fake.completed[3].PartNumber != 4 {
+		t.Fatalf("unexpected completed parts: %+v", fake.completed)
+	}
+	if fake.csrf != "csrf-token" {
+		t.Fatalf("csrf=%q", fake.csrf)
+	}
+	sub := fake.submission
+	if sub.Title != "[搬运] My Video" || sub.Tag != "youtube,music" || sub.Copyright != 2 || sub.Source == "" || sub.TID != 171 {
+		t.Fatalf("unexpected submission: %+v", sub)
+	}
+	if sub.Cover != "https://i0.hdslb.com/bfs/archive/cover.jpg" {
+		t.Fatalf("cover=%q", sub.Cover)
+	}
+	if len(sub.Videos) != 1 || sub.Videos[0].Filename != "n001remote" || sub.Videos[0].CID != 42 {
+		t.Fatalf("unexpected submitted videos: %+v", sub.Videos)
+	}
+	finished := false
+	for _, ev := range events {
+		finished = finished || ev.Percent == 100
+	}
+	if !finished {
+		t.Fatalf("no progress event reached 100%%: %+v", events)
+	}
+}
+
+func TestBilibiliUploaderSubmitError(t *testing.T) {
+	fake := newFakeBilibili(t, 1<<20)
+	fake.submitCode = 21070
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+
+	u := NewBilibiliUploader(BilibiliUploaderOptions{CookiePath: writeBilibiliCookie(t), BaseURL: fake.server.URL})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	var apiErr *PlatformAPIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected PlatformAPIError, got %v", err)
+	}
+	if apiErr.Endpoint != "submit" || apiErr.Code != 21070 {
+		t.Fatalf("unexpected api error: %+v", apiErr)
+	}
+}
+
+func TestBilibiliUploaderRejectsIncompleteCookie(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(path, []byte(`{"cookie_info":{"cookies":[{"name":"SESSDATA","value":"sess"}]}}`), 0o600)
+	video, _ := writeVideoFile(t, "clip.mp4", 10)
+
+	u := NewBilibiliUploader(BilibiliUploaderOptions{CookiePath: path, BaseURL: "http://127.0.0.1:0"})
+	if _, err := u.Upload(context.Background(), UploadRequest{Path: video}); err == nil || !strings.Contains(err.Error(), "bili_jct") {
+		t.Fatalf("expected missing bili_jct error, got %v", err)
+	}
+}
+
+func TestCheckBilibiliCookie(t *testing.T) {
+	expires, err := CheckBilibiliCookie(writeBilibiliCookie(t))
+	if err != nil {
+		t.Fatalf("check cookie: %v", err)
+	}
+	if !expires.Equal(time.Unix(4102444800, 0)) {
+		t.Fatalf("expires=%v", expires)
+	}
+	if _, err := CheckBilibiliCookie(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "biliup login") {
+		t.Fatalf("expected missing cookie error, got %v", err)
+	}
+}
+
+func TestBilibiliUploaderAttachesCCSubtitles(t *testing.T) {
+	fake := newFakeBilibili(t, 1<<20)
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+	srt := filepath.Join(filepath.Dir(path), "clip.zh-Hans.srt")
+	os.WriteFile(srt, []byte("1\n00:00:01,000 --> 00:00:02,500\n你好\n\n2\n00:00:03,000 --> 00:00:04,000\n世界\n"), 0o644)
+
+	u := NewBilibiliUploader(BilibiliUploaderOptions{
+		CookiePath: writeBilibiliCookie(t),
+		BaseURL:    fake.server.URL,
+		APIBaseURL: fake.server.URL,
+	})
+	req := UploadRequest{Path: path, Subtitles: []Subtitle{{Path: srt, Language: "zh-Hans"}}}
+	if _, err := u.Upload(context.Background(), req); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if len(fake.subtitles) != 1 {
+		t.Fatalf("expected one subtitle draft, got %d", len(fake.subtitles))
+	}
+	form := fake.subtitles[0]
+	if form.Get("oid") != "9001" || form.Get("lan") != "zh-CN" || form.Get("bvid") != "BV1xx411c7mD" || form.Get("csrf") != "csrf-token" {
+		t.Fatalf("unexpected subtitle form: %v", form)
+	}
+	var bcc bilibiliBCC
+	if err := json.Unmarshal([]byte(form.Get("data")), &bcc); err != nil {
+		t.Fatalf("decoding bcc: %v", err)
+	}
+	if len(bcc.Body) != 2 || bcc.Body[0].From != 1 || bcc.Body[0].To != 2.5 || bcc.Body[1].Content != "世界" {
+		t.Fatalf("unexpected bcc body: %+v", bcc.Body)
+	}
+}
@@ -1,25 +1,22 @@
 package app
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 )
 
 type BiliupUploaderOptions struct {
-	Binary      string
-	CookiePath  string
-	Line        string
-	Limit       int
-	TitlePrefix string
-	Description string
-	Dynamic     string
-	Tags        []string
+	Binary     string
+	CookiePath string
+	Line       string
+	Limit      int
+	Templates  MetadataTemplates
+	// Runner executes the biliup CLI; nil means ExecRunner.
+	Runner CommandRunner
 }
 
 type BiliupUploader struct {
@@ -30,16 +27,18 @@ func NewBiliupUploader(opts BiliupUploaderOptions) *BiliupUploader {
 	if opts.Limit <= 0 {
 		opts.Limit = 3
 	}
+	opts.Runner = runnerOrDefault(opts.Runner)
 	return &BiliupUploader{opts: opts}
 }
 
-func (u *BiliupUploader) Upload(path string) error {
+func (u *BiliupUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	path := req.Path
 	binary := u.opts.Binary
 	if binary == "" {
 		binary = "biliup"
 	}
 	if _, err := LookPath(binary); err != nil {
-		return fmt.Errorf("biliup binary %q not found in PATH; install it from github.com/biliup/biliup or set --biliup-binary", binary)
+		return UploadResult{}, fmt.Errorf("biliup binary %q not found in PATH; install it from github.com/biliup/biliup or set --biliup-binary", binary)
 	}
 
 	cookie := u.opts.CookiePath
@@ -47,10 +46,13 @@ func (u *BiliupUploader) Upload(path string) error {
 		cookie = "cookies.json"
 	}
 	if err := ensureCookieExists(cookie); err != nil {
-		return err
+		return UploadResult{}, err
 	}
 
-	meta := u.buildMetadata(path)
+	meta, err := u.buildMetadata(req)
+	if err != nil {
+		return UploadResult{}, err
+	}
 
 	args := []string{"--user-cookie", cookie, "upload", "--limit", strconv.Itoa(u.opts.Limit)}
 	if u.opts.Line != "" {
@@ -66,16 +68,35 @@ func (u *BiliupUploader) Upload(path string) error {
 	if meta.Tag != "" {
 		args = append(args, "--tag", meta.Tag)
 	}
+	if meta.Source != "" {
+		args = append(args, "--copyright", "2", "--source", meta.Source)
+	}
+	if req.Cover != "" {
+		args = append(args, "--cover", req.Cover)
+	}
+	if len(req.Subtitles) > 0 {
+		log.Printf("biliup CLI cannot attach CC subtitles; use --bilibili-client native to publish them")
+	}
 	args = append(args, path)
 	log.Println("Uploading the video at path:" + path)
 
-	cmd := exec.Command(binary, args...)
-	cmd.Stdout = newPrefixedLogger("biliup")
-	cmd.Stderr = newPrefixedLogger("biliup")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("biliup upload failed: %w", err)
-	}
-	return nil
+	output := newLineWriter(func(line string) {
+		if ev, ok := parseBiliupProgress(line); ok {
+			reportProgress(ctx, ev)
+			return
+		}
+		log.Printf("[biliup] %s", line)
+	})
+	reportProgress(ctx, ProgressEvent{Stage: StageUpload, Percent: 0, Message: "starting biliup upload"})
+	err = u.opts.Runner.Run(ctx, Command{Name: binary, Args: args, Stdout: output, Stderr: output})
+	output.Flush()
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("biliup upload failed: %w", err)
+	}
+	reportProgress(ctx, ProgressEvent{Stage: StageUpload, Percent: 100, Message: "biliup upload finished"})
+	// The biliup CLI only reports success through its exit code, so the
+	// resulting BV id is unknown here.
+	return UploadResult{}, nil
 }
 
 func ensureCookieExists(path string) error {
@@ -96,36 +117,61 @@ type biliupMetadata struct {
 	Description string
 	Dynamic     string
 	Tag         string
+	Source      string
 }
 
-func (u *BiliupUploader) buildMetadata(path string) biliupMetadata {
-	base := filepath.Base(path)
-	name := strings.TrimSuffix(base, filepath.Ext(base))
-	if strings.TrimSpace(name) == "" {
-		name = base
-	}
-	title := strings.TrimSpace(u.opts.TitlePrefix + name)
-	if title == "" {
-		title = name
-	}
+const (
+	bilibiliDescLimit    = 2000
+	bilibiliDynamicLimit = 233
+	bilibiliTagLimit     = 12
+	bilibiliTagRuneLimit = 20
+)
+
+func (u *BiliupUploader) buildMetadata(req UploadRequest) (biliupMetadata, error) {
+	return buildBilibiliMetadata(req, u.opts.Templates)
+}
 
-	desc := strings.TrimSpace(u.opts.Description)
-	if desc == "" {
-		desc = fmt.Sprintf("Uploaded automatically: %s", title)
+// buildBilibiliMetadata renders the submission fields shared by the biliup
+// CLI and the native Bilibili uploader and clamps them to Bilibili's limits.
+func buildBilibiliMetadata(req UploadRequest, templates MetadataTemplates) (biliupMetadata, error) {
+	if req.Templates != nil {
+		templates = templates.Override(*req.Templates)
 	}
-	dynamic := strings.TrimSpace(u.opts.Dynamic)
-	if dynamic == "" {
-		dynamic = desc
+	data := NewTemplateData(req)
+	rendered, err := templates.Render(data)
+	if err != nil {
+		return biliupMetadata{}, err
+	}
+	title := rendered.Title
+	if title == "" {
+		title = data.Title
 	}
-
-	tag := strings.Join(filterEmpty(u.opts.Tags), ",")
-
 	return biliupMetadata{
-		Title:       title,
-		Description: desc,
-		Dynamic:     dynamic,
-		Tag:         tag,
+		Title:       truncateRunes(title, bilibiliTitleLimit),
+		Description: truncateRunes(rendered.Description, bilibiliDescLimit),
+		Dynamic:     truncateRunes(rendered.Dynamic, bilibiliDynamicLimit),
+		Tag:         strings.Join(bilibiliTags(rendered.Tags), ","),
+		Source:      data.URL,
+	}, nil
+}
+
+// bilibiliTags de-duplicates tags and drops the ones Bilibili would reject
+// (commas, over-long tags, more than bilibiliTagLimit in total).
+func bilibiliTags(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, tag := range filterEmpty(values) {
+		key := strings.ToLower(tag)
+		if seen[key] || strings.Contains(tag, ",") || len([]rune(tag)) > bilibiliTagRuneLimit {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+		if len(result) == bilibiliTagLimit {
+			break
+		}
 	}
+	return result
 }
 
 func filterEmpty(values []string) []string {
@@ -138,22 +184,3 @@ func filterEmpty(values []string) []string {
 	}
 	return result
 }
-
-type prefixedLogger struct {
-	prefix string
-}
-
-func newPrefixedLogger(prefix string) io.Writer {
-	return &prefixedLogger{prefix: prefix}
-}
-
-func (p *prefixedLogger) Write(data []byte) (int, error) {
-	text := string(data)
-	for _, line := range strings.Split(text, "\n") {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			log.Printf("[%s] %s", p.prefix, line)
-		}
-	}
-	return len(data), nil
-}
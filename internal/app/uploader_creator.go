@@ -0,0 +1,376 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// The creator uploaders (Douyin and the ones after it) share the helpers in
+// this file: cookie files exported from a logged-in browser, JSON API calls
+// and chunked file uploads.
+
+const (
+	creatorChunkRetries = 3
+	// browserUserAgent is sent with every creator API request; the
+	// creator sites reject clients that do not look like a browser.
+	browserUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+// ErrNotLoggedIn matches errors from a platform that rejected the session
+// in its cookie export. That is a configuration problem rather than one
+// with the video, so the sync stops instead of failing videos.
+var ErrNotLoggedIn = errors.New("platform session is not logged in")
+
+// PlatformAPIError is returned when a creator API rejects a request, either
+// with a non-2xx status or with an error code in its JSON body.
+type PlatformAPIError struct {
+	Platform string
+	Endpoint string
+	Status   int
+	Code     int
+	Message  string
+	// Transient marks codes the platform uses for rate limiting.
+	Transient bool
+	// LoggedOut marks codes that mean the session cookie is no longer
+	// valid; such errors match ErrNotLoggedIn.
+	LoggedOut bool
+}
+
+func (e *PlatformAPIError) Error() string {
+	msg := fmt.Sprintf("%s %s failed: HTTP %d: %s", e.Platform, e.Endpoint, e.Status, e.Message)
+	if e.Code != 0 {
+		msg = fmt.Sprintf("%s %s failed: code %d: %s", e.Platform, e.Endpoint, e.Code, e.Message)
+	}
+	if e.LoggedOut {
+		msg += " (log in again and re-export the " + e.Platform + " cookies)"
+	}
+	return msg
+}
+
+func (e *PlatformAPIError) Is(target error) bool {
+	return target == ErrNotLoggedIn && e.LoggedOut
+}
+
+// creatorSessionCookies names the cookie each creator platform keeps its
+// login session in.
+var creatorSessionCookies = map[string]string{
+	"douyin":      douyinSessionCookie,
+	"kuaishou":    kuaishouSessionCookie,
+	"xiaohongshu": xiaohongshuSessionCookie,
+	"xigua":       xiguaSessionCookie,
+}
+
+// CreatorSessionCookie returns the cookie a creator platform's cookie
+// export must contain, or "" for other platforms.
+func CreatorSessionCookie(platform string) string {
+	return creatorSessionCookies[platform]
+}
+
+// CheckCreatorCookie validates the cookie export of a creator platform and
+// returns when its session expires (zero when the file does not say).
+func CheckCreatorCookie(platform, path string) (time.Time, error) {
+	name, ok := creatorSessionCookies[platform]
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s does not use a creator cookie", platform)
+	}
+	creds, err := loadCreatorCookies(platform, path, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return creds.expires, nil
+}
+
+// creatorCookies are the session cookies of a creator account.
+type creatorCookies struct {
+	cookies []*http.Cookie
+	values  map[string]string
+	// expires is the earliest expiry of the required cookies; zero when
+	// the file does not say.
+	expires time.Time
+}
+
+func (c *creatorCookies) apply(req *http.Request) {
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// browserCookie is one entry of a JSON cookie export. Playwright storage
+// states use "expires" (-1 for session cookies), browser extensions
+// "expirationDate".
+type browserCookie struct {
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Expires        float64 `json:"expires"`
+	ExpirationDate float64 `json:"expirationDate"`
+}
+
+// loadCreatorCookies reads the cookies of a logged-in creator session from
+// path, which is either JSON (a Playwright storage state or a plain array
+// of cookies) or a Netscape cookies.txt. Every cookie in required must be
+// present and non-empty.
+func loadCreatorCookies(platform, path string, required ...string) (*creatorCookies, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%s cookie path is empty", platform)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s cookie not found at %s; export the cookies of a logged-in creator session there", platform, path)
+		}
+		return nil, fmt.Errorf("reading %s cookie: %w", platform, err)
+	}
+	var entries []browserCookie
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		entries, err = parseJSONCookies([]byte(trimmed))
+	} else {
+		entries, err = parseNetscapeCookies(trimmed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s cookie %s: %w", platform, path, err)
+	}
+
+	creds := &creatorCookies{values: map[string]string{}}
+	for _, c := range entries {
+		if c.Name == "" {
+			continue
+		}
+		creds.cookies = append(creds.cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		creds.values[c.Name] = c.Value
+	}
+	for _, name := range required {
+		if creds.values[name] == "" {
+			return nil, fmt.Errorf("%s cookie %s is missing %s; log in again and re-export it", platform, path, name)
+		}
+		for _, c := range entries {
+			expiry := max(c.Expires, c.ExpirationDate)
+			if c.Name != name || expiry <= 0 {
+				continue
+			}
+			if t := time.Unix(int64(expiry), 0); creds.expires.IsZero() || t.Before(creds.expires) {
+				creds.expires = t
+			}
+		}
+	}
+	return creds, nil
+}
+
+func parseJSONCookies(data []byte) ([]browserCookie, error) {
+	if data[0] == '[' {
+		var entries []browserCookie
+		err := json.Unmarshal(data, &entries)
+		return entries, err
+	}
+	var state struct {
+		Cookies []browserCookie `json:"cookies"`
+	}
+	err := json.Unmarshal(data, &state)
+	return state.Cookies, err
+}
+
+// parseNetscapeCookies reads the tab-separated cookies.txt format curl and
+// yt-dlp use: domain, subdomains, path, secure, expiry, name, value.
+func parseNetscapeCookies(data string) ([]browserCookie, error) {
+	var entries []browserCookie
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 tab-separated fields, got %d", n, len(fields))
+		}
+		expires, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad expiry %q", n, fields[4])
+		}
+		entries = append(entries, browserCookie{Name: fields[5], Value: fields[6], Expires: expires})
+	}
+	return entries, scanner.Err()
+}
+
+// doCreatorJSON sends req and decodes its JSON response into out. Non-2xx
+// responses become a *PlatformAPIError, logged out for a 401; error codes
+// inside the body are left to the caller.
+func doCreatorJSON(client *http.Client, req *http.Request, platform, endpoint string, out any) error {
+	req.Header.Set("User-Agent", browserUserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", platform, endpoint, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", platform, endpoint, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return &PlatformAPIError{Platform: platform, Endpoint: endpoint, Status: resp.StatusCode, Message: strings.TrimSpace(truncateRunes(string(body), 512)), LoggedOut: resp.StatusCode == http.StatusUnauthorized}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s %s: decoding response: %w", platform, endpoint, err)
+	}
+	return nil
+}
+
+// chunkPutFunc uploads one part of a file (index is 0-based) and returns
+// what the platform needs to assemble it, such as an ETag or CRC.
+type chunkPutFunc func(ctx context.Context, index int, chunk *io.SectionReader) (string, error)
+
+// uploadInChunks sends a file of size bytes in chunkSize parts using up to
+// workers concurrent requests. Each part is tried creatorChunkRetries
+// times. The values put returns come back in part order.
+func uploadInChunks(ctx context.Context, platform string, file io.ReaderAt, size, chunkSize int64, workers int, put chunkPutFunc) ([]string, error) {
+	chunks := int((size + chunkSize - 1) / chunkSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+	parts := make([]string, chunks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := 0; i < chunks; i++ {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sent     atomic.Int64
+		started  = time.Now()
+	)
+	reportProgress(ctx, ProgressEvent{Stage: StageUpload, Percent: 0, Message: fmt.Sprintf("uploading %d chunk(s) to %s", chunks, platform)})
+	for w := 0; w < min(max(workers, 1), chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				start := int64(i) * chunkSize
+				length := min(chunkSize, size-start)
+				part, err := putChunkWithRetry(ctx, platform, io.NewSectionReader(file, start, length), i, chunks, put)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+				parts[i] = part
+				done := sent.Add(length)
+				reportProgress(ctx, uploadProgressEvent(done, size, time.Since(started)))
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+func putChunkWithRetry(ctx context.Context, platform string, chunk *io.SectionReader, index, chunks int, put chunkPutFunc) (string, error) {
+	var lastErr error
+	for attempt := 1; attempt <= creatorChunkRetries; attempt++ {
+		part, err := put(ctx, index, chunk)
+		if err == nil {
+			return part, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("%s chunk %d/%d failed (attempt %d/%d): %v", platform, index+1, chunks, attempt, creatorChunkRetries, err)
+		if _, err := chunk.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	return "", lastErr
+}
+
+// imageContentType guesses a cover's MIME type from its extension.
+func imageContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// imageForm wraps an image in a multipart form under field and returns the
+// body with its Content-Type.
+func imageForm(field, path string, data []byte) (io.Reader, string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name=%q; filename=%q`, field, filepath.Base(path))},
+		"Content-Type":        {imageContentType(path)},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, form.FormDataContentType(), nil
+}
+
+// creatorHashtags turns tags into hashtag names: no spaces or '#', no
+// duplicates and at most limit of them. Tags longer than runeLimit runes
+// are dropped unless runeLimit is 0.
+func creatorHashtags(values []string, limit, runeLimit int) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, tag := range filterEmpty(values) {
+		tag = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) || r == '#' {
+				return -1
+			}
+			return r
+		}, tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] || (runeLimit > 0 && len([]rune(tag)) > runeLimit) {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result
+}
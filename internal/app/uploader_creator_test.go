@@ -0,0 +1,163 @@
+package app
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCreator is what the httptest stand-ins for the creator APIs share: a
+// server whose mux each fake adds its endpoints to, the session check and
+// the chunks the upload host received.
+type fakeCreator struct {
+	t      *testing.T
+	server *httptest.Server
+	mux    *http.ServeMux
+	// session is the cookie that must be "sess"; loggedOut is the body the
+	// API answers with when it is not.
+	session   string
+	loggedOut map[string]any
+
+	mu        sync.Mutex
+	chunks    map[int][]byte
+	failChunk int
+}
+
+func newFakeCreator(t *testing.T, session string, loggedOut map[string]any) *fakeCreator {
+	f := &fakeCreator{t: t, mux: http.NewServeMux(), session: session, loggedOut: loggedOut, chunks: map[int][]byte{}, failChunk: -1}
+	f.server = httptest.NewServer(f.mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeCreator) loggedIn(w http.ResponseWriter, r *http.Request) bool {
+	if cookie, err := r.Cookie(f.session); err != nil || cookie.Value != "sess" {
+		writeJSON(w, http.StatusOK, f.loggedOut)
+		return false
+	}
+	return true
+}
+
+// receiveChunk stores chunk index (0-based), except that failChunk fails
+// once with a 502. The caller holds f.mu.
+func (f *fakeCreator) receiveChunk(w http.ResponseWriter, index int, body []byte) bool {
+	if index == f.failChunk {
+		f.failChunk = -1
+		http.Error(w, "flaky", http.StatusBadGateway)
+		return false
+	}
+	f.chunks[index] = body
+	return true
+}
+
+// fakeTOS adds the ByteDance object storage Douyin and Xigua upload slots
+// point at, under /tos/ with the Authorization "tos-auth".
+type fakeTOS struct {
+	*fakeCreator
+	completed string
+}
+
+func newFakeTOS(t *testing.T, session string, loggedOut map[string]any) *fakeTOS {
+	f := &fakeTOS{fakeCreator: newFakeCreator(t, session, loggedOut)}
+	f.mux.HandleFunc("/tos/", f.tos)
+	return f
+}
+
+func (f *fakeTOS) tos(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "tos-auth" {
+		http.Error(w, "bad auth", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		writeJSON(w, http.StatusOK, map[string]any{"code": 2000, "data": map[string]any{"uploadid": "up-1"}})
+	case r.Method == http.MethodPut:
+		if q.Get("uploadID") != "up-1" || r.Header.Get("Content-CRC32") != fmt.Sprintf("%08x", crc32.ChecksumIEEE(body)) {
+			writeJSON(w, http.StatusOK, map[string]any{"code": 4000, "message": "crc mismatch"})
+			return
+		}
+		index, _ := strconv.Atoi(q.Get("partNumber"))
+		if f.receiveChunk(w, index-1, body) {
+			writeJSON(w, http.StatusOK, map[string]any{"code": 2000})
+		}
+	case r.Method == http.MethodPost && q.Get("uploadID") == "up-1":
+		f.completed = string(body)
+		writeJSON(w, http.StatusOK, map[string]any{"code": 2000})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// writeCreatorCookie writes a cookie export to a temporary file.
+func writeCreatorCookie(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCreatorCookies(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"storage.json": `{"cookies":[{"name":"sessionid","value":"a","expires":1700000000},{"name":"other","value":"b","expires":-1}]}`,
+		"array.json":   `[{"name":"sessionid","value":"a","expirationDate":1700000000.5},{"name":"other","value":"b"}]`,
+		"cookies.txt":  "# Netscape HTTP Cookie File\n#HttpOnly_.douyin.com\tTRUE\t/\tTRUE\t1700000000\tsessionid\ta\n.douyin.com\tTRUE\t/\tFALSE\t0\tother\tb\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		creds, err := loadCreatorCookies("douyin", path, "sessionid")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if creds.values["sessionid"] != "a" || creds.values["other"] != "b" || len(creds.cookies) != 2 || !creds.expires.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("%s: unexpected cookies %+v", name, creds)
+		}
+		if _, err := loadCreatorCookies("douyin", path, "passport_csrf_token"); err == nil || !strings.Contains(err.Error(), "missing passport_csrf_token") {
+			t.Errorf("%s: expected a missing cookie error, got %v", name, err)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	os.WriteFile(bad, []byte(".douyin.com\tTRUE\t/\n"), 0o600)
+	if _, err := loadCreatorCookies("douyin", bad); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+}
+
+func TestCheckCreatorCookie(t *testing.T) {
+	for platform, path := range map[string]string{"douyin": writeDouyinCookie(t), "kuaishou": writeKuaishouCookie(t)} {
+		expires, err := CheckCreatorCookie(platform, path)
+		if err != nil || !expires.Equal(time.Unix(4102444800, 0)) {
+			t.Fatalf("%s: expires=%v, err=%v", platform, expires, err)
+		}
+	}
+	if _, err := CheckCreatorCookie("douyin", filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "logged-in creator session") {
+		t.Fatalf("expected missing cookie error, got %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(path, []byte(`[{"name":"userId","value":"1"}]`), 0o600)
+	if _, err := CheckCreatorCookie("kuaishou", path); err == nil || !strings.Contains(err.Error(), "kuaishou.web.cp.api_st") {
+		t.Fatalf("expected missing session error, got %v", err)
+	}
+	if _, err := CheckCreatorCookie("bilibili", path); err == nil {
+		t.Fatal("expected an error for a platform without a creator cookie")
+	}
+}
@@ -0,0 +1,362 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	douyinCreatorURL    = "https://creator.douyin.com"
+	douyinVideoURL      = "https://www.douyin.com/video/"
+	douyinSessionCookie = "sessionid"
+	douyinDefaultChunk  = 5 << 20
+	douyinTitleLimit    = 30
+	douyinTextLimit     = 1000
+	douyinTagLimit      = 5
+	douyinTagRuneLimit  = 20
+	// Douyin only schedules posts between two hours and two weeks ahead.
+	douyinMinSchedule = 2 * time.Hour
+	douyinMaxSchedule = 14 * 24 * time.Hour
+)
+
+// DouyinVisibility is who can see a published Douyin post.
+type DouyinVisibility int
+
+const (
+	DouyinPublic DouyinVisibility = iota
+	DouyinPrivate
+	DouyinFriends
+)
+
+// ParseDouyinVisibility accepts public, private or friends.
+func ParseDouyinVisibility(value string) (DouyinVisibility, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "public":
+		return DouyinPublic, nil
+	case "private":
+		return DouyinPrivate, nil
+	case "friends":
+		return DouyinFriends, nil
+	}
+	return 0, fmt.Errorf("unknown douyin visibility %q (want public, private or friends)", value)
+}
+
+// DouyinUploaderOptions configures the Douyin creator uploader: the
+// session it posts as, how many chunks it sends at once, and who can see
+// each post and when it goes live.
+type DouyinUploaderOptions struct {
+	// CookiePath is a JSON or Netscape cookie export of a logged-in
+	// creator.douyin.com session; it must contain sessionid.
+	CookiePath string
+	Limit      int
+	ChunkSize  int64
+	Visibility DouyinVisibility
+	// PublishAt schedules every post for a fixed time; PublishDelay
+	// schedules each post that long after its upload. Both zero publishes
+	// immediately.
+	PublishAt    time.Time
+	PublishDelay time.Duration
+	Templates    MetadataTemplates
+	// BaseURL overrides the creator API root (tests point it at httptest).
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// DouyinUploader publishes videos through the API of the Douyin creator
+// web client: it asks for an upload slot, sends the file in chunks to the
+// returned object storage URL and creates the post.
+type DouyinUploader struct {
+	opts   DouyinUploaderOptions
+	client *http.Client
+}
+
+func NewDouyinUploader(opts DouyinUploaderOptions) *DouyinUploader {
+	if opts.Limit <= 0 {
+		opts.Limit = 3
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = douyinDefaultChunk
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "douyin_cookies.json"
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = douyinCreatorURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &DouyinUploader{opts: opts, client: client}
+}
+
+func (u *DouyinUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	creds, err := loadCreatorCookies("douyin", u.opts.CookiePath, douyinSessionCookie)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	post, err := buildDouyinPost(req, u.opts.Templates)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if post.Timing, err = u.scheduledAt(time.Now()); err != nil {
+		return UploadResult{}, err
+	}
+	post.VisibilityType = int(u.opts.Visibility)
+
+	file, err := os.Open(req.Path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	name := filepath.Base(req.Path)
+	log.Println("Uploading the video to douyin at path:" + req.Path)
+
+	slot, err := u.apply(ctx, creds, name, info.Size())
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := (tosUploader{platform: "douyin", client: u.client, limit: u.opts.Limit}).upload(ctx, &slot.tosSlot, file, info.Size()); err != nil {
+		return UploadResult{}, err
+	}
+	post.VideoID = slot.VideoID
+
+	if req.Cover != "" {
+		// As on Bilibili, a rejected cover leaves Douyin to pick a frame.
+		if post.Poster, err = u.uploadCover(ctx, creds, req.Cover); err != nil {
+			log.Printf("douyin cover upload failed, continuing without cover: %v", err)
+		}
+	}
+	if len(req.Subtitles) > 0 {
+		log.Printf("douyin has no CC subtitles; use --subtitle-mode burn to publish them")
+	}
+	itemID, err := u.create(ctx, creds, post)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	log.Printf("Douyin accepted %s as %s", name, itemID)
+	return UploadResult{RemoteID: itemID, URL: douyinVideoURL + itemID}, nil
+}
+
+// scheduledAt returns the Unix time the post is scheduled for, or 0 to
+// publish immediately.
+func (u *DouyinUploader) scheduledAt(now time.Time) (int64, error) {
+	at := u.opts.PublishAt
+	if at.IsZero() && u.opts.PublishDelay > 0 {
+		at = now.Add(u.opts.PublishDelay)
+	}
+	if at.IsZero() {
+		return 0, nil
+	}
+	if err := CheckDouyinSchedule(at.Sub(now)); err != nil {
+		return 0, Permanent(fmt.Errorf("%w, not for %s", err, at.Format(time.RFC3339)))
+	}
+	return at.Unix(), nil
+}
+
+// CheckDouyinSchedule reports whether a post can be scheduled ahead of
+// now by that much.
+func CheckDouyinSchedule(ahead time.Duration) error {
+	if ahead < douyinMinSchedule || ahead > douyinMaxSchedule {
+		return errors.New("douyin can only schedule posts 2h to 14 days ahead")
+	}
+	return nil
+}
+
+type douyinTextExtra struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Type        int    `json:"type"`
+	HashtagName string `json:"hashtag_name"`
+}
+
+type douyinPost struct {
+	VideoID        string            `json:"video_id"`
+	ItemTitle      string            `json:"item_title"`
+	Text           string            `json:"text"`
+	TextExtra      []douyinTextExtra `json:"text_extra"`
+	Poster         string            `json:"poster,omitempty"`
+	VisibilityType int               `json:"visibility_type"`
+	Timing         int64             `json:"timing"`
+}
+
+// buildDouyinPost renders the title and text of a post. Tags become
+// hashtags appended to the text; text_extra marks where each one is, in
+// the UTF-16 offsets the web client uses.
+func buildDouyinPost(req UploadRequest, templates MetadataTemplates) (douyinPost, error) {
+	if req.Templates != nil {
+		templates = templates.Override(*req.Templates)
+	}
+	data := NewTemplateData(req)
+	rendered, err := templates.Render(data)
+	if err != nil {
+		return douyinPost{}, err
+	}
+	post := douyinPost{ItemTitle: truncateRunes(firstNonEmpty(rendered.Title, data.Title), douyinTitleLimit)}
+
+	tags := creatorHashtags(rendered.Tags, douyinTagLimit, douyinTagRuneLimit)
+	suffix := ""
+	for _, tag := range tags {
+		suffix += " #" + tag
+	}
+	text := truncateRunes(rendered.Description, douyinTextLimit-len([]rune(suffix)))
+	if text == "" {
+		suffix = strings.TrimPrefix(suffix, " ")
+	}
+	post.Text = text + suffix
+
+	offset := len(utf16.Encode([]rune(text)))
+	if text != "" {
+		offset++
+	}
+	for _, tag := range tags {
+		length := len(utf16.Encode([]rune("#" + tag)))
+		post.TextExtra = append(post.TextExtra, douyinTextExtra{Start: offset, End: offset + length, Type: 1, HashtagName: tag})
+		offset += length + 1
+	}
+	return post, nil
+}
+
+type douyinUploadSlot struct {
+	VideoID string `json:"video_id"`
+	tosSlot
+}
+
+func (u *DouyinUploader) apply(ctx context.Context, creds *creatorCookies, name string, size int64) (*douyinUploadSlot, error) {
+	query := url.Values{
+		"type":      {"video"},
+		"file_name": {name},
+		"file_size": {strconv.FormatInt(size, 10)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.opts.BaseURL+"/web/api/media/upload/apply/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	creds.apply(req)
+
+	var resp struct {
+		douyinStatus
+		Data douyinUploadSlot `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "douyin", "upload apply", &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err("upload apply"); err != nil {
+		return nil, err
+	}
+	slot := resp.Data
+	if slot.VideoID == "" || slot.UploadURL == "" {
+		return nil, &PlatformAPIError{Platform: "douyin", Endpoint: "upload apply", Status: http.StatusOK, Message: "no upload slot returned"}
+	}
+	if slot.ChunkSize <= 0 {
+		slot.ChunkSize = u.opts.ChunkSize
+	}
+	return &slot, nil
+}
+
+// uploadCover posts the cover image and returns the URI to use as poster.
+func (u *DouyinUploader) uploadCover(ctx context.Context, creds *creatorCookies, coverPath string) (string, error) {
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+	body, contentType, err := imageForm("image", coverPath, data)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.BaseURL+"/web/api/media/upload/image/", body)
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", contentType)
+
+	var resp struct {
+		douyinStatus
+		Data struct {
+			URI string `json:"uri"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "douyin", "cover upload", &resp); err != nil {
+		return "", err
+	}
+	if err := resp.err("cover upload"); err != nil {
+		return "", err
+	}
+	if resp.Data.URI == "" {
+		return "", &PlatformAPIError{Platform: "douyin", Endpoint: "cover upload", Status: http.StatusOK, Message: "no cover uri returned"}
+	}
+	return resp.Data.URI, nil
+}
+
+func (u *DouyinUploader) create(ctx context.Context, creds *creatorCookies, post douyinPost) (string, error) {
+	body, err := json.Marshal(post)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.BaseURL+"/web/api/media/aweme/create/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		douyinStatus
+		ItemID string `json:"item_id"`
+	}
+	if err := doCreatorJSON(u.client, req, "douyin", "create", &resp); err != nil {
+		return "", err
+	}
+	if err := resp.err("create"); err != nil {
+		return "", err
+	}
+	if resp.ItemID == "" {
+		return "", &PlatformAPIError{Platform: "douyin", Endpoint: "create", Status: http.StatusOK, Message: "no item id returned"}
+	}
+	return resp.ItemID, nil
+}
+
+// douyinStatus is the status envelope of every creator API response.
+type douyinStatus struct {
+	StatusCode int    `json:"status_code"`
+	StatusMsg  string `json:"status_msg"`
+}
+
+// douyinTransientCodes are status codes that mean "slow down" or "try
+// again later" rather than "this post is wrong".
+var douyinTransientCodes = map[int]bool{
+	7:    true, // too many requests
+	2053: true, // system busy
+	2190: true, // request intercepted by risk control
+}
+
+// douyinLoggedOutCodes mean the sessionid cookie is no longer valid.
+var douyinLoggedOutCodes = map[int]bool{
+	8: true, // user not logged in
+}
+
+func (s douyinStatus) err(endpoint string) error {
+	if s.StatusCode == 0 {
+		return nil
+	}
+	return &PlatformAPIError{Platform: "douyin", Endpoint: endpoint, Status: http.StatusOK, Code: s.StatusCode, Message: s.StatusMsg,
+		Transient: douyinTransientCodes[s.StatusCode], LoggedOut: douyinLoggedOutCodes[s.StatusCode]}
+}
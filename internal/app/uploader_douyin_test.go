@@ -0,0 +1,231 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDouyin is an httptest stand-in for the creator API and the object
+// storage it hands out upload URLs for.
+type fakeDouyin struct {
+	*fakeTOS
+	chunkSize int64
+	// createCodes are answered to successive create calls before the post
+	// is accepted.
+	createCodes []int
+
+	cover []byte
+	post  douyinPost
+}
+
+func newFakeDouyin(t *testing.T, chunkSize int64) *fakeDouyin {
+	f := &fakeDouyin{fakeTOS: newFakeTOS(t, "sessionid", map[string]any{"status_code": 8, "status_msg": "用户未登录"}), chunkSize: chunkSize}
+	f.mux.HandleFunc("GET /web/api/media/upload/apply/", f.apply)
+	f.mux.HandleFunc("POST /web/api/media/upload/image/", f.image)
+	f.mux.HandleFunc("POST /web/api/media/aweme/create/", f.create)
+	return f
+}
+
+func (f *fakeDouyin) apply(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	if r.URL.Query().Get("file_name") == "" || r.URL.Query().Get("file_size") == "" {
+		http.Error(w, "missing file info", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status_code": 0, "data": map[string]any{
+		"video_id":   "v0200fg10000",
+		"upload_url": f.server.URL + "/tos/obj/v0200fg10000",
+		"auth":       "tos-auth",
+		"chunk_size": f.chunkSize,
+	}})
+}
+
+func (f *fakeDouyin) image(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	file, header, err := r.FormFile("image")
+	if err != nil || header.Header.Get("Content-Type") != "image/jpeg" {
+		writeJSON(w, http.StatusOK, map[string]any{"status_code": 4, "status_msg": "bad image"})
+		return
+	}
+	f.mu.Lock()
+	f.cover, _ = io.ReadAll(file)
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"status_code": 0, "data": map[string]any{"uri": "tos-cn-i-0813/cover"}})
+}
+
+func (f *fakeDouyin) create(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	json.NewDecoder(r.Body).Decode(&f.post)
+	if len(f.createCodes) > 0 {
+		code := f.createCodes[0]
+		f.createCodes = f.createCodes[1:]
+		writeJSON(w, http.StatusOK, map[string]any{"status_code": code, "status_msg": "标题含有敏感词"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status_code": 0, "item_id": "7312345678901234567"})
+}
+
+func writeDouyinCookie(t *testing.T) string {
+	return writeCreatorCookie(t, `{"cookies":[{"name":"sessionid","value":"sess","domain":".douyin.com","expires":4102444800},{"name":"ttwid","value":"tt","expires":-1}],"origins":[]}`)
+}
+
+func TestDouyinUploaderUploadsInChunks(t *testing.T) {
+	fake := newFakeDouyin(t, 1000)
+	fake.failChunk = 2
+	path, content := writeVideoFile(t, "My Video.mp4", 3500)
+	cover, coverData := writeVideoFile(t, "My Video.jpg", 64)
+
+	u := NewDouyinUploader(DouyinUploaderOptions{
+		CookiePath:   writeDouyinCookie(t),
+		BaseURL:      fake.server.URL,
+		Limit:        2,
+		Visibility:   DouyinFriends,
+		PublishDelay: 3 * time.Hour,
+		Templates:    MetadataTemplates{Description: "来自 YouTube", Tags: "music, lo fi,#music,中文"},
+	})
+	res, err := u.Upload(context.Background(), UploadRequest{Path: path, Cover: cover})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if res.RemoteID != "7312345678901234567" || res.URL != "https://www.douyin.com/video/7312345678901234567" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var got []byte
+	var parts []string
+	for i := 0; i < 4; i++ {
+		got = append(got, fake.chunks[i]...)
+		parts = append(parts, fmt.Sprintf("%d:%08x", i+1, crc32.ChecksumIEEE(fake.chunks[i])))
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("reassembled %d bytes, want %d", len(got), len(content))
+	}
+	if fake.completed != strings.Join(parts, ",") {
+		t.Fatalf("completed with %q, want %q", fake.completed, strings.Join(parts, ","))
+	}
+	if !bytes.Equal(fake.cover, coverData) {
+		t.Fatal("cover was not uploaded")
+	}
+
+	post := fake.post
+	if post.VideoID != "v0200fg10000" || post.ItemTitle != "My Video" || post.Poster != "tos-cn-i-0813/cover" || post.VisibilityType != 2 {
+		t.Fatalf("unexpected post: %+v", post)
+	}
+	if post.Text != "来自 YouTube #music #lofi #中文" {
+		t.Fatalf("text=%q", post.Text)
+	}
+	if len(post.TextExtra) != 3 || post.TextExtra[1] != (douyinTextExtra{Start: 18, End: 23, Type: 1, HashtagName: "lofi"}) || post.TextExtra[2].End != 27 {
+		t.Fatalf("unexpected hashtags: %+v", post.TextExtra)
+	}
+	if ahead := time.Until(time.Unix(post.Timing, 0)); ahead < 2*time.Hour || ahead > 3*time.Hour {
+		t.Fatalf("expected the post scheduled three hours ahead, got %s", ahead)
+	}
+}
+
+func TestDouyinUploaderCreateError(t *testing.T) {
+	fake := newFakeDouyin(t, 1<<20)
+	fake.createCodes = []int{2}
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+
+	u := NewDouyinUploader(DouyinUploaderOptions{CookiePath: writeDouyinCookie(t), BaseURL: fake.server.URL})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	var apiErr *PlatformAPIError
+	if !errors.As(err, &apiErr) || apiErr.Endpoint != "create" || apiErr.Code != 2 {
+		t.Fatalf("expected a create error, got %v", err)
+	}
+	if ClassifyError(err) != ErrorPermanent {
+		t.Fatalf("expected a rejected post to be permanent")
+	}
+	if fake.post.Timing != 0 || fake.post.VisibilityType != 0 {
+		t.Fatalf("expected an immediate public post, got %+v", fake.post)
+	}
+}
+
+func TestDouyinUploaderRejectsBadSchedule(t *testing.T) {
+	path, _ := writeVideoFile(t, "clip.mp4", 10)
+	u := NewDouyinUploader(DouyinUploaderOptions{
+		CookiePath: writeDouyinCookie(t),
+		BaseURL:    "http://127.0.0.1:0",
+		PublishAt:  time.Now().Add(30 * time.Minute),
+	})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	if err == nil || !strings.Contains(err.Error(), "2h to 14 days") || ClassifyError(err) != ErrorPermanent {
+		t.Fatalf("expected a permanent schedule error, got %v", err)
+	}
+}
+
+func TestSyncVideoRetriesDouyinRateLimit(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDouyin(t, 1<<20)
+	fake.createCodes = []int{7}
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+	store := newTestStore(t)
+	c := &Controller{
+		Downloader: &stubDownloader{files: map[string][]string{videoURL("vid"): {path}}},
+		Uploader:   NewDouyinUploader(DouyinUploaderOptions{CookiePath: writeDouyinCookie(t), BaseURL: fake.server.URL}),
+		Store:      store,
+		Retry:      RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}
+
+	if err := c.SyncVideo(ctx, "vid"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	job, _ := store.GetJob(ctx, "vid")
+	if job.State != JobUploaded || job.Attempts != 2 {
+		t.Fatalf("expected the rate-limited upload to be retried, got %+v", job)
+	}
+}
+
+func TestSyncChannelStopsOnLoggedOutDouyinSession(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDouyin(t, 1<<20)
+	first, _ := writeVideoFile(t, "first.mp4", 100)
+	second, _ := writeVideoFile(t, "second.mp4", 100)
+	store := newTestStore(t)
+	c := &Controller{
+		Downloader: &stubDownloader{ids: []string{"first", "second"}, files: map[string][]string{videoURL("first"): {first}, videoURL("second"): {second}}},
+		Uploader: NewDouyinUploader(DouyinUploaderOptions{
+			CookiePath: writeCreatorCookie(t, `[{"name":"sessionid","value":"expired"}]`),
+			BaseURL:    fake.server.URL,
+		}),
+		Store: store,
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	}
+
+	result, err := c.SyncChannel(ctx, "chan", 2)
+	if !errors.Is(err, ErrNotLoggedIn) || !strings.Contains(err.Error(), "re-export the douyin cookies") {
+		t.Fatalf("expected the sync to stop on the expired session, got %v", err)
+	}
+	if result.Failed != 0 || result.DeadLettered != 0 {
+		t.Fatalf("expected no video to be failed, got %+v", result)
+	}
+	for _, id := range []string{"first", "second"} {
+		if dl, _ := store.GetDeadLetter(ctx, id); dl != nil {
+			t.Fatalf("%s was dead-lettered: %+v", id, dl)
+		}
+	}
+	job, _ := store.GetJob(ctx, "first")
+	if job.State == JobFailed || job.Attempts > 1 {
+		t.Fatalf("expected the job to be left for the next sync, got %+v", job)
+	}
+	if _, action := describeError(err); action != ActionRefreshCookies {
+		t.Fatalf("action=%s, want %s", action, ActionRefreshCookies)
+	}
+}
@@ -0,0 +1,342 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	kuaishouCreatorURL    = "https://cp.kuaishou.com"
+	kuaishouVideoURL      = "https://www.kuaishou.com/short-video/"
+	kuaishouSessionCookie = "kuaishou.web.cp.api_st"
+	kuaishouDefaultChunk  = 4 << 20
+	kuaishouCaptionLimit  = 500
+	kuaishouTagLimit      = 4
+	kuaishouTagRuneLimit  = 20
+	// kuaishouSuccess is the result code of a successful API call.
+	kuaishouSuccess = 1
+)
+
+// KuaishouUploaderOptions configures the Kuaishou creator uploader. Limit
+// is how many fragments of ChunkSize bytes are sent at once.
+type KuaishouUploaderOptions struct {
+	// CookiePath is a JSON or Netscape cookie export of a logged-in
+	// cp.kuaishou.com session; it must contain kuaishou.web.cp.api_st.
+	CookiePath string
+	Limit      int
+	ChunkSize  int64
+	Templates  MetadataTemplates
+	// BaseURL overrides the creator API root (tests point it at httptest).
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// KuaishouUploader publishes videos through the API of the Kuaishou
+// creator web client: it reserves an upload token, sends the file in
+// fragments to the upload host that comes with it, and submits the work.
+type KuaishouUploader struct {
+	opts   KuaishouUploaderOptions
+	client *http.Client
+}
+
+func NewKuaishouUploader(opts KuaishouUploaderOptions) *KuaishouUploader {
+	if opts.Limit <= 0 {
+		opts.Limit = 3
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = kuaishouDefaultChunk
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "kuaishou_cookies.json"
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = kuaishouCreatorURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &KuaishouUploader{opts: opts, client: client}
+}
+
+func (u *KuaishouUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	creds, err := loadCreatorCookies("kuaishou", u.opts.CookiePath, kuaishouSessionCookie)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	caption, err := buildKuaishouCaption(req, u.opts.Templates)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	file, err := os.Open(req.Path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	name := filepath.Base(req.Path)
+	log.Println("Uploading the video to kuaishou at path:" + req.Path)
+
+	slot, err := u.pre(ctx, creds)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := u.uploadVideo(ctx, slot, file, info.Size()); err != nil {
+		return UploadResult{}, err
+	}
+	coverKey, err := u.finish(ctx, creds, slot, name, info.Size())
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	if req.Cover != "" {
+		// finish already picked a frame as cover; keep it if ours is rejected.
+		if key, err := u.uploadCover(ctx, creds, req.Cover); err != nil {
+			log.Printf("kuaishou cover upload failed, continuing with the default cover: %v", err)
+		} else {
+			coverKey = key
+		}
+	}
+	if len(req.Subtitles) > 0 {
+		log.Printf("kuaishou has no CC subtitles; use --subtitle-mode burn to publish them")
+	}
+	photoID, err := u.submit(ctx, creds, kuaishouWork{FileID: slot.FileID, CoverKey: coverKey, Caption: caption})
+	if err != nil {
+		return UploadResult{}, err
+	}
+	log.Printf("Kuaishou accepted %s as %s", name, photoID)
+	return UploadResult{RemoteID: photoID, URL: kuaishouVideoURL + photoID}, nil
+}
+
+// buildKuaishouCaption renders the single caption Kuaishou has: the title,
+// the description and the tags as hashtags, clamped to
+// kuaishouCaptionLimit runes without cutting into the hashtags.
+func buildKuaishouCaption(req UploadRequest, templates MetadataTemplates) (string, error) {
+	if req.Templates != nil {
+		templates = templates.Override(*req.Templates)
+	}
+	data := NewTemplateData(req)
+	rendered, err := templates.Render(data)
+	if err != nil {
+		return "", err
+	}
+	var suffix []string
+	for _, tag := range creatorHashtags(rendered.Tags, kuaishouTagLimit, kuaishouTagRuneLimit) {
+		suffix = append(suffix, "#"+tag)
+	}
+	tail := strings.Join(suffix, " ")
+	text := strings.Join(filterEmpty([]string{firstNonEmpty(rendered.Title, data.Title), rendered.Description}), "\n")
+	text = truncateRunes(text, max(kuaishouCaptionLimit-len([]rune(tail))-1, 0))
+	return strings.TrimSpace(text + " " + tail), nil
+}
+
+type kuaishouUploadSlot struct {
+	Token  string `json:"token"`
+	FileID int64  `json:"fileId"`
+	// Endpoints are the upload hosts; the first one is used.
+	Endpoints []struct {
+		Host string `json:"host"`
+	} `json:"endpoint"`
+	uploadURL string
+}
+
+// pre reserves an upload token and the host to send fragments to.
+func (u *KuaishouUploader) pre(ctx context.Context, creds *creatorCookies) (*kuaishouUploadSlot, error) {
+	var resp struct {
+		kuaishouStatus
+		Data kuaishouUploadSlot `json:"data"`
+	}
+	if err := u.api(ctx, creds, "/rest/cp/works/v2/video/pc/upload/pre", map[string]any{"uploadType": 1}, "upload pre", &resp); err != nil {
+		return nil, err
+	}
+	slot := resp.Data
+	if slot.Token == "" || len(slot.Endpoints) == 0 || slot.Endpoints[0].Host == "" {
+		return nil, &PlatformAPIError{Platform: "kuaishou", Endpoint: "upload pre", Status: http.StatusOK, Message: "no upload token returned"}
+	}
+	scheme := "https"
+	if base, err := url.Parse(u.opts.BaseURL); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	slot.uploadURL = scheme + "://" + slot.Endpoints[0].Host
+	return &slot, nil
+}
+
+// uploadVideo sends the file as numbered fragments (0-based) and then
+// tells the upload host how many there were.
+func (u *KuaishouUploader) uploadVideo(ctx context.Context, slot *kuaishouUploadSlot, file io.ReaderAt, size int64) error {
+	token := url.QueryEscape(slot.Token)
+	parts, err := uploadInChunks(ctx, "kuaishou", file, size, u.opts.ChunkSize, u.opts.Limit, func(ctx context.Context, index int, chunk *io.SectionReader) (string, error) {
+		query := "?upload_token=" + token + "&fragment_id=" + strconv.Itoa(index)
+		return "", u.fragment(ctx, slot, "/api/upload/fragment"+query, chunk, "chunk upload")
+	})
+	if err != nil {
+		return err
+	}
+	query := "?upload_token=" + token + "&fragment_count=" + strconv.Itoa(len(parts))
+	return u.fragment(ctx, slot, "/api/upload/complete"+query, nil, "upload complete")
+}
+
+func (u *KuaishouUploader) fragment(ctx context.Context, slot *kuaishouUploadSlot, path string, chunk *io.SectionReader, endpoint string) error {
+	var body io.Reader = http.NoBody
+	if chunk != nil {
+		body = chunk
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slot.uploadURL+path, body)
+	if err != nil {
+		return err
+	}
+	if chunk != nil {
+		req.ContentLength = chunk.Size()
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	var resp kuaishouStatus
+	if err := doCreatorJSON(u.client, req, "kuaishou", endpoint, &resp); err != nil {
+		return err
+	}
+	return resp.err(endpoint)
+}
+
+// finish registers the uploaded file with the creator API and returns the
+// key of the cover Kuaishou picked from it.
+func (u *KuaishouUploader) finish(ctx context.Context, creds *creatorCookies, slot *kuaishouUploadSlot, name string, size int64) (string, error) {
+	var resp struct {
+		kuaishouStatus
+		Data struct {
+			CoverKey string `json:"coverKey"`
+		} `json:"data"`
+	}
+	body := map[string]any{
+		"token":      slot.Token,
+		"fileId":     slot.FileID,
+		"fileName":   name,
+		"fileLength": size,
+	}
+	if err := u.api(ctx, creds, "/rest/cp/works/v2/video/pc/upload/finish", body, "upload finish", &resp); err != nil {
+		return "", err
+	}
+	return resp.Data.CoverKey, nil
+}
+
+// uploadCover posts the cover image and returns its key.
+func (u *KuaishouUploader) uploadCover(ctx context.Context, creds *creatorCookies, coverPath string) (string, error) {
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+	body, contentType, err := imageForm("file", coverPath, data)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.BaseURL+"/rest/cp/works/v2/video/pc/upload/cover/upload", body)
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", contentType)
+
+	var resp struct {
+		kuaishouStatus
+		Data struct {
+			CoverKey string `json:"coverKey"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "kuaishou", "cover upload", &resp); err != nil {
+		return "", err
+	}
+	if err := resp.err("cover upload"); err != nil {
+		return "", err
+	}
+	if resp.Data.CoverKey == "" {
+		return "", &PlatformAPIError{Platform: "kuaishou", Endpoint: "cover upload", Status: http.StatusOK, Message: "no cover key returned"}
+	}
+	return resp.Data.CoverKey, nil
+}
+
+type kuaishouWork struct {
+	FileID   int64  `json:"fileId"`
+	CoverKey string `json:"coverKey"`
+	Caption  string `json:"caption"`
+	// PhotoStatus 1 publishes the work publicly.
+	PhotoStatus int `json:"photoStatus"`
+}
+
+func (u *KuaishouUploader) submit(ctx context.Context, creds *creatorCookies, work kuaishouWork) (string, error) {
+	work.PhotoStatus = 1
+	var resp struct {
+		kuaishouStatus
+		Data struct {
+			PhotoID string `json:"photoId"`
+		} `json:"data"`
+	}
+	if err := u.api(ctx, creds, "/rest/cp/works/v2/video/pc/submit", work, "submit", &resp); err != nil {
+		return "", err
+	}
+	if resp.Data.PhotoID == "" {
+		return "", &PlatformAPIError{Platform: "kuaishou", Endpoint: "submit", Status: http.StatusOK, Message: "no photo id returned"}
+	}
+	return resp.Data.PhotoID, nil
+}
+
+// kuaishouResponse is implemented by the response types of api.
+type kuaishouResponse interface {
+	err(endpoint string) error
+}
+
+// api posts body as JSON to a creator API path and checks the result code.
+func (u *KuaishouUploader) api(ctx context.Context, creds *creatorCookies, path string, body any, endpoint string, out kuaishouResponse) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/json")
+	if err := doCreatorJSON(u.client, req, "kuaishou", endpoint, out); err != nil {
+		return err
+	}
+	return out.err(endpoint)
+}
+
+// kuaishouStatus is the envelope of every Kuaishou API response.
+type kuaishouStatus struct {
+	Result  int    `json:"result"`
+	Message string `json:"message"`
+}
+
+// kuaishouTransientCodes are results that mean "slow down" rather than
+// "this work is wrong".
+var kuaishouTransientCodes = map[int]bool{
+	120: true, // operating too frequently
+	500: true, // server busy
+	503: true, // service unavailable
+}
+
+// kuaishouLoggedOutCodes mean the kuaishou.web.cp.api_st cookie is no
+// longer valid.
+var kuaishouLoggedOutCodes = map[int]bool{
+	109: true, // not logged in
+}
+
+func (s kuaishouStatus) err(endpoint string) error {
+	if s.Result == kuaishouSuccess {
+		return nil
+	}
+	return &PlatformAPIError{Platform: "kuaishou", Endpoint: endpoint, Status: http.StatusOK, Code: s.Result, Message: firstNonEmpty(s.Message, "request failed"),
+		Transient: kuaishouTransientCodes[s.Result], LoggedOut: kuaishouLoggedOutCodes[s.Result]}
+}
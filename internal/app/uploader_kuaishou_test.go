@@ -0,0 +1,194 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeKuaishou is an httptest stand-in for the creator API and the upload
+// host it hands out tokens for.
+type fakeKuaishou struct {
+	*fakeCreator
+	submitResult int
+
+	fragmentCount int
+	finished      map[string]any
+	cover         []byte
+	work          kuaishouWork
+}
+
+func newFakeKuaishou(t *testing.T) *fakeKuaishou {
+	f := &fakeKuaishou{fakeCreator: newFakeCreator(t, "kuaishou.web.cp.api_st", map[string]any{"result": 109, "message": "未登录"}), fragmentCount: -1}
+	f.mux.HandleFunc("POST /rest/cp/works/v2/video/pc/upload/pre", f.pre)
+	f.mux.HandleFunc("POST /api/upload/fragment", f.fragment)
+	f.mux.HandleFunc("POST /api/upload/complete", f.complete)
+	f.mux.HandleFunc("POST /rest/cp/works/v2/video/pc/upload/finish", f.finish)
+	f.mux.HandleFunc("POST /rest/cp/works/v2/video/pc/upload/cover/upload", f.coverUpload)
+	f.mux.HandleFunc("POST /rest/cp/works/v2/video/pc/submit", f.submit)
+	return f
+}
+
+func (f *fakeKuaishou) pre(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"result": 1, "data": map[string]any{
+		"token":    "tok-1",
+		"fileId":   4242,
+		"endpoint": []map[string]any{{"host": strings.TrimPrefix(f.server.URL, "http://")}},
+	}})
+}
+
+func (f *fakeKuaishou) fragment(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	index, err := strconv.Atoi(q.Get("fragment_id"))
+	if q.Get("upload_token") != "tok-1" || err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"result": 400, "message": "bad fragment"})
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.receiveChunk(w, index, body) {
+		writeJSON(w, http.StatusOK, map[string]any{"result": 1})
+	}
+}
+
+func (f *fakeKuaishou) complete(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if q.Get("upload_token") != "tok-1" {
+		writeJSON(w, http.StatusOK, map[string]any{"result": 400, "message": "bad token"})
+		return
+	}
+	f.fragmentCount, _ = strconv.Atoi(q.Get("fragment_count"))
+	writeJSON(w, http.StatusOK, map[string]any{"result": 1})
+}
+
+func (f *fakeKuaishou) finish(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	f.mu.Lock()
+	json.NewDecoder(r.Body).Decode(&f.finished)
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"result": 1, "data": map[string]any{"coverKey": "frame-cover"}})
+}
+
+func (f *fakeKuaishou) coverUpload(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"result": 400, "message": "bad image"})
+		return
+	}
+	f.mu.Lock()
+	f.cover, _ = io.ReadAll(file)
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"result": 1, "data": map[string]any{"coverKey": "custom-cover"}})
+}
+
+func (f *fakeKuaishou) submit(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	json.NewDecoder(r.Body).Decode(&f.work)
+	if f.submitResult != 0 {
+		writeJSON(w, http.StatusOK, map[string]any{"result": f.submitResult, "message": "作品描述违规"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"result": 1, "data": map[string]any{"photoId": "3xabc123"}})
+}
+
+func writeKuaishouCookie(t *testing.T) string {
+	return writeCreatorCookie(t, `[{"name":"kuaishou.web.cp.api_st","value":"sess","expirationDate":4102444800},{"name":"userId","value":"1"}]`)
+}
+
+func TestKuaishouUploaderUploadsInFragments(t *testing.T) {
+	fake := newFakeKuaishou(t)
+	fake.failChunk = 1
+	path, content := writeVideoFile(t, "My Video.mp4", 2500)
+	cover, coverData := writeVideoFile(t, "My Video.jpg", 64)
+
+	u := NewKuaishouUploader(KuaishouUploaderOptions{
+		CookiePath: writeKuaishouCookie(t),
+		BaseURL:    fake.server.URL,
+		ChunkSize:  1000,
+		Templates:  MetadataTemplates{Description: "来自 YouTube", Tags: "music, lo fi,#music"},
+	})
+	res, err := u.Upload(context.Background(), UploadRequest{Path: path, Cover: cover})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if res.RemoteID != "3xabc123" || res.URL != "https://www.kuaishou.com/short-video/3xabc123" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var got []byte
+	for i := 0; i < 3; i++ {
+		got = append(got, fake.chunks[i]...)
+	}
+	if !bytes.Equal(got, content) || fake.fragmentCount != 3 {
+		t.Fatalf("reassembled %d bytes from %d fragments, want %d from 3", len(got), fake.fragmentCount, len(content))
+	}
+	if fake.finished["token"] != "tok-1" || fake.finished["fileName"] != "My Video.mp4" || fake.finished["fileLength"] != float64(2500) {
+		t.Fatalf("unexpected finish request: %v", fake.finished)
+	}
+	if !bytes.Equal(fake.cover, coverData) {
+		t.Fatal("cover was not uploaded")
+	}
+	work := fake.work
+	if work.FileID != 4242 || work.CoverKey != "custom-cover" || work.PhotoStatus != 1 {
+		t.Fatalf("unexpected work: %+v", work)
+	}
+	if work.Caption != "My Video\n来自 YouTube #music #lofi" {
+		t.Fatalf("caption=%q", work.Caption)
+	}
+}
+
+func TestKuaishouUploaderSubmitError(t *testing.T) {
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+	for result, want := range map[int]ErrorClass{500002: ErrorPermanent, 120: ErrorTransient} {
+		fake := newFakeKuaishou(t)
+		fake.submitResult = result
+
+		u := NewKuaishouUploader(KuaishouUploaderOptions{CookiePath: writeKuaishouCookie(t), BaseURL: fake.server.URL})
+		_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+		var apiErr *PlatformAPIError
+		if !errors.As(err, &apiErr) || apiErr.Endpoint != "submit" || apiErr.Code != result {
+			t.Fatalf("expected a submit error, got %v", err)
+		}
+		if got := ClassifyError(err); got != want {
+			t.Fatalf("result %d: got %s error, want %s", result, got, want)
+		}
+		if fake.work.CoverKey != "frame-cover" {
+			t.Fatalf("expected the cover picked by finish, got %q", fake.work.CoverKey)
+		}
+	}
+}
+
+func TestKuaishouUploaderExpiredSession(t *testing.T) {
+	fake := newFakeKuaishou(t)
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+
+	u := NewKuaishouUploader(KuaishouUploaderOptions{
+		CookiePath: writeCreatorCookie(t, `[{"name":"kuaishou.web.cp.api_st","value":"expired"}]`),
+		BaseURL:    fake.server.URL,
+	})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	if !errors.Is(err, ErrNotLoggedIn) || (RetryPolicy{}).shouldDeadLetter(err, 1) {
+		t.Fatalf("expected a logged-out error that is not dead-lettered, got %v", err)
+	}
+}
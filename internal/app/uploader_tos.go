@@ -0,0 +1,101 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// tosSuccess is the code ByteDance's object storage (TOS) answers with.
+const tosSuccess = 2000
+
+// tosTransientCodes are TOS codes worth retrying the upload for.
+var tosTransientCodes = map[int]bool{
+	4029: true, // request throttled
+	5000: true, // internal error
+	5003: true, // service unavailable
+}
+
+// tosSlot is an upload slot in TOS, as handed out by the Douyin and Xigua
+// creator APIs.
+type tosSlot struct {
+	UploadURL string `json:"upload_url"`
+	Auth      string `json:"auth"`
+	ChunkSize int64  `json:"chunk_size"`
+}
+
+// tosUploader sends files to TOS slots on behalf of one platform.
+type tosUploader struct {
+	platform string
+	client   *http.Client
+	limit    int
+}
+
+type tosResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		UploadID string `json:"uploadid"`
+	} `json:"data"`
+}
+
+// upload sends the file as a multipart upload to slot: init, one PUT per
+// part with its CRC32, then the part list.
+func (t tosUploader) upload(ctx context.Context, slot *tosSlot, file io.ReaderAt, size int64) error {
+	var init tosResponse
+	if err := t.do(ctx, slot, http.MethodPost, "?uploads", nil, "", "upload init", &init); err != nil {
+		return err
+	}
+	if init.Data.UploadID == "" {
+		return &PlatformAPIError{Platform: t.platform, Endpoint: "upload init", Status: http.StatusOK, Message: "no upload id returned"}
+	}
+	uploadID := url.QueryEscape(init.Data.UploadID)
+
+	crcs, err := uploadInChunks(ctx, t.platform, file, size, slot.ChunkSize, t.limit, func(ctx context.Context, index int, chunk *io.SectionReader) (string, error) {
+		data, err := io.ReadAll(chunk)
+		if err != nil {
+			return "", err
+		}
+		crc := fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))
+		query := "?partNumber=" + strconv.Itoa(index+1) + "&uploadID=" + uploadID
+		var resp tosResponse
+		if err := t.do(ctx, slot, http.MethodPut, query, data, crc, "chunk upload", &resp); err != nil {
+			return "", err
+		}
+		return crc, nil
+	})
+	if err != nil {
+		return err
+	}
+	parts := make([]string, len(crcs))
+	for i, crc := range crcs {
+		parts[i] = strconv.Itoa(i+1) + ":" + crc
+	}
+	var done tosResponse
+	return t.do(ctx, slot, http.MethodPost, "?uploadID="+uploadID, []byte(strings.Join(parts, ",")), "", "upload complete", &done)
+}
+
+func (t tosUploader) do(ctx context.Context, slot *tosSlot, method, query string, body []byte, crc, endpoint string, out *tosResponse) error {
+	req, err := http.NewRequestWithContext(ctx, method, slot.UploadURL+query, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", slot.Auth)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if crc != "" {
+		req.Header.Set("Content-CRC32", crc)
+	}
+	if err := doCreatorJSON(t.client, req, t.platform, endpoint, out); err != nil {
+		return err
+	}
+	if out.Code != tosSuccess {
+		return &PlatformAPIError{Platform: t.platform, Endpoint: endpoint, Status: http.StatusOK, Code: out.Code, Message: out.Message, Transient: tosTransientCodes[out.Code]}
+	}
+	return nil
+}
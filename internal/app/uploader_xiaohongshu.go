@@ -0,0 +1,454 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	xiaohongshuCreatorURL    = "https://creator.xiaohongshu.com"
+	xiaohongshuAPIURL        = "https://edith.xiaohongshu.com"
+	xiaohongshuNoteURL       = "https://www.xiaohongshu.com/explore/"
+	xiaohongshuSessionCookie = "web_session"
+	xiaohongshuDefaultChunk  = 5 << 20
+	xiaohongshuTitleLimit    = 20
+	xiaohongshuDescLimit     = 1000
+	xiaohongshuTopicLimit    = 10
+)
+
+// XiaohongshuUploaderOptions configures the Xiaohongshu (RED) creator
+// uploader, which publishes each video as a video note.
+type XiaohongshuUploaderOptions struct {
+	// CookiePath is a JSON or Netscape cookie export of a logged-in
+	// creator.xiaohongshu.com session; it must contain web_session.
+	CookiePath string
+	Limit      int
+	ChunkSize  int64
+	// Private publishes notes visible only to the account itself.
+	Private   bool
+	Templates MetadataTemplates
+	// BaseURL overrides the creator API root that hands out upload
+	// permits, APIBaseURL the API notes are published through (tests point
+	// both at httptest).
+	BaseURL    string
+	APIBaseURL string
+	HTTPClient *http.Client
+}
+
+// XiaohongshuUploader publishes videos as Xiaohongshu video notes: it gets
+// an upload permit, sends the video in parts to the object storage the
+// permit names, uploads the cover the same way and creates the note.
+type XiaohongshuUploader struct {
+	opts   XiaohongshuUploaderOptions
+	client *http.Client
+}
+
+func NewXiaohongshuUploader(opts XiaohongshuUploaderOptions) *XiaohongshuUploader {
+	if opts.Limit <= 0 {
+		opts.Limit = 3
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = xiaohongshuDefaultChunk
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "xiaohongshu_cookies.json"
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = xiaohongshuCreatorURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	if opts.APIBaseURL == "" {
+		opts.APIBaseURL = xiaohongshuAPIURL
+	}
+	opts.APIBaseURL = strings.TrimRight(opts.APIBaseURL, "/")
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &XiaohongshuUploader{opts: opts, client: client}
+}
+
+func (u *XiaohongshuUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	creds, err := loadCreatorCookies("xiaohongshu", u.opts.CookiePath, xiaohongshuSessionCookie)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	meta, err := buildXiaohongshuMetadata(req, u.opts.Templates)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	file, err := os.Open(req.Path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	name := filepath.Base(req.Path)
+	log.Println("Uploading the video to xiaohongshu at path:" + req.Path)
+
+	permit, err := u.permit(ctx, creds, "video")
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := u.uploadVideo(ctx, permit, file, info.Size()); err != nil {
+		return UploadResult{}, err
+	}
+
+	coverID := ""
+	if req.Cover != "" {
+		// Without a cover Xiaohongshu uses the first frame, so a failed
+		// cover upload is not worth failing the note over.
+		if coverID, err = u.uploadCover(ctx, creds, req.Cover); err != nil {
+			log.Printf("xiaohongshu cover upload failed, continuing without cover: %v", err)
+		}
+	}
+	if len(req.Subtitles) > 0 {
+		log.Printf("xiaohongshu has no CC subtitles; use --subtitle-mode burn to publish them")
+	}
+	note := u.note(ctx, creds, meta, permit.FileID, coverID)
+	noteID, err := u.create(ctx, creds, note)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	log.Printf("Xiaohongshu accepted %s as note %s", name, noteID)
+	return UploadResult{RemoteID: noteID, URL: xiaohongshuNoteURL + noteID}, nil
+}
+
+type xiaohongshuMetadata struct {
+	Title  string
+	Desc   string
+	Topics []string
+}
+
+// buildXiaohongshuMetadata renders the note fields and clamps them to
+// Xiaohongshu's limits. Tags become topics.
+func buildXiaohongshuMetadata(req UploadRequest, templates MetadataTemplates) (xiaohongshuMetadata, error) {
+	if req.Templates != nil {
+		templates = templates.Override(*req.Templates)
+	}
+	data := NewTemplateData(req)
+	rendered, err := templates.Render(data)
+	if err != nil {
+		return xiaohongshuMetadata{}, err
+	}
+	return xiaohongshuMetadata{
+		Title:  strings.TrimSpace(truncateRunes(firstNonEmpty(rendered.Title, data.Title), xiaohongshuTitleLimit)),
+		Desc:   rendered.Description,
+		Topics: creatorHashtags(rendered.Tags, xiaohongshuTopicLimit, 0),
+	}, nil
+}
+
+type xiaohongshuPermit struct {
+	FileID     string
+	Token      string
+	UploadAddr string
+	uploadURL  string
+}
+
+// permit asks for a temporary upload permit for one file of scene
+// ("video" or "image").
+func (u *XiaohongshuUploader) permit(ctx context.Context, creds *creatorCookies, scene string) (*xiaohongshuPermit, error) {
+	query := url.Values{
+		"biz_name":   {"spectrum"},
+		"scene":      {scene},
+		"file_count": {"1"},
+		"version":    {"1"},
+		"source":     {"web"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.opts.BaseURL+"/api/media/v1/upload/web/permit?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	creds.apply(req)
+
+	var resp struct {
+		xiaohongshuStatus
+		Data struct {
+			UploadTempPermits []struct {
+				FileIDs    []string `json:"fileIds"`
+				Token      string   `json:"token"`
+				UploadAddr string   `json:"uploadAddr"`
+			} `json:"uploadTempPermits"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "xiaohongshu", "upload permit", &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err("upload permit"); err != nil {
+		return nil, err
+	}
+	permits := resp.Data.UploadTempPermits
+	if len(permits) == 0 || len(permits[0].FileIDs) == 0 || permits[0].UploadAddr == "" {
+		return nil, &PlatformAPIError{Platform: "xiaohongshu", Endpoint: "upload permit", Status: http.StatusOK, Message: "no upload permit returned"}
+	}
+	p := &xiaohongshuPermit{FileID: permits[0].FileIDs[0], Token: permits[0].Token, UploadAddr: permits[0].UploadAddr}
+	scheme := "https"
+	if base, err := url.Parse(u.opts.BaseURL); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	p.uploadURL = scheme + "://" + p.UploadAddr + "/" + strings.TrimPrefix(p.FileID, "/")
+	return p, nil
+}
+
+type xiaohongshuPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadVideo sends the file as an S3-style multipart upload: initiate,
+// one PUT per part, then complete with the part list.
+func (u *XiaohongshuUploader) uploadVideo(ctx context.Context, permit *xiaohongshuPermit, file io.ReaderAt, size int64) error {
+	body, _, err := u.storage(ctx, permit, http.MethodPost, "?uploads", nil, "", "upload init")
+	if err != nil {
+		return err
+	}
+	var init struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &init); err != nil || init.UploadID == "" {
+		return &PlatformAPIError{Platform: "xiaohongshu", Endpoint: "upload init", Status: http.StatusOK, Message: "no upload id returned"}
+	}
+	uploadID := url.QueryEscape(init.UploadID)
+
+	etags, err := uploadInChunks(ctx, "xiaohongshu", file, size, u.opts.ChunkSize, u.opts.Limit, func(ctx context.Context, index int, chunk *io.SectionReader) (string, error) {
+		query := "?partNumber=" + strconv.Itoa(index+1) + "&uploadId=" + uploadID
+		_, header, err := u.storage(ctx, permit, http.MethodPut, query, chunk, "", "chunk upload")
+		if err != nil {
+			return "", err
+		}
+		return header.Get("ETag"), nil
+	})
+	if err != nil {
+		return err
+	}
+	complete := struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []xiaohongshuPart `xml:"Part"`
+	}{}
+	for i, etag := range etags {
+		complete.Parts = append(complete.Parts, xiaohongshuPart{PartNumber: i + 1, ETag: etag})
+	}
+	data, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	_, _, err = u.storage(ctx, permit, http.MethodPost, "?uploadId="+uploadID, bytes.NewReader(data), "application/xml", "upload complete")
+	return err
+}
+
+// uploadCover uploads the cover image in one request and returns its file
+// id.
+func (u *XiaohongshuUploader) uploadCover(ctx context.Context, creds *creatorCookies, coverPath string) (string, error) {
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+	permit, err := u.permit(ctx, creds, "image")
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := u.storage(ctx, permit, http.MethodPut, "", bytes.NewReader(data), imageContentType(coverPath), "cover upload"); err != nil {
+		return "", err
+	}
+	return permit.FileID, nil
+}
+
+// storage sends one request to the object storage of permit and returns
+// the response body and headers. An empty contentType sends raw bytes.
+func (u *XiaohongshuUploader) storage(ctx context.Context, permit *xiaohongshuPermit, method, query string, body io.Reader, contentType, endpoint string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, permit.uploadURL+query, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chunk, ok := body.(*io.SectionReader); ok {
+		req.ContentLength = chunk.Size()
+	}
+	req.Header.Set("X-Cos-Security-Token", permit.Token)
+	req.Header.Set("Content-Type", firstNonEmpty(contentType, "application/octet-stream"))
+	req.Header.Set("User-Agent", browserUserAgent)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("xiaohongshu %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("xiaohongshu %s: %w", endpoint, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, nil, &PlatformAPIError{Platform: "xiaohongshu", Endpoint: endpoint, Status: resp.StatusCode, Message: strings.TrimSpace(truncateRunes(string(data), 512)), LoggedOut: resp.StatusCode == http.StatusUnauthorized}
+	}
+	return data, resp.Header, nil
+}
+
+type xiaohongshuHashTag struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Link string `json:"link"`
+	Type string `json:"type"`
+}
+
+type xiaohongshuNote struct {
+	Common struct {
+		Type        string               `json:"type"`
+		Title       string               `json:"title"`
+		Desc        string               `json:"desc"`
+		HashTag     []xiaohongshuHashTag `json:"hash_tag"`
+		PrivacyInfo struct {
+			OpType int `json:"op_type"`
+			Type   int `json:"type"`
+		} `json:"privacy_info"`
+	} `json:"common"`
+	VideoInfo struct {
+		FileID string           `json:"fileid"`
+		Cover  *xiaohongshuFile `json:"cover,omitempty"`
+	} `json:"video_info"`
+}
+
+type xiaohongshuFile struct {
+	FileID string `json:"fileid"`
+}
+
+// note assembles the note. Topics Xiaohongshu knows are linked as
+// "#name[话题]#"; the others stay plain hashtags in the text.
+func (u *XiaohongshuUploader) note(ctx context.Context, creds *creatorCookies, meta xiaohongshuMetadata, fileID, coverID string) xiaohongshuNote {
+	var note xiaohongshuNote
+	note.Common.Type = "video"
+	note.Common.Title = meta.Title
+	note.Common.PrivacyInfo.OpType = 1
+	if u.opts.Private {
+		note.Common.PrivacyInfo.Type = 1
+	}
+	note.VideoInfo.FileID = fileID
+	if coverID != "" {
+		note.VideoInfo.Cover = &xiaohongshuFile{FileID: coverID}
+	}
+
+	var suffix []string
+	for _, name := range meta.Topics {
+		topic, err := u.searchTopic(ctx, creds, name)
+		if err != nil {
+			log.Printf("xiaohongshu topic lookup for %q failed, adding it as plain text: %v", name, err)
+		}
+		if topic == nil {
+			suffix = append(suffix, "#"+name)
+			continue
+		}
+		note.Common.HashTag = append(note.Common.HashTag, *topic)
+		suffix = append(suffix, "#"+topic.Name+"[话题]#")
+	}
+	tail := strings.Join(suffix, " ")
+	desc := truncateRunes(meta.Desc, max(xiaohongshuDescLimit-len([]rune(tail))-1, 0))
+	note.Common.Desc = strings.TrimSpace(desc + "\n" + tail)
+	return note
+}
+
+// searchTopic returns the topic named exactly name, or nil.
+func (u *XiaohongshuUploader) searchTopic(ctx context.Context, creds *creatorCookies, name string) (*xiaohongshuHashTag, error) {
+	body, err := json.Marshal(map[string]any{
+		"keyword": name,
+		"page":    map[string]int{"page_size": 20, "page": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.APIBaseURL+"/web_api/sns/v1/search/topic", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		xiaohongshuStatus
+		Data struct {
+			Topics []xiaohongshuHashTag `json:"topic_info_dtos"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "xiaohongshu", "topic search", &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err("topic search"); err != nil {
+		return nil, err
+	}
+	for _, topic := range resp.Data.Topics {
+		if strings.EqualFold(topic.Name, name) {
+			topic.Type = "topic"
+			return &topic, nil
+		}
+	}
+	return nil, nil
+}
+
+func (u *XiaohongshuUploader) create(ctx context.Context, creds *creatorCookies, note xiaohongshuNote) (string, error) {
+	body, err := json.Marshal(note)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.APIBaseURL+"/web_api/sns/v2/note", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		xiaohongshuStatus
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "xiaohongshu", "create note", &resp); err != nil {
+		return "", err
+	}
+	if err := resp.err("create note"); err != nil {
+		return "", err
+	}
+	if resp.Data.ID == "" {
+		return "", &PlatformAPIError{Platform: "xiaohongshu", Endpoint: "create note", Status: http.StatusOK, Message: "no note id returned"}
+	}
+	return resp.Data.ID, nil
+}
+
+// xiaohongshuStatus is the envelope of every Xiaohongshu API response.
+type xiaohongshuStatus struct {
+	Success bool   `json:"success"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+}
+
+// xiaohongshuTransientCodes are codes that mean "slow down" rather than
+// "this note is wrong".
+var xiaohongshuTransientCodes = map[int]bool{
+	-1:     true, // system busy
+	300012: true, // request intercepted by risk control
+	300013: true, // requests too frequent
+}
+
+// xiaohongshuLoggedOutCodes mean the web_session cookie is no longer valid.
+var xiaohongshuLoggedOutCodes = map[int]bool{
+	-100: true, // login expired
+	-101: true, // not logged in
+}
+
+func (s xiaohongshuStatus) err(endpoint string) error {
+	if s.Success && s.Code == 0 {
+		return nil
+	}
+	return &PlatformAPIError{Platform: "xiaohongshu", Endpoint: endpoint, Status: http.StatusOK, Code: s.Code, Message: firstNonEmpty(s.Msg, "request failed"),
+		Transient: xiaohongshuTransientCodes[s.Code], LoggedOut: xiaohongshuLoggedOutCodes[s.Code]}
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeXiaohongshu is an httptest stand-in for the creator API, the note API
+// and the object storage upload permits point at.
+type fakeXiaohongshu struct {
+	*fakeCreator
+	createCode int
+
+	permits   int
+	completed []xiaohongshuPart
+	cover     []byte
+	note      xiaohongshuNote
+}
+
+func newFakeXiaohongshu(t *testing.T) *fakeXiaohongshu {
+	f := &fakeXiaohongshu{fakeCreator: newFakeCreator(t, "web_session", map[string]any{"success": false, "code": -100, "msg": "登录已过期"})}
+	f.mux.HandleFunc("GET /api/media/v1/upload/web/permit", f.permit)
+	f.mux.HandleFunc("/spectrum/", f.storage)
+	f.mux.HandleFunc("POST /web_api/sns/v1/search/topic", f.searchTopic)
+	f.mux.HandleFunc("POST /web_api/sns/v2/note", f.create)
+	return f
+}
+
+func (f *fakeXiaohongshu) permit(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	f.mu.Lock()
+	f.permits++
+	id := "spectrum/" + r.URL.Query().Get("scene") + strconv.Itoa(f.permits)
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "code": 0, "data": map[string]any{
+		"uploadTempPermits": []map[string]any{{
+			"fileIds":    []string{id},
+			"token":      "cos-token",
+			"uploadAddr": strings.TrimPrefix(f.server.URL, "http://"),
+		}},
+	}})
+}
+
+func (f *fakeXiaohongshu) storage(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Cos-Security-Token") != "cos-token" {
+		http.Error(w, "bad token", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/spectrum/image2" && r.Method == http.MethodPut:
+		if r.Header.Get("Content-Type") != "image/jpeg" {
+			http.Error(w, "bad cover", http.StatusBadRequest)
+			return
+		}
+		f.cover = body
+	case r.URL.Path != "/spectrum/video1":
+		http.Error(w, "unknown object", http.StatusNotFound)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		w.Write([]byte(`<?xml version="1.0"?><InitiateMultipartUploadResult><UploadId>up-1</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == http.MethodPut && q.Get("uploadId") == "up-1":
+		index, _ := strconv.Atoi(q.Get("partNumber"))
+		w.Header().Set("ETag", `"etag-`+strconv.Itoa(index)+`"`)
+		f.receiveChunk(w, index-1, body)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "up-1":
+		var complete struct {
+			Parts []xiaohongshuPart `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		f.completed = complete.Parts
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeXiaohongshu) searchTopic(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Keyword string `json:"keyword"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	topics := []map[string]any{}
+	if req.Keyword == "音乐" {
+		topics = append(topics, map[string]any{"id": "5be00d0e", "name": "音乐", "link": "https://www.xiaohongshu.com/page/topics/5be00d0e"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "code": 0, "data": map[string]any{"topic_info_dtos": topics}})
+}
+
+func (f *fakeXiaohongshu) create(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	json.NewDecoder(r.Body).Decode(&f.note)
+	if f.createCode != 0 {
+		writeJSON(w, http.StatusOK, map[string]any{"success": false, "code": f.createCode, "msg": "笔记内容违规"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "code": 0, "data": map[string]any{"id": "65a1b2c3000000001f03a4b5"}})
+}
+
+func writeXiaohongshuCookie(t *testing.T) string {
+	return writeCreatorCookie(t, `[{"name":"web_session","value":"sess","expirationDate":4102444800},{"name":"a1","value":"x"}]`)
+}
+
+func TestXiaohongshuUploaderPublishesVideoNote(t *testing.T) {
+	fake := newFakeXiaohongshu(t)
+	fake.failChunk = 1
+	path, content := writeVideoFile(t, "A rather long video title for notes.mp4", 2500)
+	cover, coverData := writeVideoFile(t, "cover.jpg", 64)
+
+	u := NewXiaohongshuUploader(XiaohongshuUploaderOptions{
+		CookiePath: writeXiaohongshuCookie(t),
+		BaseURL:    fake.server.URL,
+		APIBaseURL: fake.server.URL,
+		ChunkSize:  1000,
+		Limit:      2,
+		Private:    true,
+		Templates:  MetadataTemplates{Description: "搬运自 YouTube", Tags: "音乐, vlog,#音乐"},
+	})
+	res, err := u.Upload(context.Background(), UploadRequest{Path: path, Cover: cover})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if res.RemoteID != "65a1b2c3000000001f03a4b5" || res.URL != "https://www.xiaohongshu.com/explore/65a1b2c3000000001f03a4b5" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	got := append(append(append([]byte{}, fake.chunks[0]...), fake.chunks[1]...), fake.chunks[2]...)
+	if !bytes.Equal(got, content) {
+		t.Fatalf("reassembled %d bytes, want %d", len(got), len(content))
+	}
+	if len(fake.completed) != 3 || fake.completed[2] != (xiaohongshuPart{PartNumber: 3, ETag: `"etag-3"`}) {
+		t.Fatalf("unexpected completed parts: %+v", fake.completed)
+	}
+	if !bytes.Equal(fake.cover, coverData) {
+		t.Fatal("cover was not uploaded")
+	}
+
+	note := fake.note
+	if note.Common.Type != "video" || note.Common.Title != "A rather long video" || note.Common.PrivacyInfo.Type != 1 {
+		t.Fatalf("unexpected note: %+v", note.Common)
+	}
+	if note.Common.Desc != "搬运自 YouTube\n#音乐[话题]# #vlog" {
+		t.Fatalf("desc=%q", note.Common.Desc)
+	}
+	if len(note.Common.HashTag) != 1 || note.Common.HashTag[0].ID != "5be00d0e" || note.Common.HashTag[0].Type != "topic" {
+		t.Fatalf("unexpected topics: %+v", note.Common.HashTag)
+	}
+	if note.VideoInfo.FileID != "spectrum/video1" || note.VideoInfo.Cover == nil || note.VideoInfo.Cover.FileID != "spectrum/image2" {
+		t.Fatalf("unexpected video info: %+v", note.VideoInfo)
+	}
+}
+
+func TestXiaohongshuUploaderCreateError(t *testing.T) {
+	fake := newFakeXiaohongshu(t)
+	fake.createCode = -9101
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+
+	u := NewXiaohongshuUploader(XiaohongshuUploaderOptions{CookiePath: writeXiaohongshuCookie(t), BaseURL: fake.server.URL, APIBaseURL: fake.server.URL})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	var apiErr *PlatformAPIError
+	if !errors.As(err, &apiErr) || apiErr.Endpoint != "create note" || apiErr.Code != -9101 || ClassifyError(err) != ErrorPermanent {
+		t.Fatalf("expected a permanent create error, got %v", err)
+	}
+	if fake.note.VideoInfo.Cover != nil || fake.note.Common.PrivacyInfo.Type != 0 {
+		t.Fatalf("expected a public note without cover, got %+v", fake.note)
+	}
+}
+
+func TestXiaohongshuUploaderRateLimitAndExpiredSession(t *testing.T) {
+	fake := newFakeXiaohongshu(t)
+	fake.createCode = 300013
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+
+	u := NewXiaohongshuUploader(XiaohongshuUploaderOptions{CookiePath: writeXiaohongshuCookie(t), BaseURL: fake.server.URL, APIBaseURL: fake.server.URL})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	var apiErr *PlatformAPIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 300013 || ClassifyError(err) != ErrorTransient {
+		t.Fatalf("expected a transient rate limit error, got %v", err)
+	}
+
+	expired := writeCreatorCookie(t, `[{"name":"web_session","value":"expired"}]`)
+	u = NewXiaohongshuUploader(XiaohongshuUploaderOptions{CookiePath: expired, BaseURL: fake.server.URL, APIBaseURL: fake.server.URL})
+	_, err = u.Upload(context.Background(), UploadRequest{Path: path})
+	if !errors.Is(err, ErrNotLoggedIn) || (RetryPolicy{}).shouldDeadLetter(err, 1) {
+		t.Fatalf("expected a logged-out error that is not dead-lettered, got %v", err)
+	}
+}
+
+func TestXiaohongshuUploaderRequiresSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(path, []byte(`[{"name":"a1","value":"x"}]`), 0o600)
+	video, _ := writeVideoFile(t, "clip.mp4", 10)
+
+	u := NewXiaohongshuUploader(XiaohongshuUploaderOptions{CookiePath: path, BaseURL: "http://127.0.0.1:0"})
+	if _, err := u.Upload(context.Background(), UploadRequest{Path: video}); err == nil || !strings.Contains(err.Error(), "missing web_session") {
+		t.Fatalf("expected a missing web_session error, got %v", err)
+	}
+}
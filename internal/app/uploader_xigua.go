@@ -0,0 +1,268 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	xiguaStudioURL     = "https://studio.ixigua.com"
+	xiguaVideoURL      = "https://www.ixigua.com/"
+	xiguaSessionCookie = "sessionid"
+	xiguaDefaultChunk  = 5 << 20
+	xiguaTitleLimit    = 30
+	xiguaAbstractLimit = 400
+	xiguaTagLimit      = 5
+	xiguaTagRuneLimit  = 20
+)
+
+// XiguaUploaderOptions configures the Xigua Video creator uploader.
+// ChunkSize is only used when the upload slot does not set one.
+type XiguaUploaderOptions struct {
+	// CookiePath is a JSON or Netscape cookie export of a logged-in
+	// studio.ixigua.com session; it must contain sessionid.
+	CookiePath string
+	Limit      int
+	ChunkSize  int64
+	Templates  MetadataTemplates
+	// BaseURL overrides the creator API root (tests point it at httptest).
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// XiguaUploader publishes long-form videos to Xigua Video. Xigua is part
+// of ByteDance, so uploads go to the same object storage as Douyin's: it
+// asks for an upload slot, sends the file in chunks and publishes it.
+type XiguaUploader struct {
+	opts   XiguaUploaderOptions
+	client *http.Client
+}
+
+func NewXiguaUploader(opts XiguaUploaderOptions) *XiguaUploader {
+	if opts.Limit <= 0 {
+		opts.Limit = 3
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = xiguaDefaultChunk
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "xigua_cookies.json"
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = xiguaStudioURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &XiguaUploader{opts: opts, client: client}
+}
+
+func (u *XiguaUploader) Upload(ctx context.Context, req UploadRequest) (UploadResult, error) {
+	creds, err := loadCreatorCookies("xigua", u.opts.CookiePath, xiguaSessionCookie)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	video, err := buildXiguaVideo(req, u.opts.Templates)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	file, err := os.Open(req.Path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	name := filepath.Base(req.Path)
+	log.Println("Uploading the video to xigua at path:" + req.Path)
+
+	slot, err := u.apply(ctx, creds, name, info.Size())
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := (tosUploader{platform: "xigua", client: u.client, limit: u.opts.Limit}).upload(ctx, &slot.tosSlot, file, info.Size()); err != nil {
+		return UploadResult{}, err
+	}
+	video.VID = slot.VID
+
+	if req.Cover != "" {
+		// Xigua picks a frame itself when no poster is given.
+		if video.PosterURI, err = u.uploadCover(ctx, creds, req.Cover); err != nil {
+			log.Printf("xigua cover upload failed, continuing without cover: %v", err)
+		}
+	}
+	if len(req.Subtitles) > 0 {
+		log.Printf("xigua has no CC subtitles; use --subtitle-mode burn to publish them")
+	}
+	itemID, err := u.publish(ctx, creds, video)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	log.Printf("Xigua accepted %s as %s", name, itemID)
+	return UploadResult{RemoteID: itemID, URL: xiguaVideoURL + itemID}, nil
+}
+
+type xiguaVideo struct {
+	VID       string   `json:"vid"`
+	Title     string   `json:"title"`
+	Abstract  string   `json:"abstract"`
+	Tags      []string `json:"tags"`
+	PosterURI string   `json:"poster_uri,omitempty"`
+}
+
+// buildXiguaVideo renders the title, abstract and tags of a video and
+// clamps them to Xigua's limits.
+func buildXiguaVideo(req UploadRequest, templates MetadataTemplates) (xiguaVideo, error) {
+	if req.Templates != nil {
+		templates = templates.Override(*req.Templates)
+	}
+	data := NewTemplateData(req)
+	rendered, err := templates.Render(data)
+	if err != nil {
+		return xiguaVideo{}, err
+	}
+	return xiguaVideo{
+		Title:    strings.TrimSpace(truncateRunes(firstNonEmpty(rendered.Title, data.Title), xiguaTitleLimit)),
+		Abstract: truncateRunes(rendered.Description, xiguaAbstractLimit),
+		Tags:     creatorHashtags(rendered.Tags, xiguaTagLimit, xiguaTagRuneLimit),
+	}, nil
+}
+
+type xiguaUploadSlot struct {
+	VID string `json:"vid"`
+	tosSlot
+}
+
+func (u *XiguaUploader) apply(ctx context.Context, creds *creatorCookies, name string, size int64) (*xiguaUploadSlot, error) {
+	query := url.Values{
+		"file_name": {name},
+		"file_size": {strconv.FormatInt(size, 10)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.opts.BaseURL+"/upload/api/video/apply/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	creds.apply(req)
+
+	var resp struct {
+		xiguaStatus
+		Data xiguaUploadSlot `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "xigua", "upload apply", &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err("upload apply"); err != nil {
+		return nil, err
+	}
+	slot := resp.Data
+	if slot.VID == "" || slot.UploadURL == "" {
+		return nil, &PlatformAPIError{Platform: "xigua", Endpoint: "upload apply", Status: http.StatusOK, Message: "no upload slot returned"}
+	}
+	if slot.ChunkSize <= 0 {
+		slot.ChunkSize = u.opts.ChunkSize
+	}
+	return &slot, nil
+}
+
+// uploadCover posts the cover image and returns the URI to use as poster.
+func (u *XiguaUploader) uploadCover(ctx context.Context, creds *creatorCookies, coverPath string) (string, error) {
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+	body, contentType, err := imageForm("image", coverPath, data)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.BaseURL+"/upload/api/image/", body)
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", contentType)
+
+	var resp struct {
+		xiguaStatus
+		Data struct {
+			URI string `json:"uri"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "xigua", "cover upload", &resp); err != nil {
+		return "", err
+	}
+	if err := resp.err("cover upload"); err != nil {
+		return "", err
+	}
+	if resp.Data.URI == "" {
+		return "", &PlatformAPIError{Platform: "xigua", Endpoint: "cover upload", Status: http.StatusOK, Message: "no cover uri returned"}
+	}
+	return resp.Data.URI, nil
+}
+
+func (u *XiguaUploader) publish(ctx context.Context, creds *creatorCookies, video xiguaVideo) (string, error) {
+	body, err := json.Marshal(video)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.opts.BaseURL+"/xigua/api/upload/video_publish/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	creds.apply(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		xiguaStatus
+		Data struct {
+			ItemID string `json:"item_id"`
+		} `json:"data"`
+	}
+	if err := doCreatorJSON(u.client, req, "xigua", "publish", &resp); err != nil {
+		return "", err
+	}
+	if err := resp.err("publish"); err != nil {
+		return "", err
+	}
+	if resp.Data.ItemID == "" {
+		return "", &PlatformAPIError{Platform: "xigua", Endpoint: "publish", Status: http.StatusOK, Message: "no item id returned"}
+	}
+	return resp.Data.ItemID, nil
+}
+
+// xiguaStatus is the envelope of every Xigua creator API response.
+type xiguaStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// xiguaTransientCodes are codes that mean "slow down" rather than "this
+// video is wrong".
+var xiguaTransientCodes = map[int]bool{
+	1003: true, // system busy
+	1005: true, // requests too frequent
+}
+
+// xiguaLoggedOutCodes mean the sessionid cookie is no longer valid.
+var xiguaLoggedOutCodes = map[int]bool{
+	10001: true, // please log in first
+}
+
+func (s xiguaStatus) err(endpoint string) error {
+	if s.Code == 0 {
+		return nil
+	}
+	return &PlatformAPIError{Platform: "xigua", Endpoint: endpoint, Status: http.StatusOK, Code: s.Code, Message: s.Message,
+		Transient: xiguaTransientCodes[s.Code], LoggedOut: xiguaLoggedOutCodes[s.Code]}
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeXigua is an httptest stand-in for the Xigua creator API and the
+// object storage it hands out upload URLs for.
+type fakeXigua struct {
+	*fakeTOS
+	chunkSize   int64
+	publishCode int
+
+	cover []byte
+	video xiguaVideo
+}
+
+func newFakeXigua(t *testing.T, chunkSize int64) *fakeXigua {
+	f := &fakeXigua{fakeTOS: newFakeTOS(t, "sessionid", map[string]any{"code": 10001, "message": "请先登录"}), chunkSize: chunkSize}
+	f.mux.HandleFunc("GET /upload/api/video/apply/", f.apply)
+	f.mux.HandleFunc("POST /upload/api/image/", f.image)
+	f.mux.HandleFunc("POST /xigua/api/upload/video_publish/", f.publish)
+	return f
+}
+
+func (f *fakeXigua) apply(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	if r.URL.Query().Get("file_name") == "" || r.URL.Query().Get("file_size") == "" {
+		http.Error(w, "missing file info", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "data": map[string]any{
+		"vid":        "v02b3cg10000",
+		"upload_url": f.server.URL + "/tos/obj/v02b3cg10000",
+		"auth":       "tos-auth",
+		"chunk_size": f.chunkSize,
+	}})
+}
+
+func (f *fakeXigua) image(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"code": 4, "message": "bad image"})
+		return
+	}
+	f.mu.Lock()
+	f.cover, _ = io.ReadAll(file)
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "data": map[string]any{"uri": "tos-cn-p-0015/poster"}})
+}
+
+func (f *fakeXigua) publish(w http.ResponseWriter, r *http.Request) {
+	if !f.loggedIn(w, r) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	json.NewDecoder(r.Body).Decode(&f.video)
+	if f.publishCode != 0 {
+		writeJSON(w, http.StatusOK, map[string]any{"code": f.publishCode, "message": "标题不符合规范"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "data": map[string]any{"item_id": "7298765432109876543"}})
+}
+
+func writeXiguaCookie(t *testing.T) string {
+	return writeCreatorCookie(t, `{"cookies":[{"name":"sessionid","value":"sess","domain":".ixigua.com","expires":4102444800}],"origins":[]}`)
+}
+
+func TestXiguaUploaderUploadsInChunks(t *testing.T) {
+	fake := newFakeXigua(t, 1000)
+	fake.failChunk = 0
+	path, content := writeVideoFile(t, "A rather long video title that Xigua will cut.mp4", 2200)
+	cover, coverData := writeVideoFile(t, "poster.png", 64)
+
+	u := NewXiguaUploader(XiguaUploaderOptions{
+		CookiePath: writeXiguaCookie(t),
+		BaseURL:    fake.server.URL,
+		Templates:  MetadataTemplates{Description: "来自 YouTube", Tags: "music, lo fi,#music"},
+	})
+	res, err := u.Upload(context.Background(), UploadRequest{Path: path, Cover: cover})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if res.RemoteID != "7298765432109876543" || res.URL != "https://www.ixigua.com/7298765432109876543" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var got []byte
+	var parts []string
+	for i := 0; i < 3; i++ {
+		got = append(got, fake.chunks[i]...)
+		parts = append(parts, fmt.Sprintf("%d:%08x", i+1, crc32.ChecksumIEEE(fake.chunks[i])))
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("reassembled %d bytes, want %d", len(got), len(content))
+	}
+	if fake.completed != strings.Join(parts, ",") {
+		t.Fatalf("completed with %q, want %q", fake.completed, strings.Join(parts, ","))
+	}
+	if !bytes.Equal(fake.cover, coverData) {
+		t.Fatal("cover was not uploaded")
+	}
+	video := fake.video
+	if video.VID != "v02b3cg10000" || video.Title != "A rather long video title that" || video.Abstract != "来自 YouTube" || video.PosterURI != "tos-cn-p-0015/poster" {
+		t.Fatalf("unexpected video: %+v", video)
+	}
+	if strings.Join(video.Tags, ",") != "music,lofi" {
+		t.Fatalf("tags=%v", video.Tags)
+	}
+}
+
+func TestXiguaUploaderPublishError(t *testing.T) {
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+	for code, want := range map[int]ErrorClass{2003: ErrorPermanent, 1005: ErrorTransient} {
+		fake := newFakeXigua(t, 1<<20)
+		fake.publishCode = code
+
+		u := NewXiguaUploader(XiguaUploaderOptions{CookiePath: writeXiguaCookie(t), BaseURL: fake.server.URL})
+		_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+		var apiErr *PlatformAPIError
+		if !errors.As(err, &apiErr) || apiErr.Endpoint != "publish" || apiErr.Code != code {
+			t.Fatalf("expected a publish error, got %v", err)
+		}
+		if got := ClassifyError(err); got != want {
+			t.Fatalf("code %d: got %s error, want %s", code, got, want)
+		}
+	}
+}
+
+func TestXiguaUploaderExpiredSession(t *testing.T) {
+	fake := newFakeXigua(t, 1<<20)
+	path, _ := writeVideoFile(t, "clip.mp4", 100)
+
+	u := NewXiguaUploader(XiguaUploaderOptions{
+		CookiePath: writeCreatorCookie(t, `[{"name":"sessionid","value":"expired"}]`),
+		BaseURL:    fake.server.URL,
+	})
+	_, err := u.Upload(context.Background(), UploadRequest{Path: path})
+	if !errors.Is(err, ErrNotLoggedIn) || (RetryPolicy{}).shouldDeadLetter(err, 1) {
+		t.Fatalf("expected a logged-out error that is not dead-lettered, got %v", err)
+	}
+}
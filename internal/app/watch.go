@@ -0,0 +1,244 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+)
+
+// WatchEntry is one channel synced on a schedule by the Watcher.
+type WatchEntry struct {
+	ChannelID string
+	Limit     int
+	Schedule  Schedule
+	// Jitter delays every run by a random amount up to this long so many
+	// channels on the same schedule do not hit YouTube at once.
+	Jitter time.Duration
+}
+
+type watchEntryFile struct {
+	ChannelID string `json:"channel_id"`
+	Limit     int    `json:"limit"`
+	Schedule  string `json:"schedule"`
+	Jitter    string `json:"jitter"`
+}
+
+// LoadWatchList reads a JSON array of channel subscriptions such as
+//
+//	[{"channel_id": "UC...", "limit": 5, "schedule": "0 */6 * * *", "jitter": "5m"}]
+//
+// See ParseSchedule for the accepted schedules.
+func LoadWatchList(path string) ([]WatchEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []watchEntryFile
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing watch list %s: %w", path, err)
+	}
+	entries := make([]WatchEntry, 0, len(raw))
+	for i, r := range raw {
+		entry, err := r.entry()
+		if err != nil {
+			return nil, fmt.Errorf("watch list %s entry %d: %w", path, i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r watchEntryFile) entry() (WatchEntry, error) {
+	if r.ChannelID == "" {
+		return WatchEntry{}, errors.New("channel_id is required")
+	}
+	if r.Limit <= 0 {
+		return WatchEntry{}, errors.New("limit must be > 0")
+	}
+	schedule, err := ParseSchedule(r.Schedule)
+	if err != nil {
+		return WatchEntry{}, err
+	}
+	entry := WatchEntry{ChannelID: r.ChannelID, Limit: r.Limit, Schedule: schedule}
+	if r.Jitter != "" {
+		entry.Jitter, err = time.ParseDuration(r.Jitter)
+		if err != nil || entry.Jitter < 0 {
+			return WatchEntry{}, fmt.Errorf("invalid jitter %q", r.Jitter)
+		}
+	}
+	return entry, nil
+}
+
+// Watcher syncs each entry's channel whenever its schedule is due. The
+// last run of every channel is kept in the store, so a restarted watcher
+// carries on where it stopped instead of syncing everything at once.
+type Watcher struct {
+	Controller *Controller
+	Entries    []WatchEntry
+	// Subscriptions also schedules every enabled subscription that has a
+	// schedule, re-reading the table every ReloadInterval (default one
+	// minute) so API and CLI changes take effect without a restart.
+	Subscriptions  bool
+	ReloadInterval time.Duration
+	// Jitter is applied to subscription runs.
+	Jitter time.Duration
+}
+
+const defaultWatchReload = time.Minute
+
+// Run blocks until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	if w.Controller == nil || w.Controller.Store == nil {
+		return errors.New("watcher needs a controller with a store")
+	}
+	var wg sync.WaitGroup
+	for _, entry := range w.Entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.watch(ctx, entry)
+		}()
+	}
+	if w.Subscriptions {
+		w.followSubscriptions(ctx, &wg)
+	}
+	wg.Wait()
+	return nil
+}
+
+// followSubscriptions keeps one watch loop per scheduled subscription
+// until ctx is cancelled, restarting a loop when its limit or schedule
+// changes and stopping it when the subscription is disabled or removed.
+func (w *Watcher) followSubscriptions(ctx context.Context, wg *sync.WaitGroup) {
+	type running struct {
+		sub    Subscription
+		cancel context.CancelFunc
+	}
+	active := map[string]running{}
+	defer func() {
+		for _, r := range active {
+			r.cancel()
+		}
+	}()
+	interval := w.ReloadInterval
+	if interval <= 0 {
+		interval = defaultWatchReload
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		subs, err := w.Controller.Store.ListSubscriptions(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("watch: reading subscriptions: %v", err)
+		}
+		if err == nil {
+			wanted := map[string]Subscription{}
+			for _, sub := range subs {
+				if sub.Enabled && sub.Schedule != "" {
+					wanted[sub.ChannelID] = sub
+				}
+			}
+			for id, r := range active {
+				if sub, ok := wanted[id]; !ok || sub.Limit != r.sub.Limit || sub.Schedule != r.sub.Schedule {
+					r.cancel()
+					delete(active, id)
+				}
+			}
+			for id, sub := range wanted {
+				if _, ok := active[id]; ok {
+					continue
+				}
+				entry, err := sub.watchEntry(w.Jitter)
+				if err != nil {
+					log.Printf("watch: %v", err)
+					continue
+				}
+				entryCtx, cancel := context.WithCancel(ctx)
+				active[id] = running{sub: sub, cancel: cancel}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w.watch(entryCtx, entry)
+				}()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) watch(ctx context.Context, entry WatchEntry) {
+	next := time.Now()
+	last, err := w.Controller.Store.LastChannelRun(ctx, entry.ChannelID)
+	if err != nil {
+		log.Printf("watch %s: reading last run: %v", entry.ChannelID, err)
+	} else if last != nil {
+		next = entry.Schedule.Next(last.StartedAt)
+	}
+	for {
+		if next.IsZero() {
+			log.Printf("watch %s: schedule never fires again, stopping", entry.ChannelID)
+			return
+		}
+		delay := time.Until(next)
+		if entry.Jitter > 0 {
+			delay += rand.N(entry.Jitter)
+		}
+		log.Printf("watch %s: next sync at %s", entry.ChannelID, time.Now().Add(delay).Format(time.RFC3339))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		started := time.Now()
+		w.runOnce(ctx, entry, started)
+		if ctx.Err() != nil {
+			return
+		}
+		next = entry.Schedule.Next(started)
+		// Skip slots missed while a long sync was running rather than
+		// starting the next one straight away.
+		if now := time.Now(); !next.IsZero() && next.Before(now) {
+			next = entry.Schedule.Next(now)
+		}
+	}
+}
+
+func (w *Watcher) runOnce(ctx context.Context, entry WatchEntry, started time.Time) {
+	log.Printf("watch %s: syncing (limit %d)", entry.ChannelID, entry.Limit)
+	res, err := w.Controller.SyncChannel(ctx, entry.ChannelID, entry.Limit)
+	switch {
+	case errors.Is(err, ErrSyncInProgress):
+		log.Printf("watch %s: previous sync still running, skipping this run", entry.ChannelID)
+		return
+	case ctx.Err() != nil:
+		// Leave the last run untouched so the interrupted sync is redone
+		// first thing after a restart.
+		return
+	}
+	run := ChannelRun{ChannelID: entry.ChannelID, StartedAt: started, FinishedAt: time.Now()}
+	if err != nil {
+		run.LastError = err.Error()
+		log.Printf("watch %s: sync failed: %v", entry.ChannelID, err)
+	} else {
+		log.Printf("watch %s: %d uploaded, %d skipped, %d failed", entry.ChannelID, res.Uploaded, res.Skipped, res.Failed)
+		if res.Failed > 0 {
+			run.LastError = fmt.Sprintf("%d of %d videos failed", res.Failed, res.Considered)
+		}
+	}
+	if err := w.Controller.Store.RecordChannelRun(ctx, run); err != nil {
+		log.Printf("watch %s: recording run: %v", entry.ChannelID, err)
+	}
+}
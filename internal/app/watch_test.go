@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingDownloader struct {
+	stubDownloader
+	lists atomic.Int32
+}
+
+func (d *countingDownloader) ListChannelVideoIDs(ctx context.Context, channelURL string, limit int, jsRuntime string) ([]string, error) {
+	d.lists.Add(1)
+	return nil, nil
+}
+
+func runWatcher(t *testing.T, w *Watcher, d time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("watcher: %v", err)
+	}
+}
+
+func TestWatcherSyncsOnScheduleAndRecordsRuns(t *testing.T) {
+	store := newTestStore(t)
+	downloader := &countingDownloader{}
+	c := &Controller{Downloader: downloader, Uploader: &stubUploader{}, Store: store}
+	schedule, _ := ParseSchedule("@every 30ms")
+
+	runWatcher(t, &Watcher{Controller: c, Entries: []WatchEntry{{ChannelID: "UC1", Limit: 3, Schedule: schedule}}}, 200*time.Millisecond)
+
+	if n := downloader.lists.Load(); n < 3 {
+		t.Fatalf("expected several scheduled syncs, got %d", n)
+	}
+	run, err := store.LastChannelRun(context.Background(), "UC1")
+	if err != nil || run == nil {
+		t.Fatalf("expected a recorded run, got %+v, %v", run, err)
+	}
+	if run.FinishedAt.Before(run.StartedAt) || run.LastError != "" {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+}
+
+func TestWatcherWaitsForScheduleAfterRecentRun(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Now()
+	if err := store.RecordChannelRun(ctx, ChannelRun{ChannelID: "UC1", StartedAt: now, FinishedAt: now}); err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	downloader := &countingDownloader{}
+	c := &Controller{Downloader: downloader, Uploader: &stubUploader{}, Store: store}
+	schedule, _ := ParseSchedule("@hourly")
+
+	runWatcher(t, &Watcher{Controller: c, Entries: []WatchEntry{
+		{ChannelID: "UC1", Limit: 1, Schedule: schedule},
+		{ChannelID: "UC2", Limit: 1, Schedule: schedule},
+	}}, 100*time.Millisecond)
+
+	// UC1 ran moments ago; only the never-synced UC2 is due.
+	if n := downloader.lists.Load(); n != 1 {
+		t.Fatalf("expected only the new channel to sync, got %d syncs", n)
+	}
+}
+
+func TestSyncChannelRejectsOverlappingRuns(t *testing.T) {
+	downloader := &gatedDownloader{gate: make(chan struct{})}
+	c := &Controller{Downloader: downloader, Uploader: &gatedUploader{}, Store: newTestStore(t)}
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.SyncChannel(context.Background(), "UC1", 1)
+		done <- err
+	}()
+	for {
+		downloader.mu.Lock()
+		busy := downloader.active == 1
+		downloader.mu.Unlock()
+		if busy {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := c.SyncChannel(context.Background(), "UC1", 1); !errors.Is(err, ErrSyncInProgress) {
+		t.Fatalf("expected ErrSyncInProgress, got %v", err)
+	}
+	close(downloader.gate)
+	if err := <-done; err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if _, err := c.SyncChannel(context.Background(), "UC1", 0); err != nil {
+		t.Fatalf("sync after the first finished: %v", err)
+	}
+}
+
+func TestLoadWatchList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.json")
+	os.WriteFile(path, []byte(`[
+		{"channel_id": "UC1", "limit": 5, "schedule": "0 */6 * * *", "jitter": "5m"},
+		{"channel_id": "UC2", "limit": 2, "schedule": "@every 1h"}
+	]`), 0o644)
+	entries, err := LoadWatchList(path)
+	if err != nil {
+		t.Fatalf("LoadWatchList: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ChannelID != "UC1" || entries[0].Jitter != 5*time.Minute || entries[1].Limit != 2 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	os.WriteFile(path, []byte(`[{"channel_id": "UC1", "limit": 5, "schedule": "every day"}]`), 0o644)
+	if _, err := LoadWatchList(path); err == nil {
+		t.Fatal("expected an invalid schedule to be rejected")
+	}
+}
+
+func TestWatcherFollowsSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	for _, sub := range []Subscription{
+		{ChannelID: "UC1", Limit: 1, Schedule: "@every 1h", Enabled: true},
+		{ChannelID: "UC2", Limit: 1, Schedule: "@every 1h", Enabled: false},
+		{ChannelID: "UC3", Limit: 1, Enabled: true},
+	} {
+		if err := store.AddSubscription(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	downloader := &countingDownloader{}
+	c := &Controller{Downloader: downloader, Uploader: &stubUploader{}, Store: store}
+	w := &Watcher{Controller: c, Subscriptions: true, ReloadInterval: 20 * time.Millisecond}
+
+	go func() {
+		// Enabling a subscription is picked up on the next reload.
+		time.Sleep(50 * time.Millisecond)
+		sub, _ := store.GetSubscription(ctx, "UC2")
+		sub.Enabled = true
+		store.UpdateSubscription(ctx, *sub)
+	}()
+	runWatcher(t, w, 200*time.Millisecond)
+
+	for _, id := range []string{"UC1", "UC2"} {
+		if run, err := store.LastChannelRun(ctx, id); err != nil || run == nil {
+			t.Fatalf("expected %s to be synced, got %+v, %v", id, run, err)
+		}
+	}
+	if run, _ := store.LastChannelRun(ctx, "UC3"); run != nil {
+		t.Fatal("unscheduled subscription was synced")
+	}
+	if n := downloader.lists.Load(); n != 2 {
+		t.Fatalf("expected 2 syncs, got %d", n)
+	}
+}
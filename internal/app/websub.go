@@ -0,0 +1,401 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWebSubHub is the hub YouTube publishes channel feeds to.
+const DefaultWebSubHub = "https://pubsubhubbub.appspot.com/subscribe"
+
+const (
+	youtubeFeedTopic      = "https://www.youtube.com/xml/feeds/videos.xml?channel_id="
+	websubMaxBody         = 1 << 20
+	defaultWebSubLease    = 5 * 24 * time.Hour
+	defaultWebSubRenew    = 24 * time.Hour
+	defaultWebSubRefresh  = time.Hour
+	defaultWebSubMaxAge   = 48 * time.Hour
+	websubRequestTimeout  = 30 * time.Second
+	websubCallbackPattern = "/websub/{channel_id}"
+)
+
+// WebSubState is where a channel's hub subscription stands.
+type WebSubState string
+
+const (
+	// WebSubPending: a subscribe request was sent and the hub has not
+	// verified it yet.
+	WebSubPending WebSubState = "pending"
+	// WebSubActive: the hub verified the subscription; pushes arrive until
+	// the lease expires.
+	WebSubActive WebSubState = "active"
+	// WebSubUnsubscribing: an unsubscribe request awaits verification.
+	WebSubUnsubscribing WebSubState = "unsubscribing"
+	// WebSubDenied: the hub refused the subscription.
+	WebSubDenied WebSubState = "denied"
+)
+
+// WebSubLease tracks the hub subscription of one channel feed.
+type WebSubLease struct {
+	ChannelID string
+	Topic     string
+	State     WebSubState
+	ExpiresAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebSubOptions configures push notifications from a WebSub hub.
+type WebSubOptions struct {
+	// HubURL defaults to DefaultWebSubHub.
+	HubURL string
+	// CallbackURL is the public URL the hub reaches this server's /websub
+	// endpoint at, e.g. https://transfer.example.com/websub.
+	CallbackURL string
+	// Secret signs the hub's pushes (X-Hub-Signature); pushes with a
+	// missing or wrong signature are ignored.
+	Secret string
+	// Lease is the requested subscription lifetime (default 5 days).
+	Lease time.Duration
+	// RenewBefore renews leases that expire within this window (default
+	// one day).
+	RenewBefore time.Duration
+	// RefreshInterval is how often subscriptions and leases are checked
+	// (default one hour).
+	RefreshInterval time.Duration
+	// MaxAge ignores pushed entries published longer ago than this
+	// (default 48h); YouTube also pushes when old videos are edited.
+	MaxAge time.Duration
+	Client *http.Client
+}
+
+func (o WebSubOptions) Validate() error {
+	if o.CallbackURL == "" {
+		return errors.New("websub callback URL is required")
+	}
+	if u, err := url.Parse(o.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid websub callback URL %q", o.CallbackURL)
+	}
+	if o.Secret == "" {
+		return errors.New("websub secret is required")
+	}
+	return nil
+}
+
+// WebSubSubscriber keeps the enabled subscriptions subscribed at the hub
+// and turns pushed feed entries into single-video sync jobs.
+type WebSubSubscriber struct {
+	opts  WebSubOptions
+	store Store
+	jobs  *JobManager
+}
+
+func NewWebSubSubscriber(opts WebSubOptions, store Store, jobs *JobManager) *WebSubSubscriber {
+	if opts.HubURL == "" {
+		opts.HubURL = DefaultWebSubHub
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultWebSubLease
+	}
+	if opts.RenewBefore <= 0 {
+		opts.RenewBefore = defaultWebSubRenew
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = defaultWebSubRefresh
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultWebSubMaxAge
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: websubRequestTimeout}
+	}
+	opts.CallbackURL = strings.TrimSuffix(opts.CallbackURL, "/")
+	return &WebSubSubscriber{opts: opts, store: store, jobs: jobs}
+}
+
+// Run refreshes hub subscriptions right away and then every
+// RefreshInterval until ctx is cancelled.
+func (s *WebSubSubscriber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("websub: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh subscribes enabled subscriptions that have no lease, a lease
+// about to expire or a request the hub never verified, and unsubscribes
+// channels that were disabled or removed.
+func (s *WebSubSubscriber) Refresh(ctx context.Context) error {
+	subs, err := s.store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	leases, err := s.store.WebSubLeases(ctx)
+	if err != nil {
+		return err
+	}
+	byChannel := make(map[string]WebSubLease, len(leases))
+	for _, lease := range leases {
+		byChannel[lease.ChannelID] = lease
+	}
+
+	var errs []error
+	wanted := map[string]bool{}
+	now := time.Now()
+	for _, sub := range subs {
+		if !sub.Enabled {
+			continue
+		}
+		if looksLikeURL(sub.ChannelID) {
+			log.Printf("websub: skipping %s; push notifications need a UC... channel ID", sub.ChannelID)
+			continue
+		}
+		wanted[sub.ChannelID] = true
+		lease, ok := byChannel[sub.ChannelID]
+		switch {
+		case !ok, lease.State == WebSubDenied, lease.State == WebSubUnsubscribing:
+		case lease.State == WebSubPending && now.Sub(lease.UpdatedAt) < s.opts.RefreshInterval:
+			continue
+		case lease.State == WebSubActive && lease.ExpiresAt.Sub(now) > s.opts.RenewBefore:
+			continue
+		}
+		if err := s.request(ctx, "subscribe", sub.ChannelID, lease.ExpiresAt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, lease := range leases {
+		if wanted[lease.ChannelID] || lease.State == WebSubUnsubscribing {
+			continue
+		}
+		if lease.State == WebSubDenied {
+			if _, err := s.store.DeleteWebSubLease(ctx, lease.ChannelID); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := s.request(ctx, "unsubscribe", lease.ChannelID, lease.ExpiresAt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// request records the pending change and sends it to the hub, which
+// verifies it asynchronously through the callback.
+func (s *WebSubSubscriber) request(ctx context.Context, mode, channelID string, expires time.Time) error {
+	state := WebSubPending
+	if mode == "unsubscribe" {
+		state = WebSubUnsubscribing
+	}
+	topic := youtubeFeedTopic + channelID
+	lease := WebSubLease{ChannelID: channelID, Topic: topic, State: state, ExpiresAt: expires}
+	if err := s.store.SaveWebSubLease(ctx, lease); err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"hub.mode":     {mode},
+		"hub.topic":    {topic},
+		"hub.callback": {s.opts.CallbackURL + "/" + url.PathEscape(channelID)},
+		"hub.verify":   {"async"},
+	}
+	if mode == "subscribe" {
+		form.Set("hub.secret", s.opts.Secret)
+		form.Set("hub.lease_seconds", strconv.Itoa(int(s.opts.Lease/time.Second)))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.HubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", mode, channelID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: hub answered %s: %s", mode, channelID, resp.Status, strings.TrimSpace(string(body)))
+	}
+	log.Printf("websub: requested %s for %s", mode, channelID)
+	return nil
+}
+
+func (s *WebSubSubscriber) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+websubCallbackPattern, s.handleVerify)
+	mux.HandleFunc("POST "+websubCallbackPattern, s.handlePush)
+}
+
+// handleVerify answers the hub's intent verification by echoing
+// hub.challenge, but only for requests this subscriber actually made.
+func (s *WebSubSubscriber) handleVerify(w http.ResponseWriter, r *http.Request) {
+	channelID := r.PathValue("channel_id")
+	q := r.URL.Query()
+	lease, err := s.store.GetWebSubLease(r.Context(), channelID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if lease == nil || q.Get("hub.topic") != lease.Topic {
+		http.Error(w, "unknown topic", http.StatusNotFound)
+		return
+	}
+
+	switch q.Get("hub.mode") {
+	case "subscribe":
+		seconds, err := strconv.Atoi(q.Get("hub.lease_seconds"))
+		if lease.State != WebSubPending && lease.State != WebSubActive || err != nil || seconds <= 0 {
+			http.Error(w, "subscription not requested", http.StatusNotFound)
+			return
+		}
+		lease.State = WebSubActive
+		lease.ExpiresAt = time.Now().Add(time.Duration(seconds) * time.Second)
+		err = s.store.SaveWebSubLease(r.Context(), *lease)
+	case "unsubscribe":
+		if lease.State != WebSubUnsubscribing {
+			http.Error(w, "unsubscription not requested", http.StatusNotFound)
+			return
+		}
+		_, err = s.store.DeleteWebSubLease(r.Context(), channelID)
+	case "denied":
+		log.Printf("websub: hub denied subscription to %s: %s", channelID, q.Get("hub.reason"))
+		lease.State = WebSubDenied
+		err = s.store.SaveWebSubLease(r.Context(), *lease)
+	default:
+		http.Error(w, "invalid hub.mode", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("websub: hub confirmed %s for %s", q.Get("hub.mode"), channelID)
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, q.Get("hub.challenge"))
+}
+
+// handlePush queues a sync for every new video in a pushed feed. Pushes
+// with a bad signature are acknowledged but ignored, as the WebSub spec
+// requires, so a forger cannot tell whether it guessed right.
+func (s *WebSubSubscriber) handlePush(w http.ResponseWriter, r *http.Request) {
+	channelID := r.PathValue("channel_id")
+	body, err := io.ReadAll(io.LimitReader(r.Body, websubMaxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validHubSignature(s.opts.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		log.Printf("websub: ignoring push for %s with a missing or invalid signature", channelID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	entries, err := parseWebSubFeed(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, entry := range entries {
+		if entry.ChannelID != channelID || entry.VideoID == "" {
+			continue
+		}
+		if !entry.Published.IsZero() && time.Since(entry.Published) > s.opts.MaxAge {
+			continue
+		}
+		if err := s.enqueue(r.Context(), channelID, entry.VideoID); err != nil {
+			log.Printf("websub: queueing %s: %v", entry.VideoID, err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrJobQueueFull) {
+				status = http.StatusServiceUnavailable
+			}
+			// The hub retries failed deliveries; videos queued already are
+			// skipped next time.
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// enqueue submits a single-video sync of a channel's video unless the
+// video was uploaded anywhere or is already being tracked.
+func (s *WebSubSubscriber) enqueue(ctx context.Context, channelID, videoID string) error {
+	uploads, err := s.store.Uploads(ctx, videoID)
+	if err != nil || len(uploads) > 0 {
+		return err
+	}
+	job, err := s.store.GetJob(ctx, videoID)
+	if err != nil || job != nil {
+		return err
+	}
+	queued, err := s.jobs.Submit(SyncRequest{ChannelID: channelID, VideoID: videoID})
+	if err != nil {
+		return err
+	}
+	log.Printf("websub: new video %s, queued job %s", videoID, queued.ID)
+	return nil
+}
+
+// websubEntry is one <entry> of a YouTube push notification.
+type websubEntry struct {
+	VideoID   string    `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+	ChannelID string    `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+	Title     string    `xml:"title"`
+	Published time.Time `xml:"published"`
+	Updated   time.Time `xml:"updated"`
+}
+
+func parseWebSubFeed(body []byte) ([]websubEntry, error) {
+	var feed struct {
+		Entries []websubEntry `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("parsing feed: %w", err)
+	}
+	return feed.Entries, nil
+}
+
+var hubSignatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// validHubSignature checks an X-Hub-Signature header ("sha1=<hex>") against
+// the HMAC of body.
+func validHubSignature(secret, header string, body []byte) bool {
+	algo, sig, ok := strings.Cut(header, "=")
+	newHash, known := hubSignatureHashes[algo]
+	if !ok || !known {
+		return false
+	}
+	want, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeHub accepts (un)subscribe requests and verifies them against the
+// callback the way a WebSub hub does.
+type fakeHub struct {
+	*httptest.Server
+	verified chan url.Values
+}
+
+func newFakeHub(t *testing.T) *fakeHub {
+	hub := &fakeHub{verified: make(chan url.Values, 4)}
+	hub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		form := r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+		go hub.verify(form)
+	}))
+	t.Cleanup(hub.Close)
+	return hub
+}
+
+func (h *fakeHub) verify(form url.Values) {
+	q := url.Values{
+		"hub.mode":      {form.Get("hub.mode")},
+		"hub.topic":     {form.Get("hub.topic")},
+		"hub.challenge": {"challenge-123"},
+	}
+	if form.Get("hub.mode") == "subscribe" {
+		q.Set("hub.lease_seconds", form.Get("hub.lease_seconds"))
+	}
+	resp, err := http.Get(form.Get("hub.callback") + "?" + q.Encode())
+	if err != nil {
+		form.Set("error", err.Error())
+		h.verified <- form
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	form.Set("verified", fmt.Sprint(resp.StatusCode == http.StatusOK && string(body) == "challenge-123"))
+	h.verified <- form
+}
+
+func (h *fakeHub) waitVerified(t *testing.T) url.Values {
+	t.Helper()
+	select {
+	case form := <-h.verified:
+		if form.Get("verified") != "true" {
+			t.Fatalf("callback did not confirm %s: %v", form.Get("hub.mode"), form)
+		}
+		return form
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub request did not arrive")
+		return nil
+	}
+}
+
+func websubFeed(videoID, channelID string, published time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns="http://www.w3.org/2005/Atom">
+  <link rel="hub" href="https://pubsubhubbub.appspot.com"/>
+  <title>YouTube video feed</title>
+  <entry>
+    <id>yt:video:%[1]s</id>
+    <yt:videoId>%[1]s</yt:videoId>
+    <yt:channelId>%[2]s</yt:channelId>
+    <title>New upload</title>
+    <published>%[3]s</published>
+    <updated>%[3]s</updated>
+  </entry>
+</feed>`, videoID, channelID, published.Format(time.RFC3339))
+}
+
+func pushFeed(t *testing.T, callback, secret, feed string) int {
+	t.Helper()
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(feed))
+	req, _ := http.NewRequest(http.MethodPost, callback, strings.NewReader(feed))
+	req.Header.Set("Content-Type", "application/atom+xml")
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebSubSubscribeVerifyAndPush(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := store.AddSubscription(ctx, Subscription{ChannelID: "UC1", Limit: 1, Enabled: true, Platforms: []string{"douyin"}}); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(t.TempDir(), "new.mp4")
+	if err := os.WriteFile(video, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bilibili, douyin := &stubUploader{}, &stubUploader{}
+	c := &Controller{
+		Downloader: &stubDownloader{files: map[string][]string{videoURL("vid1"): {video}}},
+		Uploader:   bilibili,
+		ResolveDestination: func(name string) (Destination, error) {
+			return Destination{Platform: name, Uploader: douyin}, nil
+		},
+		Store: store,
+	}
+	jobs := NewJobManager(c)
+	runCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go jobs.Run(runCtx)
+	srv := httptest.NewServer(nil)
+	t.Cleanup(srv.Close)
+	hub := newFakeHub(t)
+	sub := NewWebSubSubscriber(WebSubOptions{HubURL: hub.URL, CallbackURL: srv.URL + "/websub/", Secret: "s3cret"}, store, jobs)
+	srv.Config.Handler = newHTTPHandler(jobs, sub)
+
+	if err := sub.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	form := hub.waitVerified(t)
+	if form.Get("hub.topic") != youtubeFeedTopic+"UC1" || form.Get("hub.secret") != "s3cret" || form.Get("hub.callback") != srv.URL+"/websub/UC1" {
+		t.Fatalf("unexpected subscribe request: %v", form)
+	}
+	lease, err := store.GetWebSubLease(ctx, "UC1")
+	if err != nil || lease == nil || lease.State != WebSubActive || time.Until(lease.ExpiresAt) < 4*24*time.Hour {
+		t.Fatalf("expected an active lease, got %+v, %v", lease, err)
+	}
+	// An active lease is not renewed on every refresh.
+	if err := sub.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case form := <-hub.verified:
+		t.Fatalf("unexpected hub request: %v", form)
+	default:
+	}
+
+	resp, err := http.Get(srv.URL + "/websub/UC1?hub.mode=subscribe&hub.topic=https://example.com/other&hub.challenge=x&hub.lease_seconds=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("verification of an unknown topic answered %d", resp.StatusCode)
+	}
+
+	callback := srv.URL + "/websub/UC1"
+	if status := pushFeed(t, callback, "wrong", websubFeed("forged", "UC1", time.Now())); status != http.StatusAccepted {
+		t.Fatalf("forged push answered %d", status)
+	}
+	if status := pushFeed(t, callback, "s3cret", websubFeed("old", "UC1", time.Now().AddDate(-1, 0, 0))); status != http.StatusNoContent {
+		t.Fatalf("old video push answered %d", status)
+	}
+	if status := pushFeed(t, callback, "s3cret", websubFeed("vid1", "UC1", time.Now())); status != http.StatusNoContent {
+		t.Fatalf("push answered %d", status)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list := jobs.List()
+		if len(list) == 1 && list[0].finished() {
+			if list[0].Request.VideoID != "vid1" || list[0].Request.ChannelID != "UC1" || list[0].Status != SyncJobSucceeded {
+				t.Fatalf("unexpected job: %+v", list[0])
+			}
+			break
+		}
+		if len(list) > 1 || time.Now().After(deadline) {
+			t.Fatalf("expected exactly one finished job, got %+v", list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The pushed video belongs to UC1, so it went to the subscription's
+	// platforms rather than the default destination.
+	if job, err := store.GetJob(ctx, "vid1"); err != nil || job == nil || job.ChannelID != "UC1" {
+		t.Fatalf("expected the job to record channel UC1, got %+v, %v", job, err)
+	}
+	if len(douyin.uploads) != 1 || len(bilibili.uploads) != 0 {
+		t.Fatalf("expected one douyin upload and no default one, got %v and %v", douyin.uploads, bilibili.uploads)
+	}
+	if uploaded, err := store.IsUploaded(ctx, "vid1", "douyin", ""); err != nil || !uploaded {
+		t.Fatalf("expected vid1 recorded as uploaded to douyin, got %v, %v", uploaded, err)
+	}
+	// Repeated pushes (YouTube also pushes on edits) do not queue it again.
+	pushFeed(t, callback, "s3cret", websubFeed("vid1", "UC1", time.Now()))
+	if n := len(jobs.List()); n != 1 {
+		t.Fatalf("expected the uploaded video to be skipped, got %d jobs", n)
+	}
+
+	disabled := false
+	subscription, _ := store.GetSubscription(ctx, "UC1")
+	store.UpdateSubscription(ctx, SubscriptionPatch{Enabled: &disabled}.Apply(*subscription))
+	if err := sub.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if form := hub.waitVerified(t); form.Get("hub.mode") != "unsubscribe" {
+		t.Fatalf("expected an unsubscribe request, got %v", form)
+	}
+	if lease, err := store.GetWebSubLease(ctx, "UC1"); err != nil || lease != nil {
+		t.Fatalf("expected the lease to be removed, got %+v, %v", lease, err)
+	}
+}
+
+func TestValidHubSignature(t *testing.T) {
+	body := []byte("<feed/>")
+	mac := hmac.New(sha1.New, []byte("key"))
+	mac.Write(body)
+	sig := hex.EncodeToString(mac.Sum(nil))
+	for header, want := range map[string]bool{
+		"sha1=" + sig:  true,
+		"sha1=" + "00": false,
+		"md5=" + sig:   false,
+		sig:            false,
+		"":             false,
+	} {
+		if got := validHubSignature("key", header, body); got != want {
+			t.Errorf("validHubSignature(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// YtDlpErrorKind names a class of yt-dlp failure.
+type YtDlpErrorKind string
+
+const (
+	YtDlpUnavailable       YtDlpErrorKind = "video_unavailable"
+	YtDlpPrivate           YtDlpErrorKind = "private"
+	YtDlpMembersOnly       YtDlpErrorKind = "members_only"
+	YtDlpAgeRestricted     YtDlpErrorKind = "age_restricted"
+	YtDlpGeoBlocked        YtDlpErrorKind = "geo_blocked"
+	YtDlpRateLimited       YtDlpErrorKind = "rate_limited"
+	YtDlpSignInRequired    YtDlpErrorKind = "sign_in_required"
+	YtDlpFormatUnavailable YtDlpErrorKind = "format_unavailable"
+	YtDlpNetwork           YtDlpErrorKind = "network"
+	YtDlpUnknown           YtDlpErrorKind = "unknown"
+)
+
+// ErrorAction is what an operator should do about a failure.
+type ErrorAction string
+
+const (
+	// ActionRefreshCookies: the video needs a logged-in session; export
+	// fresh cookies for yt-dlp.
+	ActionRefreshCookies ErrorAction = "refresh_cookies"
+	// ActionWait: the failure is temporary; a later sync will succeed.
+	ActionWait ErrorAction = "wait"
+	// ActionGiveUp: the video cannot be downloaded from here.
+	ActionGiveUp ErrorAction = "give_up"
+)
+
+// Action tells whether to refresh cookies, wait, or give up.
+func (k YtDlpErrorKind) Action() ErrorAction {
+	switch k {
+	case YtDlpSignInRequired, YtDlpAgeRestricted:
+		return ActionRefreshCookies
+	case YtDlpRateLimited, YtDlpNetwork, YtDlpUnknown:
+		return ActionWait
+	default:
+		return ActionGiveUp
+	}
+}
+
+// YtDlpError is a yt-dlp failure classified from its stderr. Compare
+// kinds with errors.Is against the Err* sentinels, or use errors.As to get
+// the message yt-dlp printed.
+type YtDlpError struct {
+	Kind YtDlpErrorKind
+	// Message is the last ERROR: line yt-dlp printed, if any.
+	Message string
+	// Err is the underlying process error (usually an exit status).
+	Err error
+}
+
+func (e *YtDlpError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("yt-dlp failed (%s): %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("yt-dlp failed (%s): %v", e.Kind, e.Err)
+}
+
+func (e *YtDlpError) Unwrap() error { return e.Err }
+
+// Is matches another *YtDlpError of the same kind, so
+// errors.Is(err, ErrPrivateVideo) works on any wrapped yt-dlp error.
+func (e *YtDlpError) Is(target error) bool {
+	t, ok := target.(*YtDlpError)
+	return ok && t.Err == nil && t.Kind == e.Kind
+}
+
+var (
+	ErrVideoUnavailable  = &YtDlpError{Kind: YtDlpUnavailable}
+	ErrPrivateVideo      = &YtDlpError{Kind: YtDlpPrivate}
+	ErrMembersOnly       = &YtDlpError{Kind: YtDlpMembersOnly}
+	ErrAgeRestricted     = &YtDlpError{Kind: YtDlpAgeRestricted}
+	ErrGeoBlocked        = &YtDlpError{Kind: YtDlpGeoBlocked}
+	ErrRateLimited       = &YtDlpError{Kind: YtDlpRateLimited}
+	ErrSignInRequired    = &YtDlpError{Kind: YtDlpSignInRequired}
+	ErrFormatUnavailable = &YtDlpError{Kind: YtDlpFormatUnavailable}
+	ErrNetwork           = &YtDlpError{Kind: YtDlpNetwork}
+)
+
+// ytDlpErrorPatterns are matched against lower-cased ERROR: lines in
+// order; more specific messages come first because e.g. private and
+// members-only videos also mention signing in.
+var ytDlpErrorPatterns = []struct {
+	kind     YtDlpErrorKind
+	contains []string
+}{
+	{YtDlpPrivate, []string{"private video", "this video is private"}},
+	{YtDlpMembersOnly, []string{"members-only", "members only", "join this channel"}},
+	{YtDlpAgeRestricted, []string{"confirm your age", "age-restricted", "age restricted", "inappropriate for some users"}},
+	{YtDlpGeoBlocked, []string{"in your country", "geo restrict", "geo-restrict", "geoblock"}},
+	{YtDlpRateLimited, []string{"http error 429", "too many requests", "rate-limit", "rate limit"}},
+	{YtDlpSignInRequired, []string{"not a bot", "sign in", "login required", "use --cookies", "cookies-from-browser"}},
+	{YtDlpFormatUnavailable, []string{"requested format is not available", "no video formats found", "format is not available"}},
+	{YtDlpUnavailable, []string{"video unavailable", "has been removed", "is not available", "does not exist", "account associated with this video has been terminated"}},
+	{YtDlpNetwork, []string{
+		"unable to download webpage", "unable to download api page", "urlopen error", "connection reset",
+		"connection refused", "timed out", "name or service not known", "temporary failure in name resolution",
+		"network is unreachable", "remote end closed connection", "http error 5",
+	}},
+}
+
+// newYtDlpError classifies a failed yt-dlp run from its output. It looks at
+// ERROR: lines first and falls back to the whole output, since some
+// failures (429s, DNS errors) only show up as warnings.
+func newYtDlpError(output string, runErr error) *YtDlpError {
+	var errorLines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ERROR:") {
+			errorLines = append(errorLines, line)
+		}
+	}
+	e := &YtDlpError{Kind: YtDlpUnknown, Err: runErr}
+	if len(errorLines) > 0 {
+		e.Message = errorLines[len(errorLines)-1]
+	}
+	for _, text := range []string{strings.Join(errorLines, "\n"), output} {
+		if kind, ok := matchYtDlpError(strings.ToLower(text)); ok {
+			e.Kind = kind
+			break
+		}
+	}
+	return e
+}
+
+func matchYtDlpError(text string) (YtDlpErrorKind, bool) {
+	if text == "" {
+		return "", false
+	}
+	for _, p := range ytDlpErrorPatterns {
+		for _, needle := range p.contains {
+			if strings.Contains(text, needle) {
+				return p.kind, true
+			}
+		}
+	}
+	return "", false
+}
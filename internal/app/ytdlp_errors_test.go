@@ -0,0 +1,55 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewYtDlpErrorClassifiesStderr(t *testing.T) {
+	tests := []struct {
+		stderr string
+		kind   YtDlpErrorKind
+		action ErrorAction
+	}{
+		{"ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader", YtDlpUnavailable, ActionGiveUp},
+		{"ERROR: [youtube] abc: Private video. Sign in if you've been granted access to this video", YtDlpPrivate, ActionGiveUp},
+		{"ERROR: [youtube] abc: Join this channel to get access to members-only content like this video, and other exclusive perks.", YtDlpMembersOnly, ActionGiveUp},
+		{"ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.", YtDlpAgeRestricted, ActionRefreshCookies},
+		{"ERROR: [youtube] abc: The uploader has not made this video available in your country", YtDlpGeoBlocked, ActionGiveUp},
+		{"ERROR: [youtube] abc: Unable to download API page: HTTP Error 429: Too Many Requests", YtDlpRateLimited, ActionWait},
+		{"ERROR: [youtube] abc: Sign in to confirm you’re not a bot. Use --cookies-from-browser or --cookies for the authentication.", YtDlpSignInRequired, ActionRefreshCookies},
+		{"ERROR: [youtube] abc: Requested format is not available. Use --list-formats for a list of available formats", YtDlpFormatUnavailable, ActionGiveUp},
+		{"WARNING: [youtube] Retrying (1/3)...\nERROR: [youtube] abc: Unable to download webpage: <urlopen error [Errno -3] Temporary failure in name resolution>", YtDlpNetwork, ActionWait},
+		{"WARNING: HTTP Error 429: Too Many Requests\nERROR: something odd", YtDlpRateLimited, ActionWait},
+		{"Traceback (most recent call last):\nKeyError: 'formats'", YtDlpUnknown, ActionWait},
+	}
+	for _, tt := range tests {
+		err := newYtDlpError(tt.stderr, &fakeExitError{code: 1})
+		if err.Kind != tt.kind || err.Kind.Action() != tt.action {
+			t.Errorf("%q: got %s/%s, want %s/%s", tt.stderr, err.Kind, err.Kind.Action(), tt.kind, tt.action)
+		}
+	}
+}
+
+func TestYtDlpErrorWorksWithErrorsIsAndAs(t *testing.T) {
+	exit := &fakeExitError{code: 1}
+	err := fmt.Errorf("downloading abc: %w", newYtDlpError("ERROR: [youtube] abc: Private video", exit))
+
+	if !errors.Is(err, ErrPrivateVideo) || errors.Is(err, ErrVideoUnavailable) {
+		t.Fatalf("errors.Is mismatch for %v", err)
+	}
+	if !errors.Is(err, exit) {
+		t.Fatal("expected the exit error to stay reachable")
+	}
+	var ytErr *YtDlpError
+	if !errors.As(err, &ytErr) || ytErr.Message != "ERROR: [youtube] abc: Private video" {
+		t.Fatalf("errors.As: %+v", ytErr)
+	}
+	if ClassifyError(err) != ErrorPermanent {
+		t.Fatal("private videos should not be retried")
+	}
+	if ClassifyError(newYtDlpError("ERROR: HTTP Error 429", exit)) != ErrorTransient {
+		t.Fatal("rate limits should be retried")
+	}
+}